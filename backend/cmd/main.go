@@ -1,55 +1,180 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/KennyMwendwaX/reformat/internal/config"
 	"github.com/KennyMwendwaX/reformat/internal/handlers"
-	"github.com/joho/godotenv"
+	"github.com/KennyMwendwaX/reformat/internal/storage"
+	"github.com/KennyMwendwaX/reformat/internal/tracing"
 )
 
-// CORS middleware to allow cross-origin requests
-func corsMiddleware(next http.Handler) http.Handler {
-	err := godotenv.Load()
+func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		slog.Error("Configuration error", "error", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(newLogger(cfg.Log))
+	handlers.Configure(cfg)
+	if err := handlers.OpenStorage(context.Background()); err != nil {
+		slog.Error("Storage error", "error", err)
+		os.Exit(1)
+	}
+	if cfg.Storage.Backend == "s3" {
+		slog.Info("Keeping results in storage", "storage", "s3", "bucket", cfg.Storage.S3.Bucket,
+			"prefix", cfg.Storage.S3.Prefix, "retention", cfg.Storage.Retention.String(), "keep_inputs", cfg.Storage.KeepInputs)
+	} else {
+		slog.Info("Keeping results in storage", "storage", "local", "dir", cfg.Cache.Path(),
+			"retention", cfg.Storage.Retention.String(), "keep_inputs", cfg.Storage.KeepInputs)
+	}
+	if cfg.Cache.Enabled {
+		slog.Info("Caching conversion results", "max_size", int64(cfg.Cache.MaxSize))
 	}
+	go sweepStorage(cfg.Storage.Retention)
 
-	clientUrl := os.Getenv("CLIENT_URL")
-	if clientUrl == "" {
-		log.Fatal("CLIENT_URL not set in .env file")
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("Tracing error", "error", err)
+		os.Exit(1)
+	}
+	if cfg.Tracing.Enabled {
+		slog.Info("Exporting traces", "endpoint", cfg.Tracing.Endpoint)
 	}
 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", clientUrl)             // Allow requests from your frontend
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS") // Allowed HTTP methods
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")       // Allowed headers
+	if removed, err := handlers.SweepTempDirs(); err != nil {
+		slog.Warn("Error removing leftover temporary directories", "error", err)
+	} else if removed > 0 {
+		slog.Info("Removed leftover temporary directories", "count", removed)
+	}
 
-		// Handle preflight requests
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+	for tool, err := range handlers.CheckDependencies() {
+		slog.Warn("Conversions using a missing tool are disabled", "tool", tool, "error", err)
+	}
 
-		next.ServeHTTP(w, r)
-	})
-}
+	cors := handlers.CORS(cfg.CORS)
+	conversion := func(h http.HandlerFunc) http.Handler {
+		return cors(handlers.Authenticate(handlers.RateLimit(
+			handlers.LimitConversions(handlers.InstrumentConversions(h)))))
+	}
+	if cfg.Auth.Enabled {
+		slog.Info("API keys required on conversion endpoints", "keys", len(cfg.Auth.Keys))
+	}
 
-func main() {
 	// Conversion endpoint
-	http.Handle("/api/convert", corsMiddleware(http.HandlerFunc(handlers.Convert)))
+	http.Handle("/api/convert", conversion(handlers.Convert))
+
+	// Image metadata inspection endpoint
+	http.Handle("/api/inspect", conversion(handlers.Inspect))
+
+	// Thumbnail preview endpoint
+	http.Handle("/api/preview", conversion(handlers.Preview))
+
+	// Contact sheet endpoint
+	http.Handle("/api/contact-sheet", conversion(handlers.ContactSheet))
+
+	// PDF merge, split, extract, reorder, rotate, metadata and encryption endpoints
+	http.Handle("/api/pdf/", conversion(handlers.PDFTools))
+
+	// PDF/A validation endpoint
+	http.Handle("/api/pdf/validate", conversion(handlers.ValidatePDF))
+
+	// Presigned downloads of results kept in local storage
+	http.Handle(storage.DownloadPath, cors(http.HandlerFunc(handlers.Download)))
+
+	// Daily usage and quotas of the caller's API key
+	http.Handle("/api/usage", cors(http.HandlerFunc(handlers.Usage)))
+
+	// Liveness and readiness probes
+	http.HandleFunc("/healthz", handlers.Healthz)
+	http.HandleFunc("/readyz", handlers.Readyz)
+
+	// Prometheus metrics
+	http.HandleFunc("/metrics", handlers.Metrics)
 
-	// Configure server with reasonable timeouts
 	server := &http.Server{
-		Addr:         ":8000",
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 30 * time.Second, // Longer timeout for file conversions
+		Addr:         cfg.Server.Addr,
+		Handler:      handlers.RequestID(handlers.Trace(http.DefaultServeMux)),
+		ReadTimeout:  cfg.Timeouts.Read,
+		WriteTimeout: cfg.Timeouts.Write, // Longer timeout for file conversions
+		IdleTimeout:  cfg.Timeouts.Idle,
+		ErrorLog:     slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if cfg.TLS.Enabled() {
+			slog.Info("Starting server", "addr", server.Addr, "tls", true)
+			serveErr <- server.ListenAndServeTLS(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+		} else {
+			slog.Info("Starting server", "addr", server.Addr, "tls", false)
+			serveErr <- server.ListenAndServe()
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-serveErr:
+		slog.Error("Server failed to start", "error", err)
+		os.Exit(1)
+	case sig := <-stop:
+		slog.Info("Shutting down, waiting for running requests", "signal", sig.String(), "timeout", cfg.Timeouts.Shutdown.String())
 	}
+	// A second signal kills the process without waiting
+	signal.Stop(stop)
+
+	// Shutdown stops accepting connections and returns once every running
+	// request, conversions included, has finished and cleaned up
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Shutdown)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Warn("Requests still running, closing connections", "timeout", cfg.Timeouts.Shutdown.String(), "error", err)
+		server.Close()
+	} else {
+		slog.Info("Server stopped")
+	}
+
+	// Spans of the last requests are still buffered
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Warn("Error flushing traces", "error", err)
+	}
+}
+
+// sweepStorage removes expired uploads and results from storage at startup
+// and then every quarter of the retention time
+func sweepStorage(retention time.Duration) {
+	ticker := time.NewTicker(retention / 4)
+	defer ticker.Stop()
+	for {
+		if removed, err := handlers.SweepStorage(context.Background()); err != nil {
+			slog.Warn("Error removing expired files from storage", "error", err)
+		} else if removed > 0 {
+			slog.Info("Removed expired files from storage", "count", removed)
+		}
+		<-ticker.C
+	}
+}
 
-	log.Printf("Starting server on %s", server.Addr)
-	if err := server.ListenAndServe(); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+// newLogger builds the logger configured by c, writing to stderr
+func newLogger(c config.LogConfig) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: c.SlogLevel()}
+	if c.Format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
 	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
 }
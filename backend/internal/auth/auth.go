@@ -0,0 +1,150 @@
+// Package auth checks API keys and keeps the daily usage of each key
+// against its quotas.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+)
+
+// ErrQuotaExceeded is returned when a key has used up a daily quota
+var ErrQuotaExceeded = errors.New("daily quota exceeded")
+
+// Key is a known API key with its quotas and scopes
+type Key struct {
+	Name             string
+	DailyBytes       int64 // 0 for no limit
+	DailyConversions int   // 0 for no limit
+	Formats          []string
+}
+
+// Allows reports whether the key may convert to target, the output format
+// or operation of a request
+func (k *Key) Allows(target string) bool {
+	if len(k.Formats) == 0 {
+		return true
+	}
+	for _, pattern := range k.Formats {
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Usage is what a key used on one UTC day. Reserved conversions are
+// running and not yet counted.
+type Usage struct {
+	Day         time.Time // midnight UTC
+	Bytes       int64
+	Conversions int
+
+	reservedConversions int
+	reservedBytes       int64
+}
+
+// Reset is when the usage starts over
+func (u Usage) Reset() time.Time {
+	return u.Day.AddDate(0, 0, 1)
+}
+
+// Keyring holds the configured keys and their usage. Usage is kept in
+// memory, so it starts over when the server restarts.
+type Keyring struct {
+	keys map[[sha256.Size]byte]*Key
+	now  func() time.Time
+
+	mu    sync.Mutex
+	usage map[string]*Usage
+}
+
+// NewKeyring builds the keyring of the configured keys. The keys must have
+// passed config validation.
+func NewKeyring(keys []config.APIKeyConfig) *Keyring {
+	k := &Keyring{
+		keys:  map[[sha256.Size]byte]*Key{},
+		now:   time.Now,
+		usage: map[string]*Usage{},
+	}
+	for _, c := range keys {
+		var digest [sha256.Size]byte
+		if c.Key != "" {
+			digest = sha256.Sum256([]byte(c.Key))
+		} else {
+			hex.Decode(digest[:], []byte(c.KeySHA256))
+		}
+		k.keys[digest] = &Key{
+			Name:             c.Name,
+			DailyBytes:       int64(c.DailyBytes),
+			DailyConversions: c.DailyConversions,
+			Formats:          c.Formats,
+		}
+	}
+	return k
+}
+
+// Lookup returns the key matching secret. Keys are compared by digest, so
+// the time taken does not depend on how much of a key matches.
+func (k *Keyring) Lookup(secret string) (*Key, bool) {
+	key, ok := k.keys[sha256.Sum256([]byte(secret))]
+	return key, ok
+}
+
+// Usage returns what key used today
+func (k *Keyring) Usage(key *Key) Usage {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return *k.today(key)
+}
+
+// Reserve holds one conversion of size bytes against the quotas of key
+// until the returned function is called with the bytes actually uploaded
+// and whether the conversion succeeded. Only successful conversions count.
+// It fails with ErrQuotaExceeded when the reservation does not fit.
+func (k *Keyring) Reserve(key *Key, size int64) (func(bytes int64, ok bool), error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	u := k.today(key)
+	if key.DailyConversions > 0 && u.Conversions+u.reservedConversions >= key.DailyConversions {
+		return nil, ErrQuotaExceeded
+	}
+	if key.DailyBytes > 0 && u.Bytes+u.reservedBytes+size > key.DailyBytes {
+		return nil, ErrQuotaExceeded
+	}
+	u.reservedConversions++
+	u.reservedBytes += size
+
+	return func(bytes int64, ok bool) {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		// A reservation made before midnight is not carried to the new day
+		if k.today(key) != u {
+			return
+		}
+		u.reservedConversions--
+		u.reservedBytes -= size
+		if ok {
+			u.Conversions++
+			u.Bytes += bytes
+		}
+	}, nil
+}
+
+// today returns the usage record of key for the current UTC day, starting
+// a new one after midnight. The caller holds mu.
+func (k *Keyring) today(key *Key) *Usage {
+	now := k.now().UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	u, ok := k.usage[key.Name]
+	if !ok || !u.Day.Equal(day) {
+		u = &Usage{Day: day}
+		k.usage[key.Name] = u
+	}
+	return u
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+)
+
+func TestAllows(t *testing.T) {
+	key := &Key{Formats: []string{"pdf", "pdf-*"}}
+	for target, want := range map[string]bool{
+		"pdf": true, "pdf-merge": true, "docx": false, "contact-sheet-pdf": false,
+	} {
+		if got := key.Allows(target); got != want {
+			t.Errorf("Allows(%q) = %v, want %v", target, got, want)
+		}
+	}
+	if !(&Key{}).Allows("docx") {
+		t.Error("a key without formats should allow every target")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	k := NewKeyring([]config.APIKeyConfig{
+		{Name: "plain", Key: "secret"},
+		// sha256("test")
+		{Name: "hashed", KeySHA256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"},
+	})
+	for secret, want := range map[string]string{"secret": "plain", "test": "hashed", "other": ""} {
+		key, ok := k.Lookup(secret)
+		if name := ""; ok {
+			name = key.Name
+			if name != want {
+				t.Errorf("Lookup(%q) = %s, want %q", secret, name, want)
+			}
+		} else if want != "" {
+			t.Errorf("Lookup(%q) found nothing, want %s", secret, want)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	type step struct {
+		name    string
+		at      time.Duration // since midnight of day
+		size    int64
+		settle  int64 // bytes the conversion used, -1 to keep it running
+		ok      bool  // whether the conversion succeeds
+		wantErr bool
+	}
+	tests := []struct {
+		name  string
+		key   Key
+		steps []step
+		want  Usage // after the last step
+	}{
+		{
+			name: "conversions",
+			key:  Key{Name: "k", DailyConversions: 2},
+			steps: []step{
+				{"first", time.Hour, 10, 10, true, false},
+				{"failed does not count", time.Hour, 10, 10, false, false},
+				{"second", time.Hour, 10, 10, true, false},
+				{"over", time.Hour, 10, 0, false, true},
+			},
+			want: Usage{Day: day, Bytes: 20, Conversions: 2},
+		},
+		{
+			name: "running conversions count",
+			key:  Key{Name: "k", DailyConversions: 1},
+			steps: []step{
+				{"running", time.Hour, 10, -1, false, false},
+				{"second while running", time.Hour, 10, 0, false, true},
+			},
+			want: Usage{Day: day, reservedConversions: 1, reservedBytes: 10},
+		},
+		{
+			name: "bytes",
+			key:  Key{Name: "k", DailyBytes: 100},
+			steps: []step{
+				{"reserve 60", time.Hour, 60, -1, false, false},
+				{"60 more while running", time.Hour, 60, 0, false, true},
+				{"40 fits", time.Hour, 40, 30, true, false},
+			},
+			want: Usage{Day: day, Bytes: 30, Conversions: 1, reservedConversions: 1, reservedBytes: 60},
+		},
+		{
+			name: "new day",
+			key:  Key{Name: "k", DailyConversions: 1},
+			steps: []step{
+				{"yesterday", time.Hour, 10, 10, true, false},
+				{"used up", 23 * time.Hour, 10, 0, false, true},
+				{"after midnight", 25 * time.Hour, 10, 10, true, false},
+			},
+			want: Usage{Day: day.AddDate(0, 0, 1), Bytes: 10, Conversions: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		k := NewKeyring(nil)
+		var now time.Time
+		k.now = func() time.Time { return now }
+		for _, s := range tt.steps {
+			now = day.Add(s.at)
+			release, err := k.Reserve(&tt.key, s.size)
+			if s.wantErr {
+				if !errors.Is(err, ErrQuotaExceeded) {
+					t.Errorf("%s/%s: error = %v, want ErrQuotaExceeded", tt.name, s.name, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s/%s: %v", tt.name, s.name, err)
+				continue
+			}
+			if s.settle >= 0 {
+				release(s.settle, s.ok)
+			}
+		}
+		if got := k.Usage(&tt.key); got != tt.want {
+			t.Errorf("%s: usage = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReserveAcrossMidnight(t *testing.T) {
+	day := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	k := NewKeyring(nil)
+	now := day.Add(24*time.Hour - time.Minute)
+	k.now = func() time.Time { return now }
+	key := &Key{Name: "k", DailyConversions: 1}
+
+	release, err := k.Reserve(key, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Finished after midnight: counted on neither day
+	now = day.Add(24*time.Hour + time.Minute)
+	release(10, true)
+
+	want := Usage{Day: day.AddDate(0, 0, 1)}
+	if got := k.Usage(key); got != want {
+		t.Errorf("usage = %+v, want %+v", got, want)
+	}
+	if got := k.Usage(key).Reset(); !got.Equal(day.AddDate(0, 0, 2)) {
+		t.Errorf("reset = %s, want midnight of the next day", got)
+	}
+}
@@ -0,0 +1,212 @@
+// Package cache keeps conversion results in a storage.Store under a key
+// derived from their input, target and options, and evicts the least
+// recently used results once the cache grows past its size bound.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/KennyMwendwaX/reformat/internal/storage"
+)
+
+// Prefix of the storage keys of results
+const keyPrefix = "results/"
+
+// ErrTooLarge is returned for a result bigger than the whole cache
+var ErrTooLarge = errors.New("result is larger than the cache")
+
+// Entry is a cached result
+type Entry struct {
+	Key    string
+	Size   int64             // bytes of the result
+	Header map[string]string // response headers replayed with the result
+}
+
+// Cache is a size-bounded, least recently used set of results in a store.
+// Results survive restarts, which order them by the time they were stored.
+// Replicas sharing a store each bound the results they know of; a result
+// stored by another replica becomes known on its first lookup, and one
+// evicted by another replica is forgotten on its next.
+type Cache struct {
+	store   storage.Store
+	maxSize int64
+
+	mu      sync.Mutex
+	lru     *list.List // of *Entry, most recently used first
+	entries map[string]*list.Element
+	size    int64
+}
+
+// Key derives the key of the result of converting inputFile to target with
+// options of the given converter.Fingerprint
+func Key(inputFile, target, fingerprint string) (string, error) {
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	input := sha256.New()
+	if _, err := io.Copy(input, f); err != nil {
+		return "", err
+	}
+
+	key := sha256.New()
+	fmt.Fprintf(key, "%x\x00%s\x00%s", input.Sum(nil), target, fingerprint)
+	return hex.EncodeToString(key.Sum(nil)), nil
+}
+
+// Open loads the results found in store and evicts the oldest ones past
+// maxSize
+func Open(ctx context.Context, store storage.Store, maxSize int64) (*Cache, error) {
+	objects, err := store.List(ctx, keyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("error listing cached results: %w", err)
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].ModTime.After(objects[j].ModTime) })
+
+	c := &Cache{store: store, maxSize: maxSize, lru: list.New(), entries: map[string]*list.Element{}}
+	for _, obj := range objects {
+		key := strings.TrimPrefix(obj.Key, keyPrefix)
+		if !validKey(key) {
+			continue
+		}
+		// Headers are read with the result on its first lookup
+		entry := &Entry{Key: key, Size: obj.Size, Header: obj.Header}
+		c.entries[key] = c.lru.PushBack(entry)
+		c.size += entry.Size
+	}
+	c.mu.Lock()
+	evicted := c.evict()
+	c.mu.Unlock()
+	c.remove(ctx, evicted)
+	return c, nil
+}
+
+// Get opens the result stored under key and marks it as recently used. The
+// caller closes the body. Results missing from the store or failing to
+// open are misses.
+func (c *Cache) Get(ctx context.Context, key string) (io.ReadCloser, Entry, bool) {
+	if !validKey(key) {
+		return nil, Entry{}, false
+	}
+	body, obj, err := c.store.Get(ctx, keyPrefix+key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.forget(key)
+		}
+		return nil, Entry{}, false
+	}
+
+	entry := &Entry{Key: key, Size: obj.Size, Header: obj.Header}
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.size -= elem.Value.(*Entry).Size
+		c.lru.Remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += entry.Size
+	evicted := c.evict()
+	c.mu.Unlock()
+	c.remove(ctx, evicted)
+	return body, *entry, true
+}
+
+// Put copies file into the cache under key, with the headers to replay
+// when it is served, and evicts the least recently used results that no
+// longer fit
+func (c *Cache) Put(ctx context.Context, key, file string, header map[string]string) (Entry, error) {
+	if !validKey(key) {
+		return Entry{}, fmt.Errorf("invalid cache key %q", key)
+	}
+	src, err := os.Open(file)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return Entry{}, err
+	}
+	if info.Size() > c.maxSize {
+		return Entry{}, ErrTooLarge
+	}
+	if err := c.store.Put(ctx, keyPrefix+key, src, info.Size(), header); err != nil {
+		return Entry{}, err
+	}
+
+	entry := &Entry{Key: key, Size: info.Size(), Header: header}
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.size -= elem.Value.(*Entry).Size
+		c.lru.Remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += entry.Size
+	evicted := c.evict()
+	c.mu.Unlock()
+	c.remove(ctx, evicted)
+	return *entry, nil
+}
+
+// StoreKey returns the storage key of the result cached under key
+func StoreKey(key string) string {
+	return keyPrefix + key
+}
+
+// Size returns the bytes and number of results held
+func (c *Cache) Size() (int64, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size, len(c.entries)
+}
+
+// forget drops key from the index, as when another replica evicted it
+func (c *Cache) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.size -= elem.Value.(*Entry).Size
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// evict drops the least recently used results from the index until the
+// cache fits in maxSize and returns their keys, for the caller to remove
+// from the store once it releases mu. The caller holds mu.
+func (c *Cache) evict() []string {
+	var evicted []string
+	for c.size > c.maxSize {
+		elem := c.lru.Back()
+		entry := elem.Value.(*Entry)
+		c.lru.Remove(elem)
+		delete(c.entries, entry.Key)
+		c.size -= entry.Size
+		evicted = append(evicted, entry.Key)
+	}
+	return evicted
+}
+
+// remove deletes evicted results from the store. Failures leave results
+// behind, to be evicted again after a restart.
+func (c *Cache) remove(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		c.store.Delete(context.WithoutCancel(ctx), keyPrefix+key)
+	}
+}
+
+// validKey accepts hex SHA-256 keys as made by Key
+func validKey(key string) bool {
+	digest, err := hex.DecodeString(key)
+	return err == nil && len(digest) == sha256.Size
+}
@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/storage"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewLocal(filepath.Join(dir, "store"), []byte("secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]string{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		keys[name] = strings.Repeat(name, 64)
+	}
+	file := func(size int) string {
+		path := filepath.Join(dir, "result")
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	type op struct {
+		name string
+		do   string // put, get, delete (from the store behind the cache)
+		key  string
+		size int
+		hit  bool // for get
+		err  error
+	}
+	tests := []struct {
+		name string
+		ops  []op
+		keys []string // held afterwards
+		size int64
+	}{
+		{
+			name: "fills up",
+			ops:  []op{{"a", "put", "a", 4, false, nil}, {"b", "put", "b", 4, false, nil}},
+			keys: []string{"a", "b"},
+			size: 8,
+		},
+		{
+			name: "evicts the least recently used",
+			ops: []op{
+				{"a", "put", "a", 4, false, nil},
+				{"b", "put", "b", 4, false, nil},
+				{"use a", "get", "a", 0, true, nil},
+				{"c", "put", "c", 4, false, nil},
+			},
+			keys: []string{"a", "c"},
+			size: 8,
+		},
+		{
+			name: "replaces a key",
+			ops: []op{
+				{"a", "put", "a", 4, false, nil},
+				{"a again", "put", "a", 6, false, nil},
+			},
+			keys: []string{"a"},
+			size: 6,
+		},
+		{
+			name: "too large",
+			ops: []op{
+				{"a", "put", "a", 4, false, nil},
+				{"d", "put", "d", 11, false, ErrTooLarge},
+			},
+			keys: []string{"a"},
+			size: 4,
+		},
+		{
+			name: "forgets on miss",
+			ops: []op{
+				{"a", "put", "a", 4, false, nil},
+				{"b", "put", "b", 4, false, nil},
+				{"evicted elsewhere", "delete", "a", 0, false, nil},
+				{"miss", "get", "a", 0, false, nil},
+			},
+			keys: []string{"b"},
+			size: 4,
+		},
+		{
+			name: "invalid key",
+			ops:  []op{{"get", "get", "../a", 0, false, nil}},
+		},
+	}
+
+	ctx := context.Background()
+	for _, tt := range tests {
+		for _, key := range keys {
+			store.Delete(ctx, StoreKey(key))
+		}
+		c, err := Open(ctx, store, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range tt.ops {
+			key := keys[o.key]
+			if key == "" {
+				key = o.key
+			}
+			switch o.do {
+			case "put":
+				if _, err := c.Put(ctx, key, file(o.size), nil); err != o.err {
+					t.Errorf("%s/%s: Put error = %v, want %v", tt.name, o.name, err, o.err)
+				}
+			case "get":
+				body, _, hit := c.Get(ctx, key)
+				if hit != o.hit {
+					t.Errorf("%s/%s: hit = %v, want %v", tt.name, o.name, hit, o.hit)
+				}
+				if hit {
+					io.Copy(io.Discard, body)
+					body.Close()
+				}
+			case "delete":
+				if err := store.Delete(ctx, StoreKey(key)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		size, n := c.Size()
+		if size != tt.size || n != len(tt.keys) {
+			t.Errorf("%s: Size = %d, %d, want %d, %d", tt.name, size, n, tt.size, len(tt.keys))
+		}
+		for _, name := range tt.keys {
+			if _, ok := c.entries[keys[name]]; !ok {
+				t.Errorf("%s: %s was evicted", tt.name, name)
+			}
+			if _, _, err := store.Get(ctx, StoreKey(keys[name])); err != nil {
+				t.Errorf("%s: %s missing from the store: %v", tt.name, name, err)
+			}
+		}
+	}
+}
+
+func TestOpenEvictsOldest(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewLocal(dir, []byte("secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	old, recent := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	for _, key := range []string{old, recent} {
+		if err := store.Put(ctx, StoreKey(key), strings.NewReader("xxxx"), 4, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, filepath.FromSlash(StoreKey(old))), past, past)
+
+	c, err := Open(ctx, store, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, n := c.Size(); size != 4 || n != 1 {
+		t.Errorf("Size = %d, %d, want 4, 1", size, n)
+	}
+	if _, ok := c.entries[recent]; !ok {
+		t.Error("the most recent result was evicted")
+	}
+	if _, _, err := store.Get(ctx, StoreKey(old)); err == nil {
+		t.Error("the oldest result is still in the store")
+	}
+}
@@ -0,0 +1,417 @@
+// Package config loads the server configuration from defaults, an optional
+// YAML or TOML file, environment variables and command line flags, in
+// increasing order of precedence.
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+// Config holds every server setting
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	TLS       TLSConfig       `yaml:"tls" toml:"tls"`
+	Limits    LimitsConfig    `yaml:"limits" toml:"limits"`
+	Timeouts  TimeoutsConfig  `yaml:"timeouts" toml:"timeouts"`
+	CORS      CORSConfig      `yaml:"cors" toml:"cors"`
+	Workers   WorkersConfig   `yaml:"workers" toml:"workers"`
+	Tools     ToolsConfig     `yaml:"tools" toml:"tools"`
+	Log       LogConfig       `yaml:"log" toml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing" toml:"tracing"`
+	Auth      AuthConfig      `yaml:"auth" toml:"auth"`
+	RateLimit RateLimitConfig `yaml:"rate_limit" toml:"rate_limit"`
+	Cache     CacheConfig     `yaml:"cache" toml:"cache"`
+	Storage   StorageConfig   `yaml:"storage" toml:"storage"`
+}
+
+// ServerConfig holds the listener settings
+type ServerConfig struct {
+	Addr    string `yaml:"addr" toml:"addr"`         // listen address, e.g. ":8000"
+	TempDir string `yaml:"temp_dir" toml:"temp_dir"` // parent of per-request work directories, empty for the system default
+}
+
+// TLSConfig enables HTTPS when both files are set
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+}
+
+// Enabled reports whether the server should serve HTTPS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// LimitsConfig bounds the size of uploads and of decoded input
+type LimitsConfig struct {
+	MaxUploadSize      ByteSize `yaml:"max_upload_size" toml:"max_upload_size"`
+	MaxMergeFiles      int      `yaml:"max_merge_files" toml:"max_merge_files"`
+	MaxSheetImages     int      `yaml:"max_sheet_images" toml:"max_sheet_images"`
+	MaxPixels          int64    `yaml:"max_pixels" toml:"max_pixels"`
+	MaxZipEntries      int      `yaml:"max_zip_entries" toml:"max_zip_entries"`
+	MaxZipUncompressed ByteSize `yaml:"max_zip_uncompressed" toml:"max_zip_uncompressed"`
+	MaxPages           int      `yaml:"max_pages" toml:"max_pages"`
+}
+
+// Converter returns the limits checked by the converters
+func (l LimitsConfig) Converter() converter.Limits {
+	return converter.Limits{
+		MaxPixels:          l.MaxPixels,
+		MaxZipEntries:      l.MaxZipEntries,
+		MaxZipUncompressed: int64(l.MaxZipUncompressed),
+		MaxPages:           l.MaxPages,
+	}
+}
+
+// TimeoutsConfig holds the HTTP server and conversion timeouts
+type TimeoutsConfig struct {
+	Read       time.Duration `yaml:"read" toml:"read"`
+	Write      time.Duration `yaml:"write" toml:"write"`
+	Idle       time.Duration `yaml:"idle" toml:"idle"`
+	Conversion time.Duration `yaml:"conversion" toml:"conversion"` // whole request, from upload to response
+	Command    time.Duration `yaml:"command" toml:"command"`       // each run of an external tool
+	Shutdown   time.Duration `yaml:"shutdown" toml:"shutdown"`     // wait for running requests on SIGINT or SIGTERM
+}
+
+// CORSConfig controls which browser origins may call the API and what they
+// may send and read
+type CORSConfig struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" toml:"allowed_origins"` // exact origins, "*", or patterns like https://*.example.com
+	AllowedMethods   []string      `yaml:"allowed_methods" toml:"allowed_methods"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" toml:"allowed_headers"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" toml:"exposed_headers"` // response headers readable by scripts
+	AllowCredentials bool          `yaml:"allow_credentials" toml:"allow_credentials"`
+	MaxAge           time.Duration `yaml:"max_age" toml:"max_age"` // how long browsers may cache preflight results
+}
+
+// WorkersConfig sizes the conversion worker pool
+type WorkersConfig struct {
+	Conversions   int            `yaml:"conversions" toml:"conversions"`       // conversions run at once; further requests wait
+	PerConversion map[string]int `yaml:"per_conversion" toml:"per_conversion"` // conversions of one type run at once, by converter.Conversion name
+}
+
+// ToolsConfig holds the paths of external programs
+type ToolsConfig struct {
+	Pdftotext string `yaml:"pdftotext" toml:"pdftotext"`
+	Pdftoppm  string `yaml:"pdftoppm" toml:"pdftoppm"`
+}
+
+// Converter returns the tool paths used by the converters
+func (t ToolsConfig) Converter() converter.ToolPaths {
+	return converter.ToolPaths{Pdftotext: t.Pdftotext, Pdftoppm: t.Pdftoppm}
+}
+
+// LogConfig controls the server logs
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`   // debug, info, warn or error
+	Format string `yaml:"format" toml:"format"` // text or json
+}
+
+// SlogLevel returns the minimum level of logged records
+func (l LogConfig) SlogLevel() slog.Level {
+	var level slog.Level
+	level.UnmarshalText([]byte(l.Level))
+	return level
+}
+
+// TracingConfig controls the export of OpenTelemetry spans
+type TracingConfig struct {
+	Enabled     bool    `yaml:"enabled" toml:"enabled"`
+	Endpoint    string  `yaml:"endpoint" toml:"endpoint"` // OTLP over HTTP collector URL
+	ServiceName string  `yaml:"service_name" toml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"` // fraction of new traces recorded
+}
+
+// AuthConfig controls the API keys required by the conversion endpoints
+type AuthConfig struct {
+	Enabled  bool           `yaml:"enabled" toml:"enabled"`
+	KeysFile string         `yaml:"keys_file" toml:"keys_file"` // local key store, read at startup and added to Keys
+	Keys     []APIKeyConfig `yaml:"keys" toml:"keys"`
+}
+
+// APIKeyConfig is one API key with its daily quotas and scopes. The key is
+// given either as is or as the hex SHA-256 of the key, so stores need not
+// hold usable secrets.
+type APIKeyConfig struct {
+	Name             string   `yaml:"name" toml:"name"` // shown in usage reports and logs
+	Key              string   `yaml:"key" toml:"key"`
+	KeySHA256        string   `yaml:"key_sha256" toml:"key_sha256"`
+	DailyBytes       ByteSize `yaml:"daily_bytes" toml:"daily_bytes"`             // uploaded bytes per UTC day, 0 for no limit
+	DailyConversions int      `yaml:"daily_conversions" toml:"daily_conversions"` // successful conversions per UTC day, 0 for no limit
+	Formats          []string `yaml:"formats" toml:"formats"`                     // targets allowed, such as pdf or pdf-*; empty allows all
+}
+
+// RateLimitConfig throttles the conversion requests of each client, named
+// by its API key or else its IP address
+type RateLimitConfig struct {
+	Rate       float64 `yaml:"rate" toml:"rate"`               // requests per second, 0 disables
+	Burst      int     `yaml:"burst" toml:"burst"`             // requests a client may send at once
+	TrustProxy bool    `yaml:"trust_proxy" toml:"trust_proxy"` // take the client IP from the last X-Forwarded-For address
+}
+
+// CacheConfig controls the cache of conversion results
+type CacheConfig struct {
+	Enabled bool     `yaml:"enabled" toml:"enabled"`
+	Dir     string   `yaml:"dir" toml:"dir"` // directory of the local storage backend, empty for reformat-cache under the system temp directory
+	MaxSize ByteSize `yaml:"max_size" toml:"max_size"`
+}
+
+// Path returns the directory of the cache
+func (c CacheConfig) Path() string {
+	if c.Dir != "" {
+		return c.Dir
+	}
+	return filepath.Join(os.TempDir(), "reformat-cache")
+}
+
+// StorageConfig selects where uploads and results are kept and how they
+// are downloaded
+type StorageConfig struct {
+	Backend    string        `yaml:"backend" toml:"backend"`         // local or s3
+	URLExpiry  time.Duration `yaml:"url_expiry" toml:"url_expiry"`   // lifetime of presigned download URLs
+	Retention  time.Duration `yaml:"retention" toml:"retention"`     // how long uploads and uncached results are kept
+	KeepInputs bool          `yaml:"keep_inputs" toml:"keep_inputs"` // keep uploads in storage as well as results
+	SigningKey string        `yaml:"signing_key" toml:"signing_key"` // signs local download URLs, random at startup when empty
+	PublicURL  string        `yaml:"public_url" toml:"public_url"`   // base of local download URLs, empty for the host of the request
+	S3         S3Config      `yaml:"s3" toml:"s3"`
+}
+
+// S3Config locates the bucket of the s3 storage backend
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint" toml:"endpoint"` // e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	Region    string `yaml:"region" toml:"region"`
+	Bucket    string `yaml:"bucket" toml:"bucket"`
+	Prefix    string `yaml:"prefix" toml:"prefix"` // key prefix within the bucket
+	AccessKey string `yaml:"access_key" toml:"access_key"`
+	SecretKey string `yaml:"secret_key" toml:"secret_key"` // empty keys fall back to AWS_ or MINIO_ variables or the instance role
+	PathStyle bool   `yaml:"path_style" toml:"path_style"` // bucket in the path rather than the host name, as MinIO needs
+}
+
+// Default returns the settings used when nothing is configured
+func Default() *Config {
+	limits := converter.DefaultLimits()
+	tools := converter.DefaultToolPaths()
+	return &Config{
+		Server: ServerConfig{Addr: ":8000"},
+		Limits: LimitsConfig{
+			MaxUploadSize:      10 << 20,
+			MaxMergeFiles:      50,
+			MaxSheetImages:     100,
+			MaxPixels:          limits.MaxPixels,
+			MaxZipEntries:      limits.MaxZipEntries,
+			MaxZipUncompressed: ByteSize(limits.MaxZipUncompressed),
+			MaxPages:           limits.MaxPages,
+		},
+		Timeouts: TimeoutsConfig{
+			Read:       10 * time.Second,
+			Write:      30 * time.Second,
+			Idle:       60 * time.Second,
+			Conversion: 30 * time.Second,
+			Command:    converter.DefaultOptions().CommandTimeout,
+			Shutdown:   30 * time.Second,
+		},
+		CORS: CORSConfig{
+			AllowedMethods: []string{"GET", "POST", "OPTIONS"},
+			AllowedHeaders: []string{"Content-Type", "X-Request-ID", "Authorization", "X-API-Key"},
+			ExposedHeaders: []string{"Content-Disposition", "X-Request-ID",
+				"X-Image-Quality", "X-Image-Width", "X-Image-Height", "ETag", "X-Cache"},
+			MaxAge: 10 * time.Minute,
+		},
+		Workers: WorkersConfig{Conversions: runtime.NumCPU()},
+		Tools:   ToolsConfig{Pdftotext: tools.Pdftotext, Pdftoppm: tools.Pdftoppm},
+		Log:     LogConfig{Level: "info", Format: "text"},
+		Tracing: TracingConfig{
+			Endpoint:    "http://localhost:4318",
+			ServiceName: "reformat",
+			SampleRatio: 1,
+		},
+		RateLimit: RateLimitConfig{Burst: 10},
+		Cache:     CacheConfig{MaxSize: 1 << 30},
+		Storage:   StorageConfig{Backend: "local", URLExpiry: 15 * time.Minute, Retention: 24 * time.Hour},
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr must not be empty")
+	if c.Server.TempDir != "" {
+		info, err := os.Stat(c.Server.TempDir)
+		check(err == nil && info.IsDir(), "server.temp_dir %q is not a directory", c.Server.TempDir)
+	}
+
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.cert_file and tls.key_file must be set together")
+	for _, file := range []string{c.TLS.CertFile, c.TLS.KeyFile} {
+		if file != "" {
+			_, err := os.Stat(file)
+			check(err == nil, "tls file %q cannot be read", file)
+		}
+	}
+
+	check(c.Limits.MaxUploadSize > 0, "limits.max_upload_size must be positive")
+	check(c.Limits.MaxMergeFiles >= 2, "limits.max_merge_files must be at least 2")
+	check(c.Limits.MaxSheetImages >= 1, "limits.max_sheet_images must be at least 1")
+	check(c.Limits.MaxPixels >= 0, "limits.max_pixels must not be negative")
+	check(c.Limits.MaxZipEntries >= 0, "limits.max_zip_entries must not be negative")
+	check(c.Limits.MaxZipUncompressed >= 0, "limits.max_zip_uncompressed must not be negative")
+	check(c.Limits.MaxPages >= 0, "limits.max_pages must not be negative")
+
+	check(c.Timeouts.Read > 0, "timeouts.read must be positive")
+	check(c.Timeouts.Write > 0, "timeouts.write must be positive")
+	check(c.Timeouts.Idle >= 0, "timeouts.idle must not be negative")
+	check(c.Timeouts.Conversion > 0 && c.Timeouts.Conversion <= c.Timeouts.Write,
+		"timeouts.conversion must be positive and at most timeouts.write")
+	check(c.Timeouts.Command >= 0, "timeouts.command must not be negative")
+	check(c.Timeouts.Shutdown >= 0, "timeouts.shutdown must not be negative")
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		check(validOrigin(origin), "cors.allowed_origins: %q is not an origin such as https://example.com", origin)
+		check(origin != "*" || !c.CORS.AllowCredentials,
+			"cors.allow_credentials cannot be combined with the * origin; list the origins instead")
+	}
+	check(len(c.CORS.AllowedMethods) > 0, "cors.allowed_methods must not be empty")
+	check(c.CORS.MaxAge >= 0, "cors.max_age must not be negative")
+
+	check(c.Workers.Conversions >= 1, "workers.conversions must be at least 1")
+	for name, n := range c.Workers.PerConversion {
+		check(knownConversion(name), "workers.per_conversion: unknown conversion %q", name)
+		check(n >= 1, "workers.per_conversion: %s must be at least 1", name)
+	}
+
+	check(c.Tools.Pdftotext != "", "tools.pdftotext must not be empty")
+	check(c.Tools.Pdftoppm != "", "tools.pdftoppm must not be empty")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level must be debug, info, warn or error")
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format must be text or json")
+
+	if c.Tracing.Enabled {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"tracing.endpoint must be an http or https URL such as http://localhost:4318")
+		check(c.Tracing.ServiceName != "", "tracing.service_name must not be empty")
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio must be between 0 and 1")
+
+	check(!c.Auth.Enabled || len(c.Auth.Keys) > 0, "auth.keys must not be empty when auth is enabled")
+	names := map[string]bool{}
+	for i, key := range c.Auth.Keys {
+		check(key.Name != "", "auth.keys[%d].name must not be empty", i)
+		check(!names[key.Name], "auth.keys: name %q is used twice", key.Name)
+		names[key.Name] = true
+		check((key.Key == "") != (key.KeySHA256 == ""), "auth.keys %q: set exactly one of key and key_sha256", key.Name)
+		if key.KeySHA256 != "" {
+			digest, err := hex.DecodeString(key.KeySHA256)
+			check(err == nil && len(digest) == sha256.Size, "auth.keys %q: key_sha256 must be 64 hex digits", key.Name)
+		}
+		check(key.DailyBytes >= 0, "auth.keys %q: daily_bytes must not be negative", key.Name)
+		check(key.DailyConversions >= 0, "auth.keys %q: daily_conversions must not be negative", key.Name)
+		for _, format := range key.Formats {
+			_, err := path.Match(format, "")
+			check(err == nil && format != "", "auth.keys %q: %q is not a format or pattern", key.Name, format)
+		}
+	}
+
+	check(c.RateLimit.Rate >= 0, "rate_limit.rate must not be negative")
+	check(c.RateLimit.Rate == 0 || c.RateLimit.Burst >= 1, "rate_limit.burst must be at least 1")
+
+	check(c.Cache.MaxSize > 0, "cache.max_size must be positive")
+
+	check(c.Storage.Backend == "local" || c.Storage.Backend == "s3", "storage.backend must be local or s3")
+	// S3 refuses presigned URLs valid for longer than a week
+	check(c.Storage.URLExpiry > 0 && c.Storage.URLExpiry <= 7*24*time.Hour,
+		"storage.url_expiry must be positive and at most 168h")
+	check(c.Storage.Retention >= c.Storage.URLExpiry, "storage.retention must be at least storage.url_expiry")
+	if c.Storage.PublicURL != "" {
+		u, err := url.Parse(c.Storage.PublicURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"storage.public_url must be an http or https URL")
+	}
+	if c.Storage.Backend == "s3" {
+		u, err := url.Parse(c.Storage.S3.Endpoint)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && strings.Trim(u.Path, "/") == "",
+			"storage.s3.endpoint must be an http or https URL without a path, such as http://localhost:9000")
+		check(c.Storage.S3.Bucket != "", "storage.s3.bucket must not be empty")
+		check((c.Storage.S3.AccessKey == "") == (c.Storage.S3.SecretKey == ""),
+			"storage.s3.access_key and storage.s3.secret_key must be set together")
+	}
+
+	return errors.Join(errs...)
+}
+
+// knownConversion reports whether name is a converter.Conversion name
+func knownConversion(name string) bool {
+	for _, conversion := range converter.Conversions {
+		if conversion.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validOrigin accepts "*" and scheme://host[:port] origins, where the host
+// may start with a "*." wildcard label
+func validOrigin(origin string) bool {
+	if origin == "*" {
+		return true
+	}
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://wildcard.", 1))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.Path == "" && u.RawQuery == "" && u.Fragment == "" && u.User == nil &&
+		!strings.Contains(u.Host, "*")
+}
+
+// ByteSize is a size in bytes that also parses values like "10MB"
+type ByteSize int64
+
+// UnmarshalText implements encoding.TextUnmarshaler for config files
+func (s *ByteSize) UnmarshalText(text []byte) error {
+	size, err := ParseByteSize(string(text))
+	if err != nil {
+		return err
+	}
+	*s = ByteSize(size)
+	return nil
+}
+
+// ParseByteSize parses sizes like "200000", "200KB", "1.5MB" or "2GB"
+func ParseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := 1.0
+	for _, unit := range []struct {
+		suffix string
+		scale  float64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1}} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || !(n >= 0) || n*multiplier >= math.MaxInt64 {
+		return 0, fmt.Errorf("expected a size such as 200KB")
+	}
+	return int64(n * multiplier), nil
+}
@@ -0,0 +1,305 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		ok    bool
+	}{
+		{"200000", 200000, true},
+		{"200KB", 200 << 10, true},
+		{"200kb", 200 << 10, true},
+		{"1.5MB", 3 << 19, true},
+		{" 2 GB ", 2 << 30, true},
+		{"10M", 10 << 20, true},
+		{"512B", 512, true},
+		{"0", 0, true},
+		{"", 0, false},
+		{"MB", 0, false},
+		{"-1KB", 0, false},
+		{"ten", 0, false},
+		{"10TB", 0, false},
+		{"NaN", 0, false},
+		{"Inf", 0, false},
+		{"1e30GB", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.value)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d, ok %v", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string // part of the error, empty for valid
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"empty addr", func(c *Config) { c.Server.Addr = "" }, "server.addr"},
+		{"missing temp dir", func(c *Config) { c.Server.TempDir = "/nonexistent/reformat" }, "server.temp_dir"},
+		{"tls cert without key", func(c *Config) { c.TLS.CertFile = "cert.pem" }, "set together"},
+		{"no upload size", func(c *Config) { c.Limits.MaxUploadSize = 0 }, "limits.max_upload_size"},
+		{"merge of one", func(c *Config) { c.Limits.MaxMergeFiles = 1 }, "limits.max_merge_files"},
+		{"pixels disabled", func(c *Config) { c.Limits.MaxPixels = 0 }, ""},
+		{"negative pages", func(c *Config) { c.Limits.MaxPages = -1 }, "limits.max_pages"},
+		{"conversion past write", func(c *Config) { c.Timeouts.Conversion = c.Timeouts.Write + time.Second }, "timeouts.conversion"},
+		{"no conversion timeout", func(c *Config) { c.Timeouts.Conversion = 0 }, "timeouts.conversion"},
+		{"origin pattern", func(c *Config) { c.CORS.AllowedOrigins = []string{"https://*.example.com"} }, ""},
+		{"origin with path", func(c *Config) { c.CORS.AllowedOrigins = []string{"https://example.com/app"} }, "cors.allowed_origins"},
+		{"wildcard inside host", func(c *Config) { c.CORS.AllowedOrigins = []string{"https://app.*.example.com"} }, "cors.allowed_origins"},
+		{"credentials with *", func(c *Config) {
+			c.CORS.AllowedOrigins = []string{"*"}
+			c.CORS.AllowCredentials = true
+		}, "cors.allow_credentials"},
+		{"no workers", func(c *Config) { c.Workers.Conversions = 0 }, "workers.conversions"},
+		{"unknown conversion", func(c *Config) { c.Workers.PerConversion = map[string]int{"docx-to-png": 1} }, "unknown conversion"},
+		{"bad log level", func(c *Config) { c.Log.Level = "verbose" }, "log.level"},
+		{"bad log format", func(c *Config) { c.Log.Format = "xml" }, "log.format"},
+		{"tracing endpoint", func(c *Config) {
+			c.Tracing.Enabled = true
+			c.Tracing.Endpoint = "localhost:4318"
+		}, "tracing.endpoint"},
+		{"sample ratio", func(c *Config) { c.Tracing.SampleRatio = 1.5 }, "tracing.sample_ratio"},
+		{"auth without keys", func(c *Config) { c.Auth.Enabled = true }, "auth.keys must not be empty"},
+		{"duplicate key names", func(c *Config) {
+			c.Auth.Keys = []APIKeyConfig{{Name: "a", Key: "1"}, {Name: "a", Key: "2"}}
+		}, "used twice"},
+		{"key and hash", func(c *Config) {
+			c.Auth.Keys = []APIKeyConfig{{Name: "a", Key: "1", KeySHA256: strings.Repeat("0", 64)}}
+		}, "exactly one"},
+		{"short hash", func(c *Config) { c.Auth.Keys = []APIKeyConfig{{Name: "a", KeySHA256: "abcd"}} }, "64 hex digits"},
+		{"bad format pattern", func(c *Config) { c.Auth.Keys = []APIKeyConfig{{Name: "a", Key: "1", Formats: []string{"pdf-["}}} }, "not a format"},
+		{"rate without burst", func(c *Config) {
+			c.RateLimit.Rate = 1
+			c.RateLimit.Burst = 0
+		}, "rate_limit.burst"},
+		{"unknown backend", func(c *Config) { c.Storage.Backend = "ftp" }, "storage.backend"},
+		{"url expiry past a week", func(c *Config) { c.Storage.URLExpiry = 8 * 24 * time.Hour }, "storage.url_expiry"},
+		{"retention shorter than urls", func(c *Config) { c.Storage.Retention = time.Minute }, "storage.retention"},
+		{"s3 without bucket", func(c *Config) {
+			c.Storage.Backend = "s3"
+			c.Storage.S3.Endpoint = "http://localhost:9000"
+		}, "storage.s3.bucket"},
+		{"s3 endpoint with path", func(c *Config) {
+			c.Storage.Backend = "s3"
+			c.Storage.S3.Endpoint = "http://localhost:9000/bucket"
+			c.Storage.S3.Bucket = "b"
+		}, "storage.s3.endpoint"},
+	}
+	for _, tt := range tests {
+		c := Default()
+		tt.change(c)
+		err := c.Validate()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: error = %v, want one about %s", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	c := Default()
+	c.Server.Addr = ""
+	c.Workers.Conversions = 0
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "server.addr") || !strings.Contains(err.Error(), "workers.conversions") {
+		t.Errorf("error = %v, want both settings reported", err)
+	}
+}
+
+// writeFile writes content to name in a new temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	yamlFile := writeFile(t, "reformat.yaml", `
+server:
+  addr: ":9000"
+limits:
+  max_upload_size: 20MB
+  max_pixels: 1000
+timeouts:
+  conversion: 20s
+cors:
+  allowed_origins: ["https://a.example.com", "https://*.example.org"]
+workers:
+  per_conversion:
+    docx-to-pdf: 2
+auth:
+  keys:
+    - name: ci
+      key: secret
+      daily_bytes: 1GB
+      formats: [pdf]
+`)
+	tomlFile := writeFile(t, "reformat.toml", `
+[server]
+addr = ":9000"
+
+[limits]
+max_upload_size = "20MB"
+max_pixels = 1000
+
+[timeouts]
+conversion = "20s"
+
+[cors]
+allowed_origins = ["https://a.example.com", "https://*.example.org"]
+
+[workers.per_conversion]
+docx-to-pdf = 2
+
+[[auth.keys]]
+name = "ci"
+key = "secret"
+daily_bytes = "1GB"
+formats = ["pdf"]
+`)
+
+	want := Default()
+	want.Server.Addr = ":9000"
+	want.Limits.MaxUploadSize = 20 << 20
+	want.Limits.MaxPixels = 1000
+	want.Timeouts.Conversion = 20 * time.Second
+	want.CORS.AllowedOrigins = []string{"https://a.example.com", "https://*.example.org"}
+	want.Workers.PerConversion = map[string]int{"docx-to-pdf": 2}
+	want.Auth.Keys = []APIKeyConfig{{Name: "ci", Key: "secret", DailyBytes: 1 << 30, Formats: []string{"pdf"}}}
+
+	for _, file := range []string{yamlFile, tomlFile} {
+		c := Default()
+		if err := loadFile(c, file); err != nil {
+			t.Errorf("%s: %v", filepath.Ext(file), err)
+			continue
+		}
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("%s: loaded %+v, want %+v", filepath.Ext(file), c, want)
+		}
+	}
+
+	for name, content := range map[string]string{
+		"typo.yaml":  "server:\n  adr: \":9000\"\n",
+		"typo.toml":  "[server]\nadr = \":9000\"\n",
+		"size.yaml":  "limits:\n  max_upload_size: lots\n",
+		"broken.yml": "server: [\n",
+		"conf.json":  "{}",
+	} {
+		if err := loadFile(Default(), writeFile(t, name, content)); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "reformat.yaml", `
+server:
+  addr: ":7000"
+limits:
+  max_merge_files: 10
+  max_sheet_images: 20
+log:
+  level: warn
+`)
+	t.Setenv(envPrefix+"CONFIG", file)
+	t.Setenv(envPrefix+"MAX_MERGE_FILES", "11")
+	t.Setenv(envPrefix+"MAX_SHEET_IMAGES", "21")
+	t.Setenv(envPrefix+"CORS_ALLOW_CREDENTIALS", "true")
+	t.Setenv("CLIENT_URL", "https://legacy.example.com")
+
+	c, err := Load([]string{"-max-sheet-images", "22", "-max-upload-size", "5MB", "-tracing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		got, want any
+	}{
+		{"default", c.Timeouts.Write, 30 * time.Second},
+		{"file", c.Server.Addr, ":7000"},
+		{"file", c.Log.Level, "warn"},
+		{"env over file", c.Limits.MaxMergeFiles, 11},
+		{"flag over env", c.Limits.MaxSheetImages, 22},
+		{"flag over default", c.Limits.MaxUploadSize, ByteSize(5 << 20)},
+		{"bool flag without value", c.Tracing.Enabled, true},
+		{"bool env", c.CORS.AllowCredentials, true},
+		{"CLIENT_URL", c.CORS.AllowedOrigins, []string{"https://legacy.example.com"}},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	t.Setenv(envPrefix+"ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	if c, err = Load(nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"https://a.example.com", "https://b.example.com"}; !reflect.DeepEqual(c.CORS.AllowedOrigins, want) {
+		t.Errorf("origins = %q, want the variable over CLIENT_URL %q", c.CORS.AllowedOrigins, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Setenv(envPrefix+"CONFIG", "")
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{"bad env", map[string]string{envPrefix + "WORKERS": "many"}, nil, envPrefix + "WORKERS"},
+		{"bad flag", nil, []string{"-conversion-timeout", "soon"}, "-conversion-timeout"},
+		{"bad pairs", nil, []string{"-conversion-workers", "docx-to-pdf"}, "name=number"},
+		{"invalid result", nil, []string{"-workers", "0"}, "workers.conversions"},
+		{"missing file", nil, []string{"-config", "/nonexistent/reformat.yaml"}, "error reading"},
+	}
+	for _, tt := range tests {
+		for name, value := range tt.env {
+			t.Setenv(name, value)
+		}
+		_, err := Load(tt.args)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want one about %s", tt.name, err, tt.want)
+		}
+		for name := range tt.env {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestLoadKeysFile(t *testing.T) {
+	t.Setenv(envPrefix+"CONFIG", "")
+	keys := writeFile(t, "keys.toml", `
+[[keys]]
+name = "partner"
+key_sha256 = "`+strings.Repeat("ab", 32)+`"
+daily_conversions = 100
+`)
+	c, err := Load([]string{"-auth", "-api-keys-file", keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []APIKeyConfig{{Name: "partner", KeySHA256: strings.Repeat("ab", 32), DailyConversions: 100}}
+	if !reflect.DeepEqual(c.Auth.Keys, want) {
+		t.Errorf("keys = %+v, want %+v", c.Auth.Keys, want)
+	}
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix of the environment variable for each setting
+const envPrefix = "REFORMAT_"
+
+// binding ties a setting to its flag and environment variable. The variable
+// is envPrefix plus the flag name in upper case with dashes as underscores.
+type binding struct {
+	name   string
+	usage  string
+	set    func(c *Config, value string) error
+	isBool bool // the flag may be given without a value
+}
+
+func (b binding) env() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(b.name, "-", "_"))
+}
+
+// Settings that can be given as flags and environment variables
+var bindings = []binding{
+	stringSetting("addr", "listen address", func(c *Config) *string { return &c.Server.Addr }),
+	stringSetting("temp-dir", "parent directory of temporary files", func(c *Config) *string { return &c.Server.TempDir }),
+	stringSetting("tls-cert", "TLS certificate file", func(c *Config) *string { return &c.TLS.CertFile }),
+	stringSetting("tls-key", "TLS private key file", func(c *Config) *string { return &c.TLS.KeyFile }),
+
+	sizeSetting("max-upload-size", "largest accepted upload, e.g. 10MB", func(c *Config) *ByteSize { return &c.Limits.MaxUploadSize }),
+	intSetting("max-merge-files", "most PDFs in one merge", func(c *Config) *int { return &c.Limits.MaxMergeFiles }),
+	intSetting("max-sheet-images", "most images on one contact sheet", func(c *Config) *int { return &c.Limits.MaxSheetImages }),
+	int64Setting("max-pixels", "most pixels in a decoded image, 0 disables", func(c *Config) *int64 { return &c.Limits.MaxPixels }),
+	intSetting("max-zip-entries", "most files in a DOCX archive, 0 disables", func(c *Config) *int { return &c.Limits.MaxZipEntries }),
+	sizeSetting("max-zip-uncompressed", "largest uncompressed DOCX archive, 0 disables", func(c *Config) *ByteSize { return &c.Limits.MaxZipUncompressed }),
+	intSetting("max-pages", "most pages in PDF input, 0 disables", func(c *Config) *int { return &c.Limits.MaxPages }),
+
+	durationSetting("read-timeout", "HTTP read timeout", func(c *Config) *time.Duration { return &c.Timeouts.Read }),
+	durationSetting("write-timeout", "HTTP write timeout", func(c *Config) *time.Duration { return &c.Timeouts.Write }),
+	durationSetting("idle-timeout", "HTTP keep-alive idle timeout", func(c *Config) *time.Duration { return &c.Timeouts.Idle }),
+	durationSetting("conversion-timeout", "time allowed for one conversion request", func(c *Config) *time.Duration { return &c.Timeouts.Conversion }),
+	durationSetting("command-timeout", "time allowed for one external tool run, 0 disables", func(c *Config) *time.Duration { return &c.Timeouts.Command }),
+	durationSetting("shutdown-timeout", "time running requests get to finish on shutdown", func(c *Config) *time.Duration { return &c.Timeouts.Shutdown }),
+
+	listSetting("allowed-origins", "comma separated CORS origins, * or patterns like https://*.example.com", func(c *Config) *[]string { return &c.CORS.AllowedOrigins }),
+	listSetting("cors-allowed-methods", "comma separated methods allowed by CORS", func(c *Config) *[]string { return &c.CORS.AllowedMethods }),
+	listSetting("cors-allowed-headers", "comma separated request headers allowed by CORS", func(c *Config) *[]string { return &c.CORS.AllowedHeaders }),
+	listSetting("cors-exposed-headers", "comma separated response headers readable by scripts", func(c *Config) *[]string { return &c.CORS.ExposedHeaders }),
+	boolSetting("cors-allow-credentials", "allow cookies and authorization headers on CORS requests", func(c *Config) *bool { return &c.CORS.AllowCredentials }),
+	durationSetting("cors-max-age", "how long browsers may cache preflight results", func(c *Config) *time.Duration { return &c.CORS.MaxAge }),
+
+	intSetting("workers", "conversions run at once", func(c *Config) *int { return &c.Workers.Conversions }),
+	intMapSetting("conversion-workers", "comma separated caps on conversions of one type run at once, e.g. docx-to-pdf=2", func(c *Config) *map[string]int { return &c.Workers.PerConversion }),
+
+	stringSetting("pdftotext", "path of the pdftotext program", func(c *Config) *string { return &c.Tools.Pdftotext }),
+	stringSetting("pdftoppm", "path of the pdftoppm program", func(c *Config) *string { return &c.Tools.Pdftoppm }),
+
+	stringSetting("log-level", "debug, info, warn or error", func(c *Config) *string { return &c.Log.Level }),
+	stringSetting("log-format", "text or json", func(c *Config) *string { return &c.Log.Format }),
+
+	boolSetting("tracing", "export OpenTelemetry spans over OTLP", func(c *Config) *bool { return &c.Tracing.Enabled }),
+	stringSetting("otlp-endpoint", "OTLP over HTTP collector URL", func(c *Config) *string { return &c.Tracing.Endpoint }),
+	stringSetting("service-name", "service name reported in traces", func(c *Config) *string { return &c.Tracing.ServiceName }),
+	floatSetting("trace-sample-ratio", "fraction of new traces recorded, 0 to 1", func(c *Config) *float64 { return &c.Tracing.SampleRatio }),
+
+	boolSetting("auth", "require an API key on conversion endpoints", func(c *Config) *bool { return &c.Auth.Enabled }),
+	stringSetting("api-keys-file", "YAML or TOML file of API keys", func(c *Config) *string { return &c.Auth.KeysFile }),
+
+	floatSetting("rate-limit", "conversion requests per second per client, 0 disables", func(c *Config) *float64 { return &c.RateLimit.Rate }),
+	intSetting("rate-limit-burst", "conversion requests a client may send at once", func(c *Config) *int { return &c.RateLimit.Burst }),
+	boolSetting("trust-proxy", "take client IPs from X-Forwarded-For", func(c *Config) *bool { return &c.RateLimit.TrustProxy }),
+
+	boolSetting("cache", "cache conversion results on disk", func(c *Config) *bool { return &c.Cache.Enabled }),
+	stringSetting("cache-dir", "directory of the local storage backend", func(c *Config) *string { return &c.Cache.Dir }),
+	sizeSetting("cache-max-size", "largest total size of cached results, e.g. 1GB", func(c *Config) *ByteSize { return &c.Cache.MaxSize }),
+
+	stringSetting("storage", "where uploads and results are kept: local or s3", func(c *Config) *string { return &c.Storage.Backend }),
+	durationSetting("download-url-expiry", "lifetime of presigned download URLs", func(c *Config) *time.Duration { return &c.Storage.URLExpiry }),
+	durationSetting("storage-retention", "how long uploads and uncached results are kept in storage", func(c *Config) *time.Duration { return &c.Storage.Retention }),
+	boolSetting("keep-inputs", "keep uploads in storage as well as results", func(c *Config) *bool { return &c.Storage.KeepInputs }),
+	stringSetting("download-signing-key", "key signing local download URLs, random when empty", func(c *Config) *string { return &c.Storage.SigningKey }),
+	stringSetting("public-url", "base URL of local download URLs", func(c *Config) *string { return &c.Storage.PublicURL }),
+	stringSetting("s3-endpoint", "S3 service URL, e.g. http://localhost:9000", func(c *Config) *string { return &c.Storage.S3.Endpoint }),
+	stringSetting("s3-region", "S3 region", func(c *Config) *string { return &c.Storage.S3.Region }),
+	stringSetting("s3-bucket", "S3 bucket", func(c *Config) *string { return &c.Storage.S3.Bucket }),
+	stringSetting("s3-prefix", "key prefix within the S3 bucket", func(c *Config) *string { return &c.Storage.S3.Prefix }),
+	stringSetting("s3-access-key", "S3 access key", func(c *Config) *string { return &c.Storage.S3.AccessKey }),
+	stringSetting("s3-secret-key", "S3 secret key", func(c *Config) *string { return &c.Storage.S3.SecretKey }),
+	boolSetting("s3-path-style", "address the bucket in the path, as MinIO needs", func(c *Config) *bool { return &c.Storage.S3.PathStyle }),
+}
+
+// Load builds the configuration from command line arguments (without the
+// program name), the environment and the file named by -config or
+// REFORMAT_CONFIG. A .env file in the working directory is loaded into the
+// environment when present.
+func Load(args []string) (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("error loading .env file: %w", err)
+	}
+
+	flags := flag.NewFlagSet("reformat", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv(envPrefix+"CONFIG"),
+		"YAML or TOML config file (env "+envPrefix+"CONFIG)")
+	given := map[string]string{}
+	for _, b := range bindings {
+		name := b.name
+		record := func(value string) error {
+			given[name] = value
+			return nil
+		}
+		usage := fmt.Sprintf("%s (env %s)", b.usage, b.env())
+		if b.isBool {
+			flags.BoolFunc(name, usage, record)
+		} else {
+			flags.Func(name, usage, record)
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *configFile != "" {
+		if err := loadFile(cfg, *configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// CLIENT_URL predates the config package and is kept for existing setups
+	if origin := os.Getenv("CLIENT_URL"); origin != "" {
+		cfg.CORS.AllowedOrigins = []string{origin}
+	}
+
+	for _, b := range bindings {
+		if value, ok := os.LookupEnv(b.env()); ok {
+			if err := b.set(cfg, value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", b.env(), err)
+			}
+		}
+	}
+	for _, b := range bindings {
+		if value, ok := given[b.name]; ok {
+			if err := b.set(cfg, value); err != nil {
+				return nil, fmt.Errorf("invalid -%s: %w", b.name, err)
+			}
+		}
+	}
+
+	if cfg.Auth.KeysFile != "" {
+		if err := loadKeysFile(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// loadFile decodes a YAML or TOML file, chosen by extension, over v.
+// Unknown keys are rejected so typos don't pass silently.
+func loadFile(v any, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("error parsing %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), v)
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("error parsing %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("file %s must end in .yaml, .yml or .toml", path)
+	}
+	return nil
+}
+
+// loadKeysFile appends the API keys of the local key store to the keys of
+// the configuration. The store holds a keys list laid out like auth.keys.
+func loadKeysFile(cfg *Config) error {
+	var store struct {
+		Keys []APIKeyConfig `yaml:"keys" toml:"keys"`
+	}
+	if err := loadFile(&store, cfg.Auth.KeysFile); err != nil {
+		return err
+	}
+	cfg.Auth.Keys = append(cfg.Auth.Keys, store.Keys...)
+	return nil
+}
+
+func stringSetting(name, usage string, field func(*Config) *string) binding {
+	return binding{name: name, usage: usage, set: func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}}
+}
+
+func intSetting(name, usage string, field func(*Config) *int) binding {
+	return binding{name: name, usage: usage, set: func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected an integer")
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func int64Setting(name, usage string, field func(*Config) *int64) binding {
+	return binding{name: name, usage: usage, set: func(c *Config, value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected an integer")
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func floatSetting(name, usage string, field func(*Config) *float64) binding {
+	return binding{name: name, usage: usage, set: func(c *Config, value string) error {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number")
+		}
+		*field(c) = n
+		return nil
+	}}
+}
+
+func sizeSetting(name, usage string, field func(*Config) *ByteSize) binding {
+	return binding{name: name, usage: usage, set: func(c *Config, value string) error {
+		return field(c).UnmarshalText([]byte(value))
+	}}
+}
+
+func boolSetting(name, usage string, field func(*Config) *bool) binding {
+	return binding{name: name, usage: usage, isBool: true, set: func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false")
+		}
+		*field(c) = b
+		return nil
+	}}
+}
+
+func durationSetting(name, usage string, field func(*Config) *time.Duration) binding {
+	return binding{name: name, usage: usage, set: func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("expected a duration such as 30s")
+		}
+		*field(c) = d
+		return nil
+	}}
+}
+
+func listSetting(name, usage string, field func(*Config) *[]string) binding {
+	return binding{name: name, usage: usage, set: func(c *Config, value string) error {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}}
+}
+
+func intMapSetting(name, usage string, field func(*Config) *map[string]int) binding {
+	return binding{name: name, usage: usage, set: func(c *Config, value string) error {
+		m := map[string]int{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			key, count, ok := strings.Cut(item, "=")
+			n, err := strconv.Atoi(strings.TrimSpace(count))
+			if !ok || err != nil {
+				return fmt.Errorf("expected name=number pairs such as docx-to-pdf=2")
+			}
+			m[strings.TrimSpace(key)] = n
+		}
+		*field(c) = m
+		return nil
+	}}
+}
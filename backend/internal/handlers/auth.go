@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/auth"
+)
+
+// Header carrying the API key, as an alternative to a bearer token
+const apiKeyHeader = "X-API-Key"
+
+// Codes for rejected API keys
+const (
+	codeUnauthorized  = "unauthorized"
+	codeForbidden     = "forbidden"
+	codeQuotaExceeded = "quota_exceeded"
+)
+
+// keyring holds the configured API keys and their usage, set by Configure
+var keyring = auth.NewKeyring(nil)
+
+type apiKeyKey struct{}
+
+// Authenticate requires a known API key on conversion requests when auth is
+// enabled, and counts successful conversions and their uploaded bytes
+// against the daily quotas of the key. Requests over a quota fail with 429
+// until the quota resets at midnight UTC.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.Auth.Enabled || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		key, ok := requireKey(w, r)
+		if !ok {
+			return
+		}
+
+		size := max(r.ContentLength, 0)
+		if r.ContentLength < 0 && key.DailyBytes > 0 {
+			// A body of unknown length holds the largest upload and may not
+			// send more, so parallel chunked uploads cannot overrun the
+			// quota. The usage is settled to the bytes actually read.
+			size = int64(cfg.Limits.MaxUploadSize)
+			r.Body = http.MaxBytesReader(w, r.Body, size)
+		}
+		release, err := keyring.Reserve(key, size)
+		if err != nil {
+			usage := keyring.Usage(key)
+			w.Header().Set("Retry-After", retryAfter(usage.Reset()))
+			writeError(w, r, http.StatusTooManyRequests, codeQuotaExceeded,
+				fmt.Sprintf("API key %s: %v, resets at %s", key.Name, err, usage.Reset().Format(time.RFC3339)))
+			return
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		cw := &countingWriter{ResponseWriter: w}
+		r = r.WithContext(context.WithValue(r.Context(), apiKeyKey{}, key))
+
+		// The usage is settled even when the handler panics or the
+		// client goes away
+		defer func() {
+			release(body.n, cw.status != 0 && cw.status < http.StatusBadRequest)
+		}()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// requireKey returns the API key of r, or responds with 401 and returns
+// false when the key is missing or unknown
+func requireKey(w http.ResponseWriter, r *http.Request) (*auth.Key, bool) {
+	secret := r.Header.Get(apiKeyHeader)
+	if scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " "); secret == "" && found &&
+		strings.EqualFold(scheme, "Bearer") {
+		secret = strings.TrimSpace(token)
+	}
+	if secret == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="reformat"`)
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized,
+			"API key required in the "+apiKeyHeader+" header or as a bearer token")
+		return nil, false
+	}
+	key, ok := keyring.Lookup(secret)
+	if !ok {
+		logger(r).Warn("Unknown API key", "remote_addr", r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="reformat", error="invalid_token"`)
+		writeError(w, r, http.StatusUnauthorized, codeUnauthorized, "Unknown API key")
+		return nil, false
+	}
+	return key, true
+}
+
+// allowTarget responds with 403 and returns false when the API key of r is
+// not scoped for target, the label given to labelConversion
+func allowTarget(w http.ResponseWriter, r *http.Request, target string) bool {
+	key, ok := r.Context().Value(apiKeyKey{}).(*auth.Key)
+	if !ok || key.Allows(target) {
+		return true
+	}
+	writeError(w, r, http.StatusForbidden, codeForbidden,
+		fmt.Sprintf("API key %s may not convert to %s", key.Name, target))
+	return false
+}
+
+// retryAfter is the Retry-After value for a retry at t, in whole seconds
+func retryAfter(t time.Time) string {
+	return strconv.Itoa(int(math.Ceil(time.Until(t).Seconds())))
+}
+
+// quotaStatus is the use of one daily quota
+type quotaStatus struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit"` // 0 for no limit
+}
+
+// usageResponse is the JSON body of GET /api/usage
+type usageResponse struct {
+	Key         string      `json:"key"`
+	Day         string      `json:"day"`
+	ResetAt     time.Time   `json:"reset_at"`
+	Conversions quotaStatus `json:"conversions"`
+	Bytes       quotaStatus `json:"bytes"`
+	Formats     []string    `json:"formats"` // empty when every target is allowed
+}
+
+// Usage reports the daily usage and quotas of the API key of the request.
+// It works with a key whose quotas are used up.
+func Usage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if !cfg.Auth.Enabled {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "API keys are not enabled")
+		return
+	}
+	key, ok := requireKey(w, r)
+	if !ok {
+		return
+	}
+
+	usage := keyring.Usage(key)
+	formats := key.Formats
+	if formats == nil {
+		formats = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(usageResponse{
+		Key:         key.Name,
+		Day:         usage.Day.Format(time.DateOnly),
+		ResetAt:     usage.Reset(),
+		Conversions: quotaStatus{Used: int64(usage.Conversions), Limit: int64(key.DailyConversions)},
+		Bytes:       quotaStatus{Used: usage.Bytes, Limit: key.DailyBytes},
+		Formats:     formats,
+	})
+}
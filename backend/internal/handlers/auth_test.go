@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+)
+
+func TestAuthenticateReservesChunkedUploads(t *testing.T) {
+	saved := cfg
+	defer Configure(saved)
+	c := config.Default()
+	c.Auth.Enabled = true
+	c.Auth.Keys = []config.APIKeyConfig{{Name: "test", Key: "secret", DailyBytes: 100}}
+	c.Limits.MaxUploadSize = 60
+	Configure(c)
+
+	chunked := func(body string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/convert", strings.NewReader(body))
+		r.ContentLength = -1
+		r.Header.Set(apiKeyHeader, "secret")
+		return r
+	}
+
+	var nested int
+	handler := Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if nested == 0 {
+			// A second chunked upload while the first holds 60 bytes
+			nested = -1
+			rec := httptest.NewRecorder()
+			Authenticate(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rec, chunked("x"))
+			nested = rec.Code
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, chunked(strings.Repeat("x", 10)))
+	if rec.Code != http.StatusOK || nested != http.StatusTooManyRequests {
+		t.Errorf("statuses = %d and nested %d, want 200 and 429", rec.Code, nested)
+	}
+	key, _ := keyring.Lookup("secret")
+	if usage := keyring.Usage(key); usage.Bytes != 10 {
+		t.Errorf("used bytes = %d, want the 10 actually sent", usage.Bytes)
+	}
+
+	// A chunked body may not send more than it reserved
+	nested = 1
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, chunked(strings.Repeat("x", 61)))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized chunked upload: status %d, want 413", rec.Code)
+	}
+}
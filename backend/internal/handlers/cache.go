@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/cache"
+	"github.com/KennyMwendwaX/reformat/internal/storage"
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// resultCache holds conversion results in fileStore, nil when caching is
+// disabled. Set by OpenStorage.
+var resultCache *cache.Cache
+
+// Response headers of a conversion kept with its cached result
+var cachedHeaders = []string{"Content-Type", "X-Image-Quality", "X-Image-Width", "X-Image-Height"}
+
+// resultKey returns the cache key of converting tempFile to target with
+// options, or "" when the result is not cached
+func resultKey(r *http.Request, tempFile, target string, options []converter.ConvertOption) string {
+	if resultCache == nil {
+		return ""
+	}
+	fingerprint, err := converter.Fingerprint(options...)
+	if err != nil {
+		logger(r).Warn("Error computing cache key", "error", err)
+		return ""
+	}
+	key, err := cache.Key(tempFile, target, fingerprint)
+	if err != nil {
+		logger(r).Warn("Error computing cache key", "error", err)
+		return ""
+	}
+	return key
+}
+
+// parseDelivery reads the delivery query parameter: "file", the default,
+// sends the result in the response and "url" a presigned URL to download
+// it from storage
+func parseDelivery(query url.Values) (byURL bool, err error) {
+	switch query.Get("delivery") {
+	case "", "file":
+		return false, nil
+	case "url":
+		return true, nil
+	}
+	return false, fmt.Errorf("Invalid 'delivery': must be file or url")
+}
+
+// sendCached responds with the cached result stored under key, or a URL to
+// it when byURL is set, and returns true, or returns false when there is
+// none
+func sendCached(w http.ResponseWriter, r *http.Request, key, filename string, byURL bool) bool {
+	if key == "" {
+		return false
+	}
+	body, entry, ok := resultCache.Get(r.Context(), key)
+	if !ok {
+		cacheLookups.WithLabelValues("miss").Inc()
+		return false
+	}
+	defer body.Close()
+	cacheLookups.WithLabelValues("hit").Inc()
+
+	for name, value := range entry.Header {
+		w.Header().Set(name, value)
+	}
+	if byURL {
+		setCacheStatus(w, true)
+		respondURL(w, r, cache.StoreKey(key), `"`+key+`"`, filename)
+		return true
+	}
+	respondResult(w, r, key, true, body, entry.Size, filename)
+	return true
+}
+
+// sendResult keeps a new conversion result under key, unless key is empty,
+// and responds with it, or a URL to it when byURL is set
+func sendResult(w http.ResponseWriter, r *http.Request, key, outputFile, contentType, filename string, byURL bool) {
+	if key == "" {
+		deliverOutput(w, r, outputFile, contentType, filename, byURL)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	header := map[string]string{}
+	for _, name := range cachedHeaders {
+		if value := w.Header().Get(name); value != "" {
+			header[name] = value
+		}
+	}
+	ctx, span := traceStage(r, "store")
+	_, err := resultCache.Put(ctx, key, outputFile, header)
+	endStage(span, err)
+	if byURL {
+		switch {
+		case errors.Is(err, cache.ErrTooLarge):
+			writeError(w, r, http.StatusInsufficientStorage, codeInternal, "Converted file is too large to store")
+			return
+		case err != nil:
+			logger(r).Error("Error storing conversion result", "error", err)
+			writeError(w, r, http.StatusInternalServerError, codeInternal, "Error storing converted file")
+			return
+		}
+		setCacheStatus(w, false)
+		respondURL(w, r, cache.StoreKey(key), `"`+key+`"`, filename)
+		return
+	}
+	if err != nil && !errors.Is(err, cache.ErrTooLarge) {
+		logger(r).Warn("Error caching conversion result", "error", err)
+	}
+
+	f, err := os.Open(outputFile)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error reading converted file")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error reading converted file")
+		return
+	}
+	respondResult(w, r, key, false, f, info.Size(), filename)
+}
+
+// respondResult sends a result of size bytes tagged with its cache key, or
+// 304 Not Modified when the client already holds it
+func respondResult(w http.ResponseWriter, r *http.Request, key string, hit bool, body io.Reader, size int64, filename string) {
+	_, span := traceStage(r, "respond")
+	span.SetAttributes(attribute.Bool("cache.hit", hit), attribute.Int64("response.bytes", size))
+
+	etag := `"` + key + `"`
+	w.Header().Set("ETag", etag)
+	setCacheStatus(w, hit)
+	if noneMatch(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		endStage(span, nil)
+		return
+	}
+
+	if filename != "" {
+		w.Header().Set("Content-Disposition", contentDisposition(filename))
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	_, err := io.Copy(w, body)
+	endStage(span, err)
+}
+
+// urlResponse is the body of a conversion delivered by URL
+type urlResponse struct {
+	URL         string    `json:"url"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	ETag        string    `json:"etag,omitempty"`
+	ContentType string    `json:"content_type"`
+}
+
+// respondURL sends a presigned URL downloading the object stored under
+// storeKey as filename, with the ETag of cached results. The Content-Type
+// and image headers of the result stay on the response.
+func respondURL(w http.ResponseWriter, r *http.Request, storeKey, etag, filename string) {
+	ctx, span := traceStage(r, "respond")
+	span.SetAttributes(attribute.String("storage.key", storeKey))
+	expiresAt := time.Now().Add(cfg.Storage.URLExpiry).UTC().Truncate(time.Second)
+	location, err := fileStore.PresignGet(ctx, storeKey, storage.URLOptions{Expires: cfg.Storage.URLExpiry, Filename: filename})
+	endStage(span, err)
+	if err != nil {
+		logger(r).Error("Error signing download URL", "error", err)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error signing download URL")
+		return
+	}
+
+	response := urlResponse{
+		URL:         absoluteURL(r, location),
+		ExpiresAt:   expiresAt,
+		ETag:        etag,
+		ContentType: w.Header().Get("Content-Type"),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false) // keep the & of the URL readable
+	encoder.Encode(response)
+}
+
+func setCacheStatus(w http.ResponseWriter, hit bool) {
+	if hit {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+}
+
+// absoluteURL resolves a download URL relative to the server, as made by
+// local storage without a public URL, against the host r was sent to
+func absoluteURL(r *http.Request, location string) string {
+	if !strings.HasPrefix(location, "/") {
+		return location
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); cfg.RateLimit.TrustProxy && (proto == "http" || proto == "https") {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host + location
+}
+
+// noneMatch reports whether an If-None-Match header lists etag. Results
+// are compared weakly, as for GET requests.
+func noneMatch(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
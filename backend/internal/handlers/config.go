@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/auth"
+	"github.com/KennyMwendwaX/reformat/internal/config"
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+// cfg is the configuration the handlers run with, set by Configure
+var cfg = config.Default()
+
+// conversionSlots holds one token per conversion running at once
+var conversionSlots = make(chan struct{}, cfg.Workers.Conversions)
+
+// Configure sets the configuration used by every handler. It must be called
+// before the server starts.
+func Configure(c *config.Config) {
+	cfg = c
+	conversionSlots = make(chan struct{}, c.Workers.Conversions)
+	keyring = auth.NewKeyring(c.Auth.Keys)
+	configureLimits()
+}
+
+// converterOptions returns the configured options every conversion of r
+// starts from
+func converterOptions(r *http.Request) []converter.ConvertOption {
+	return []converter.ConvertOption{
+		converter.WithLimits(cfg.Limits.Converter()),
+		converter.WithCommandTimeout(cfg.Timeouts.Command),
+		converter.WithToolPaths(cfg.Tools.Converter()),
+		converter.WithLogger(logger(r)),
+		converter.WithContext(r.Context()),
+	}
+}
+
+// Name pattern of request work directories
+const tempDirPattern = "conversion-*"
+
+// newTempDir creates the work directory of a request
+func newTempDir() (string, error) {
+	return os.MkdirTemp(cfg.Server.TempDir, tempDirPattern)
+}
+
+// SweepTempDirs removes work directories left behind by a run that was
+// killed before its requests finished, and returns how many it removed.
+// Only directories last written more than the conversion timeout ago are
+// removed: younger ones may belong to requests in progress on another
+// instance sharing the temp directory.
+func SweepTempDirs() (int, error) {
+	parent := cfg.Server.TempDir
+	if parent == "" {
+		parent = os.TempDir()
+	}
+	matches, err := filepath.Glob(filepath.Join(parent, tempDirPattern))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	var errs []error
+	for _, dir := range matches {
+		info, err := os.Lstat(dir)
+		if err != nil || !info.IsDir() || time.Since(info.ModTime()) <= cfg.Timeouts.Conversion {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
+
+// LimitConversions runs at most the configured number of conversions at
+// once. The conversion timeout starts when a request gets here and covers
+// both the wait for a free slot and the conversion: requests still waiting
+// when it expires fail with 429 and a Retry-After header, and a running
+// conversion is stopped through the request context.
+func LimitConversions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slots := conversionSlots
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.Timeouts.Conversion)
+		defer cancel()
+
+		conversionQueueDepth.Inc()
+		select {
+		case slots <- struct{}{}:
+			conversionQueueDepth.Dec()
+			conversionWorkersActive.Inc()
+			defer func() {
+				conversionWorkersActive.Dec()
+				<-slots
+			}()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		case <-ctx.Done():
+			conversionQueueDepth.Dec()
+			if r.Context().Err() != nil {
+				return
+			}
+			conversionRejections.Inc()
+			w.Header().Set("Retry-After", retryAfter(time.Now().Add(busyRetryAfter)))
+			writeError(w, r, http.StatusTooManyRequests, codeBusy, "Too many conversions in progress, try again later")
+		}
+	})
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+)
+
+func TestLimitConversionsSharesOneDeadline(t *testing.T) {
+	saved := cfg
+	defer Configure(saved)
+	c := config.Default()
+	c.Workers.Conversions = 1
+	c.Timeouts.Conversion = 300 * time.Millisecond
+	Configure(c)
+
+	running, release := make(chan struct{}), make(chan struct{})
+	deadlines := make(chan time.Time, 1)
+	handler := LimitConversions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("hold") != "" {
+			close(running)
+			<-release
+			return
+		}
+		deadline, _ := r.Context().Deadline()
+		deadlines <- deadline
+	}))
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, target, nil))
+		return rec
+	}
+
+	go serve("/api/convert?hold=1")
+	<-running
+
+	// Times out waiting for the slot
+	if rec := serve("/api/convert"); rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("queued past the timeout: status %d, want 429 with Retry-After", rec.Code)
+	}
+
+	// Gets the slot after waiting, with what is left of the same timeout
+	start := time.Now()
+	time.AfterFunc(100*time.Millisecond, func() { close(release) })
+	if rec := serve("/api/convert"); rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200", rec.Code)
+	}
+	// Restarting the timeout after the wait would give about 400ms
+	if deadline := <-deadlines; deadline.Sub(start) > c.Timeouts.Conversion+50*time.Millisecond {
+		t.Errorf("deadline %s from the start, want about %s", deadline.Sub(start), c.Timeouts.Conversion)
+	}
+}
+
+func TestSweepTempDirs(t *testing.T) {
+	saved := cfg
+	defer Configure(saved)
+	c := config.Default()
+	c.Server.TempDir = t.TempDir()
+	c.Timeouts.Conversion = time.Minute
+	Configure(c)
+
+	old := time.Now().Add(-2 * time.Minute)
+	dirs := map[string]bool{ // name: removed
+		"conversion-old":    true,
+		"conversion-recent": false,
+		"other-old":         false,
+	}
+	for name := range dirs {
+		dir := filepath.Join(c.Server.TempDir, name)
+		if err := os.MkdirAll(filepath.Join(dir, "nested"), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, "-old") {
+			os.Chtimes(dir, old, old)
+		}
+	}
+	// A file matching the pattern is not a work directory
+	file := filepath.Join(c.Server.TempDir, "conversion-file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(file, old, old)
+
+	removed, err := SweepTempDirs()
+	if err != nil || removed != 1 {
+		t.Fatalf("SweepTempDirs = %d, %v, want 1 removed", removed, err)
+	}
+	for name, gone := range dirs {
+		if _, err := os.Stat(filepath.Join(c.Server.TempDir, name)); os.IsNotExist(err) != gone {
+			t.Errorf("%s: stat error %v, want removed %v", name, err, gone)
+		}
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("file removed: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+// Limits for contact sheet requests
+const (
+	maxSheetColumns = 20
+	maxSheetCell    = 1024
+)
+
+// ContactSheet lays out the uploaded "files" in a grid and returns a PDF,
+// PNG or JPEG proof sheet. PDF sheets take the watermark, document
+// information, password and pdfa parameters of /api/convert.
+func ContactSheet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Content-Type must be multipart/form-data")
+		return
+	}
+
+	query := r.URL.Query()
+	to := strings.ToLower(query.Get("to"))
+	if to == "" {
+		to = "pdf"
+	}
+	if to != "pdf" && to != "png" && to != "jpg" && to != "jpeg" {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("Invalid 'to' format: %s", to))
+		return
+	}
+	release, ok := startConversion(w, r, "image", "contact-sheet-"+to)
+	if !ok {
+		return
+	}
+	defer release()
+
+	sheetOptions, err := parseSheetOptions(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	options := append(converterOptions(r), sheetOptions...)
+	byURL, err := parseDelivery(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Unable to parse multipart form")
+		return
+	}
+	headers := r.MultipartForm.File["files"]
+	if len(headers) == 0 {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "No files uploaded in 'files'")
+		return
+	}
+	if len(headers) > cfg.Limits.MaxSheetImages {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("Too many files: maximum is %d", cfg.Limits.MaxSheetImages))
+		return
+	}
+
+	tempDir, err := newTempDir()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error creating temporary directory")
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	_, span := traceStage(r, "upload")
+	items := make([]converter.SheetItem, 0, len(headers))
+	for _, header := range headers {
+		// Internal names are unique, so duplicate upload names can't collide
+		tempFile, err := saveFileHeader(header, tempDir)
+		if err != nil {
+			endStage(span, err)
+			writeUploadError(w, r, err)
+			return
+		}
+		items = append(items, converter.SheetItem{
+			Path:    tempFile,
+			Caption: strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename)),
+		})
+	}
+
+	endStage(span, nil)
+
+	output := &outputOptions{}
+	if to == "pdf" {
+		if output, err = parseOutputOptions(r, tempDir); err != nil {
+			writeUploadError(w, r, err)
+			return
+		}
+		options = append(options, output.options...)
+	}
+
+	// Password protected documents are never kept in storage
+	if output.protected {
+		if byURL {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, "delivery=url is not available for password protected documents")
+			return
+		}
+	} else {
+		inputFiles := make([]string, 0, len(items)+len(output.uploads))
+		for _, item := range items {
+			inputFiles = append(inputFiles, item.Path)
+		}
+		keepInputs(r, append(inputFiles, output.uploads...)...)
+	}
+
+	outputFile := filepath.Join(tempDir, "contact-sheet."+to)
+	ctx, span := traceStage(r, "convert")
+	options = append(options, converter.WithOutputPath(outputFile), converter.WithContext(ctx))
+
+	err = converter.NewContactSheetConverter().CreateSheet(items, to, options...)
+	endStage(span, err)
+	if err != nil {
+		writeConversionError(w, r, "Conversion error", err)
+		return
+	}
+
+	deliverOutput(w, r, outputFile, getContentType(to), "contact-sheet."+to, byURL)
+}
+
+// parseSheetOptions reads the columns, spacing, cell_size and captions
+// query parameters
+func parseSheetOptions(query url.Values) ([]converter.ConvertOption, error) {
+	defaults := converter.DefaultOptions()
+	columns := defaults.SheetColumns
+	spacing := defaults.SheetSpacing
+
+	var options []converter.ConvertOption
+	if value := query.Get("columns"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxSheetColumns {
+			return nil, fmt.Errorf("Invalid 'columns': must be between 1 and %d", maxSheetColumns)
+		}
+		columns = n
+	}
+	if value := query.Get("spacing"); value != "" {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || n < 0 || n > 100 {
+			return nil, fmt.Errorf("Invalid 'spacing': must be between 0 and 100")
+		}
+		spacing = n
+	}
+	options = append(options, converter.WithSheetLayout(columns, spacing))
+
+	if value := query.Get("cell_size"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 16 || n > maxSheetCell {
+			return nil, fmt.Errorf("Invalid 'cell_size': must be between 16 and %d", maxSheetCell)
+		}
+		options = append(options, converter.WithSheetCellSize(n))
+	}
+	if value := query.Get("captions"); value != "" {
+		captions, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid 'captions': must be true or false")
+		}
+		options = append(options, converter.WithSheetCaptions(captions))
+	}
+	return options, nil
+}
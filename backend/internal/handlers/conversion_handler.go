@@ -1,16 +1,20 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"time"
 
+	"github.com/KennyMwendwaX/reformat/internal/config"
 	"github.com/KennyMwendwaX/reformat/pkg/converter"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 var allowedFormats = map[string]bool{
@@ -22,9 +26,6 @@ var allowedFormats = map[string]bool{
 	"gif":  true,
 }
 
-// Maximum file size (10MB)
-const maxFileSize = 10 << 20
-
 // Add file size validation
 func validateFileSize(file io.ReadSeeker) error {
 	size, err := file.Seek(0, io.SeekEnd)
@@ -35,8 +36,8 @@ func validateFileSize(file io.ReadSeeker) error {
 	if err != nil {
 		return fmt.Errorf("error resetting file position: %w", err)
 	}
-	if size > maxFileSize {
-		return fmt.Errorf("file size exceeds maximum allowed size of %d bytes", maxFileSize)
+	if maxSize := int64(cfg.Limits.MaxUploadSize); size > maxSize {
+		return fmt.Errorf("file size exceeds maximum allowed size of %d bytes", maxSize)
 	}
 	return nil
 }
@@ -46,150 +47,424 @@ func isValidFormat(format string) bool {
 	return allowedFormats[format]
 }
 
-func Convert(w http.ResponseWriter, r *http.Request) {
-	// Add context with timeout
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-	defer cancel()
-	r = r.WithContext(ctx)
+// saveUpload validates the multipart "file" field and copies it into tempDir
+func saveUpload(r *http.Request, tempDir string) (string, *multipart.FileHeader, error) {
+	_, header, err := r.FormFile("file")
+	if err != nil {
+		return "", nil, &uploadError{http.StatusBadRequest, codeBadRequest, "Unable to retrieve file"}
+	}
 
-	// Add content type validation
-	contentType := r.Header.Get("Content-Type")
-	if !strings.HasPrefix(contentType, "multipart/form-data") {
-		http.Error(w, "Content-Type must be multipart/form-data", http.StatusBadRequest)
-		return
+	tempFile, err := saveFileHeader(header, tempDir)
+	if err != nil {
+		return "", nil, err
 	}
+	return tempFile, header, nil
+}
 
-	file, header, err := r.FormFile("file")
+// saveFileHeader copies a single uploaded file into tempDir
+func saveFileHeader(header *multipart.FileHeader, tempDir string) (string, error) {
+	file, err := header.Open()
 	if err != nil {
-		http.Error(w, "Unable to retrieve file", http.StatusBadRequest)
-		return
+		return "", &uploadError{http.StatusBadRequest, codeBadRequest, "Unable to retrieve file"}
 	}
 	defer file.Close()
 
+	if err := validateFilename(header.Filename); err != nil {
+		return "", err
+	}
+
 	// Validate file size
 	if err := validateFileSize(file); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		return "", &uploadError{http.StatusRequestEntityTooLarge, string(converter.CodeLimitExceeded), err.Error()}
 	}
 
-	// Create temporary directory for conversion
-	tempDir, err := os.MkdirTemp("", "conversion-*")
+	// The original name is only used for download names and captions
+	name, err := internalFilename()
 	if err != nil {
-		http.Error(w, "Error creating temporary directory", http.StatusInternalServerError)
-		return
+		return "", &uploadError{http.StatusInternalServerError, codeInternal, "Error saving uploaded file"}
 	}
-	defer os.RemoveAll(tempDir)
-
-	tempFile := filepath.Join(tempDir, header.Filename)
+	tempFile := filepath.Join(tempDir, name)
 	dst, err := os.Create(tempFile)
 	if err != nil {
-		http.Error(w, "Error saving uploaded file", http.StatusInternalServerError)
-		return
+		return "", &uploadError{http.StatusInternalServerError, codeInternal, "Error saving uploaded file"}
 	}
-	defer dst.Close()
 
-	// Copy with progress monitoring
-	written, err := io.Copy(dst, io.TeeReader(file, &progressWriter{total: header.Size}))
+	written, err := io.Copy(dst, file)
+	dst.Close()
 	if err != nil || written != header.Size {
-		http.Error(w, "Error copying file", http.StatusInternalServerError)
+		return "", &uploadError{http.StatusInternalServerError, codeInternal, "Error copying file"}
+	}
+
+	// Converters are chosen by extension, so name the file after its content
+	format, err := detectUploadFormat(tempFile, header.Filename)
+	if err != nil {
+		return "", err
+	}
+	typedFile := tempFile + converter.FormatExtension(format)
+	if err := os.Rename(tempFile, typedFile); err != nil {
+		return "", &uploadError{http.StatusInternalServerError, codeInternal, "Error saving uploaded file"}
+	}
+	return typedFile, nil
+}
+
+func Convert(w http.ResponseWriter, r *http.Request) {
+	// Add content type validation
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Content-Type must be multipart/form-data")
 		return
 	}
 
-	fmt.Printf("Uploaded file: %s (%d bytes)\n", header.Filename, header.Size)
+	// Create temporary directory for conversion
+	tempDir, err := newTempDir()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error creating temporary directory")
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	_, span := traceStage(r, "upload")
+	tempFile, header, err := saveUpload(r, tempDir)
+	endStage(span, err)
+	if err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
 
 	to := strings.ToLower(r.URL.Query().Get("to"))
 
 	if to == "" {
-		http.Error(w, "Missing 'to' query parameter", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Missing 'to' query parameter")
 		return
 	}
 
 	if !isValidFormat(to) {
-		http.Error(w, fmt.Sprintf("Invalid 'to' format: %s", to), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("Invalid 'to' format: %s", to))
 		return
 	}
+	release, ok := startConversion(w, r, sourceFormat(tempFile), to)
+	if !ok {
+		return
+	}
+	defer release()
 
-	switch to {
-	case "pdf":
-		pdfConverter, err := converter.GetPDFConverter(header.Filename)
+	svgOptions, err := parseSVGOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+	options := append(converterOptions(r), svgOptions...)
+
+	output, err := parseOutputOptions(r, tempDir)
+	if err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+	options = append(options, output.options...)
+	if to == "jpg" || to == "jpeg" || to == "png" || to == "gif" {
+		imageOptions, err := parseImageOptions(r.URL.Query())
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Converter error: %v", err), http.StatusBadRequest)
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		options = append(options, imageOptions...)
+	}
+	password := r.PostFormValue("input_password")
+	if password != "" {
+		options = append(options, converter.WithInputPassword(password))
+	}
+
+	byURL, err := parseDelivery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	// Password protected documents are never kept in storage
+	key := ""
+	if output.protected || password != "" {
+		if byURL {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, "delivery=url is not available for password protected documents")
 			return
 		}
+	} else {
+		key = resultKey(r, tempFile, to, options)
+		keepInputs(r, append([]string{tempFile}, output.uploads...)...)
+	}
+	if sendCached(w, r, key, downloadFilename(header.Filename, "."+to), byURL) {
+		return
+	}
 
-		err = pdfConverter.ConvertToPDF(tempFile) // Changed from header.Filename to tempFile
+	switch to {
+	case "pdf":
+		pdfConverter, err := converter.GetPDFConverter(tempFile)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Conversion error: %v", err), http.StatusInternalServerError)
+			writeConversionError(w, r, "Converter error", err)
 			return
 		}
 
-		outputFile := converter.GetOutputFilename(tempFile, ".pdf")
-		convertedData, err := os.ReadFile(outputFile)
+		ctx, span := traceStage(r, "convert")
+		err = pdfConverter.ConvertToPDF(tempFile, append(options, converter.WithContext(ctx))...)
+		endStage(span, err)
 		if err != nil {
-			http.Error(w, "Error reading converted file", http.StatusInternalServerError)
+			writeConversionError(w, r, "Conversion error", err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/pdf")
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.pdf",
-			strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))))
-		w.Write(convertedData)
+		outputFile := converter.GetOutputFilename(tempFile, ".pdf")
+		sendResult(w, r, key, outputFile, "application/pdf", downloadFilename(header.Filename, ".pdf"), byURL)
 
 	case "docx":
 		docxConverter, err := converter.GetDocxConverter(tempFile)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Converter error: %v", err), http.StatusBadRequest)
+			writeConversionError(w, r, "Converter error", err)
 			return
 		}
-
-		err = docxConverter.ConvertToDocx(tempFile)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Conversion error: %v", err), http.StatusInternalServerError)
+		if filepath.Ext(tempFile) == ".pdf" && !requireConversion(w, r, converter.ConversionPDFToDocx) {
 			return
 		}
 
-		outputFile := converter.GetOutputFilename(tempFile, ".docx")
-		defer os.Remove(outputFile)
-
-		convertedData, err := os.ReadFile(outputFile)
+		ctx, span := traceStage(r, "convert")
+		err = docxConverter.ConvertToDocx(tempFile, append(options, converter.WithContext(ctx))...)
+		endStage(span, err)
 		if err != nil {
-			http.Error(w, "Error reading converted file", http.StatusInternalServerError)
+			writeConversionError(w, r, "Conversion error", err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.wordprocessingml.document")
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.docx",
-			strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))))
-		w.Write(convertedData)
+		outputFile := converter.GetOutputFilename(tempFile, ".docx")
+		sendResult(w, r, key, outputFile, getContentType("docx"), downloadFilename(header.Filename, ".docx"), byURL)
 
 	case "jpg", "jpeg", "png", "gif":
 		imgConverter := converter.NewImageFormatConverter()
-		err := imgConverter.Convert(tempFile, to)
+		ctx, span := traceStage(r, "convert")
+		err := imgConverter.Convert(tempFile, to, append(options, converter.WithContext(ctx))...)
+		endStage(span, err)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Conversion error: %v", err), http.StatusInternalServerError)
+			writeConversionError(w, r, "Conversion error", err)
 			return
 		}
 
+		result := imgConverter.Result
+		if result.Quality > 0 {
+			w.Header().Set("X-Image-Quality", strconv.Itoa(result.Quality))
+		}
+		w.Header().Set("X-Image-Width", strconv.Itoa(result.Width))
+		w.Header().Set("X-Image-Height", strconv.Itoa(result.Height))
 		outputFile := converter.GetOutputFilename(tempFile, "."+to)
-		defer os.Remove(outputFile)
+		sendResult(w, r, key, outputFile, getContentType(to), downloadFilename(header.Filename, "."+to), byURL)
 
-		convertedData, err := os.ReadFile(outputFile)
+	default:
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("Unsupported conversion to format: %s", to))
+		return
+	}
+}
+
+// sendOutput responds with a converted file. An empty filename sends no
+// Content-Disposition header.
+func sendOutput(w http.ResponseWriter, r *http.Request, outputFile, contentType, filename string) {
+	_, span := traceStage(r, "respond")
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		endStage(span, err)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error reading converted file")
+		return
+	}
+	span.SetAttributes(attribute.Int("response.bytes", len(data)))
+
+	w.Header().Set("Content-Type", contentType)
+	if filename != "" {
+		w.Header().Set("Content-Disposition", contentDisposition(filename))
+	}
+	_, err = w.Write(data)
+	endStage(span, err)
+}
+
+// parseSVGOptions reads the width, height and dpi query parameters used
+// when rasterizing SVG input
+func parseSVGOptions(query url.Values) ([]converter.ConvertOption, error) {
+	var options []converter.ConvertOption
+
+	width, height := 0, 0
+	for _, param := range []struct {
+		name  string
+		value *int
+	}{{"width", &width}, {"height", &height}} {
+		if v := query.Get(param.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("Invalid '%s': must be a positive number of pixels", param.name)
+			}
+			*param.value = n
+		}
+	}
+	if width > 0 || height > 0 {
+		options = append(options, converter.WithSVGSize(width, height))
+	}
+
+	if v := query.Get("dpi"); v != "" {
+		dpi, err := strconv.ParseFloat(v, 64)
+		if err != nil || dpi <= 0 || dpi > 1200 {
+			return nil, fmt.Errorf("Invalid 'dpi': must be between 1 and 1200")
+		}
+		options = append(options, converter.WithSVGDPI(dpi))
+	}
+	return options, nil
+}
+
+// parseImageOptions reads the max_size and strip_metadata query parameters
+// of conversions to an image format
+func parseImageOptions(query url.Values) ([]converter.ConvertOption, error) {
+	var options []converter.ConvertOption
+	if maxSize := query.Get("max_size"); maxSize != "" {
+		size, err := parseByteSize(maxSize)
 		if err != nil {
-			http.Error(w, "Error reading converted file", http.StatusInternalServerError)
-			return
+			return nil, fmt.Errorf("Invalid 'max_size': %v", err)
 		}
+		options = append(options, converter.WithTargetFileSize(size))
+	}
+	if strip, _ := strconv.ParseBool(query.Get("strip_metadata")); strip {
+		options = append(options, converter.WithStripMetadata(true))
+	}
+	return options, nil
+}
 
-		w.Header().Set("Content-Type", getContentType(to))
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.%s",
-			strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename)), to))
-		w.Write(convertedData)
+// parseWatermark reads the watermark_* query parameters and the optional
+// watermark_image upload. It returns nil when no watermark was requested.
+func parseWatermark(r *http.Request, tempDir string) (*converter.Watermark, error) {
+	query := r.URL.Query()
+	wm := &converter.Watermark{
+		Text:     query.Get("watermark_text"),
+		Position: query.Get("watermark_position"),
+	}
 
-	default:
-		http.Error(w, fmt.Sprintf("Unsupported conversion to format: %s", to), http.StatusBadRequest)
-		return
+	_, header, err := r.FormFile("watermark_image")
+	switch {
+	case err == nil:
+		if wm.Image, err = saveFileHeader(header, tempDir); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, http.ErrMissingFile):
+		return nil, &uploadError{http.StatusBadRequest, codeBadRequest, "Unable to retrieve watermark image"}
+	}
+
+	if wm.Text == "" && wm.Image == "" {
+		return nil, nil
+	}
+
+	for _, param := range []struct {
+		name  string
+		value *float64
+	}{
+		{"watermark_rotation", &wm.Rotation},
+		{"watermark_opacity", &wm.Opacity},
+		{"watermark_scale", &wm.Scale},
+	} {
+		if v := query.Get(param.name); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, &uploadError{http.StatusBadRequest, codeBadRequest, fmt.Sprintf("Invalid '%s': must be a number", param.name)}
+			}
+			*param.value = n
+		}
+	}
+	if v := query.Get("watermark_tile"); v != "" {
+		tile, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, &uploadError{http.StatusBadRequest, codeBadRequest, "Invalid 'watermark_tile': must be true or false"}
+		}
+		wm.Tile = tile
+	}
+	return wm, nil
+}
+
+// outputOptions are the options shared by the endpoints producing PDFs
+type outputOptions struct {
+	options   []converter.ConvertOption
+	protected bool     // the output is to be encrypted
+	uploads   []string // saved files uploaded with them, such as the watermark image
+}
+
+// parseOutputOptions reads the watermark, document information, password
+// and pdfa parameters shared by the endpoints producing PDFs
+func parseOutputOptions(r *http.Request, tempDir string) (*outputOptions, error) {
+	out := &outputOptions{}
+	watermark, err := parseWatermark(r, tempDir)
+	if err != nil {
+		return nil, err
+	}
+	if watermark != nil {
+		out.options = append(out.options, converter.WithWatermark(*watermark))
+		if watermark.Image != "" {
+			out.uploads = append(out.uploads, watermark.Image)
+		}
+	}
+	if metadata := parsePDFMetadata(r.URL.Query()); !metadata.IsZero() {
+		out.options = append(out.options, converter.WithPDFMetadata(metadata))
+	}
+
+	protection, err := parsePDFProtection(r)
+	if err != nil {
+		return nil, &uploadError{http.StatusBadRequest, codeBadRequest, err.Error()}
+	}
+	if protection != nil {
+		out.options = append(out.options, converter.WithPDFProtection(*protection))
+		out.protected = true
+	}
+	if value := r.URL.Query().Get("pdfa"); value != "" {
+		level, err := converter.ParsePDFALevel(value)
+		if err != nil {
+			return nil, &uploadError{http.StatusBadRequest, codeBadRequest, "Invalid 'pdfa': must be 1b or 2b"}
+		}
+		out.options = append(out.options, converter.WithPDFA(level))
+	}
+	return out, nil
+}
+
+// parsePDFMetadata reads the title, author, subject, keywords and creator
+// query parameters
+func parsePDFMetadata(query url.Values) converter.PDFMetadata {
+	return converter.PDFMetadata{
+		Title:    query.Get("title"),
+		Author:   query.Get("author"),
+		Subject:  query.Get("subject"),
+		Keywords: query.Get("keywords"),
+		Creator:  query.Get("creator"),
 	}
 }
 
+// parsePDFProtection reads the password, owner_password and permissions
+// form fields. Passwords are only accepted in the request body so they stay
+// out of URLs and access logs. It returns nil when no password was given.
+func parsePDFProtection(r *http.Request) (*converter.PDFProtection, error) {
+	userPassword := r.PostFormValue("password")
+	ownerPassword := r.PostFormValue("owner_password")
+	if userPassword == "" && ownerPassword == "" {
+		return nil, nil
+	}
+
+	permissions := "all"
+	if _, ok := r.PostForm["permissions"]; ok {
+		permissions = r.PostFormValue("permissions")
+	}
+	protection, err := converter.ParsePDFPermissions(permissions)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid 'permissions': %v", err)
+	}
+	protection.UserPassword = userPassword
+	protection.OwnerPassword = ownerPassword
+	return &protection, nil
+}
+
+// parseByteSize parses sizes like "200000", "200KB" or "1.5MB"
+func parseByteSize(value string) (int64, error) {
+	n, err := config.ParseByteSize(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("expected a positive size such as 200KB")
+	}
+	return n, nil
+}
+
 func getContentType(format string) string {
 	switch format {
 	case "pdf":
@@ -206,22 +481,3 @@ func getContentType(format string) string {
 		return "application/octet-stream"
 	}
 }
-
-// Progress monitoring
-type progressWriter struct {
-	total   int64
-	current int64
-	lastLog time.Time
-}
-
-func (pw *progressWriter) Write(p []byte) (n int, err error) {
-	n = len(p)
-	pw.current += int64(n)
-
-	if time.Since(pw.lastLog) >= time.Second {
-		progress := float64(pw.current) / float64(pw.total) * 100
-		fmt.Printf("Progress: %.2f%%\n", progress)
-		pw.lastLog = time.Now()
-	}
-	return n, nil
-}
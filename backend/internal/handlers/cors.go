@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+)
+
+// originPattern is one allowed origin. A host starting with "*." matches any
+// subdomain, at any depth, but not the bare domain.
+type originPattern struct {
+	scheme   string
+	host     string // without the wildcard label
+	port     string
+	wildcard bool
+}
+
+// parseOriginPattern splits an allowed origin from the configuration, which
+// has already been validated
+func parseOriginPattern(origin string) (originPattern, bool) {
+	scheme, host, ok := strings.Cut(strings.ToLower(origin), "://")
+	if !ok {
+		return originPattern{}, false
+	}
+	p := originPattern{scheme: scheme}
+	if strings.HasPrefix(host, "*.") {
+		p.wildcard = true
+		host = strings.TrimPrefix(host, "*")
+	}
+	p.host, p.port = splitHostPort(host)
+	return p, true
+}
+
+// matches reports whether a request origin is allowed by p
+func (p originPattern) matches(scheme, host, port string) bool {
+	if scheme != p.scheme || port != p.port {
+		return false
+	}
+	if p.wildcard {
+		return strings.HasSuffix(host, p.host) && len(host) > len(p.host)
+	}
+	return host == p.host
+}
+
+// splitHostPort splits a host with an optional port, keeping IPv6 brackets
+func splitHostPort(hostport string) (string, string) {
+	if i := strings.LastIndexByte(hostport, ':'); i > strings.LastIndexByte(hostport, ']') {
+		return hostport[:i], hostport[i+1:]
+	}
+	return hostport, ""
+}
+
+// CORS answers preflight requests and adds CORS headers for the configured
+// origins. The matched origin is reflected rather than "*" whenever
+// credentials are allowed or the list has specific origins, and responses
+// vary on Origin so caches keep them apart.
+func CORS(c config.CORSConfig) func(http.Handler) http.Handler {
+	var patterns []originPattern
+	anyOrigin := false
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			anyOrigin = true
+		} else if p, ok := parseOriginPattern(origin); ok {
+			patterns = append(patterns, p)
+		}
+	}
+
+	allowed := func(origin string) bool {
+		if anyOrigin {
+			return true
+		}
+		u, err := url.Parse(strings.ToLower(origin))
+		if err != nil || u.Host == "" {
+			return false
+		}
+		host, port := splitHostPort(u.Host)
+		for _, p := range patterns {
+			if p.matches(u.Scheme, host, port) {
+				return true
+			}
+		}
+		return false
+	}
+
+	methods := strings.Join(c.AllowedMethods, ", ")
+	headers := strings.Join(c.AllowedHeaders, ", ")
+	exposed := strings.Join(c.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(c.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if origin != "" && allowed(origin) {
+				if anyOrigin && !c.AllowCredentials {
+					h.Set("Access-Control-Allow-Origin", "*")
+				} else {
+					h.Set("Access-Control-Allow-Origin", origin)
+				}
+				if c.AllowCredentials {
+					h.Set("Access-Control-Allow-Credentials", "true")
+				}
+
+				if preflight {
+					h.Set("Access-Control-Allow-Methods", methods)
+					if headers != "" {
+						h.Set("Access-Control-Allow-Headers", headers)
+					}
+					if c.MaxAge > 0 {
+						h.Set("Access-Control-Max-Age", maxAge)
+					}
+				} else if exposed != "" {
+					h.Set("Access-Control-Expose-Headers", exposed)
+				}
+			}
+
+			// Preflights never reach the handlers; a disallowed origin gets
+			// no CORS headers, which the browser treats as a refusal
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
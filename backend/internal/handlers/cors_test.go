@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+)
+
+func TestCORSOrigins(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		origin      string
+		want        string // Access-Control-Allow-Origin, empty for none
+	}{
+		{"exact", []string{"https://app.example.com"}, false, "https://app.example.com", "https://app.example.com"},
+		{"exact in other case", []string{"https://app.example.com"}, false, "HTTPS://App.Example.com", "HTTPS://App.Example.com"},
+		{"other host", []string{"https://app.example.com"}, false, "https://evil.example.com", ""},
+		{"other scheme", []string{"https://app.example.com"}, false, "http://app.example.com", ""},
+		{"other port", []string{"https://app.example.com"}, false, "https://app.example.com:8443", ""},
+		{"port", []string{"http://localhost:5173"}, false, "http://localhost:5173", "http://localhost:5173"},
+		{"subdomain", []string{"https://*.example.com"}, false, "https://app.example.com", "https://app.example.com"},
+		{"deep subdomain", []string{"https://*.example.com"}, false, "https://a.b.example.com", "https://a.b.example.com"},
+		{"bare domain", []string{"https://*.example.com"}, false, "https://example.com", ""},
+		{"suffix only", []string{"https://*.example.com"}, false, "https://evilexample.com", ""},
+		{"pattern in host", []string{"https://*.example.com"}, false, "https://example.com.evil.org", ""},
+		{"second of several", []string{"https://a.example.com", "https://b.example.com"}, false, "https://b.example.com", "https://b.example.com"},
+		{"any", []string{"*"}, false, "https://anyone.org", "*"},
+		{"any with credentials", []string{"*"}, true, "https://anyone.org", "https://anyone.org"},
+		{"list with credentials", []string{"https://app.example.com"}, true, "https://app.example.com", "https://app.example.com"},
+		{"null origin", []string{"https://app.example.com"}, false, "null", ""},
+		{"none configured", nil, false, "https://app.example.com", ""},
+		{"same origin request", []string{"*"}, false, "", ""},
+	}
+
+	for _, tt := range tests {
+		c := config.Default().CORS
+		c.AllowedOrigins, c.AllowCredentials = tt.origins, tt.credentials
+		reached := false
+		handler := CORS(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true }))
+
+		r := httptest.NewRequest(http.MethodPost, "/api/convert", nil)
+		r.Header.Set("Origin", tt.origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		h := rec.Header()
+
+		if got := h.Get("Access-Control-Allow-Origin"); got != tt.want {
+			t.Errorf("%s: Allow-Origin = %q, want %q", tt.name, got, tt.want)
+		}
+		if got, want := h.Get("Access-Control-Allow-Credentials"), tt.credentials && tt.want != ""; (got == "true") != want {
+			t.Errorf("%s: Allow-Credentials = %q, want it set %v", tt.name, got, want)
+		}
+		if got, want := h.Get("Access-Control-Expose-Headers") != "", tt.want != ""; got != want {
+			t.Errorf("%s: Expose-Headers set %v, want %v", tt.name, got, want)
+		}
+		if got := h.Values("Vary"); len(got) != 1 || got[0] != "Origin" {
+			t.Errorf("%s: Vary = %q, want Origin", tt.name, got)
+		}
+		if !reached {
+			t.Errorf("%s: request did not reach the handler", tt.name)
+		}
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	c := config.Default().CORS
+	c.AllowedOrigins = []string{"https://app.example.com"}
+	c.MaxAge = 5 * time.Minute
+
+	tests := []struct {
+		name      string
+		origin    string
+		method    string // Access-Control-Request-Method
+		preflight bool
+		allowed   bool
+	}{
+		{"allowed", "https://app.example.com", "POST", true, true},
+		{"disallowed", "https://evil.example.com", "POST", true, false},
+		{"plain OPTIONS", "https://app.example.com", "", false, true},
+	}
+	for _, tt := range tests {
+		reached := false
+		handler := CORS(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { reached = true }))
+		r := httptest.NewRequest(http.MethodOptions, "/api/convert", nil)
+		r.Header.Set("Origin", tt.origin)
+		if tt.method != "" {
+			r.Header.Set("Access-Control-Request-Method", tt.method)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		h := rec.Header()
+
+		if reached == tt.preflight {
+			t.Errorf("%s: reached the handler %v, want %v", tt.name, reached, !tt.preflight)
+		}
+		if tt.preflight && rec.Code != http.StatusNoContent {
+			t.Errorf("%s: status %d, want 204", tt.name, rec.Code)
+		}
+		if got := h.Get("Access-Control-Allow-Origin") != ""; got != tt.allowed {
+			t.Errorf("%s: Allow-Origin set %v, want %v", tt.name, got, tt.allowed)
+		}
+		wantPreflightHeaders := tt.preflight && tt.allowed
+		if got := h.Get("Access-Control-Allow-Methods"); (got == strings.Join(c.AllowedMethods, ", ")) != wantPreflightHeaders {
+			t.Errorf("%s: Allow-Methods = %q", tt.name, got)
+		}
+		if got := h.Get("Access-Control-Allow-Headers"); (got == strings.Join(c.AllowedHeaders, ", ")) != wantPreflightHeaders {
+			t.Errorf("%s: Allow-Headers = %q", tt.name, got)
+		}
+		if got := h.Get("Access-Control-Max-Age"); (got == "300") != wantPreflightHeaders {
+			t.Errorf("%s: Max-Age = %q", tt.name, got)
+		}
+		if tt.preflight {
+			want := "Origin,Access-Control-Request-Method,Access-Control-Request-Headers"
+			if got := strings.Join(h.Values("Vary"), ","); got != want {
+				t.Errorf("%s: Vary = %q, want %q", tt.name, got, want)
+			}
+		}
+	}
+}
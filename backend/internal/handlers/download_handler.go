@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/KennyMwendwaX/reformat/internal/storage"
+)
+
+// Error code of an expired download URL
+const codeExpired = "expired"
+
+// Download serves an object of local storage through a presigned URL made
+// by delivery=url. The signature is the only credential, so the route sits
+// outside authentication. With S3 storage the URLs point at the bucket and
+// this route answers 404.
+func Download(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	local, ok := fileStore.(*storage.Local)
+	if !ok {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "Downloads are served by the storage backend")
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, storage.DownloadPath)
+	filename, err := local.Verify(key, r.URL.Query())
+	switch {
+	case errors.Is(err, storage.ErrURLExpired):
+		writeError(w, r, http.StatusGone, codeExpired, "Download URL has expired")
+		return
+	case err != nil:
+		writeError(w, r, http.StatusForbidden, codeForbidden, "Invalid download URL")
+		return
+	}
+
+	body, obj, err := local.Get(r.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, codeNotFound, "File not found")
+		return
+	}
+	if err != nil {
+		logger(r).Error("Error opening stored file", "error", err)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error reading stored file")
+		return
+	}
+	defer body.Close()
+
+	if contentType := obj.Header["Content-Type"]; contentType != "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+	if filename != "" {
+		w.Header().Set("Content-Disposition", contentDisposition(filename))
+	}
+	// Results are stored under content or random keys and never change
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	if seeker, ok := body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", obj.ModTime, seeker)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	if r.Method != http.MethodHead {
+		io.Copy(w, body)
+	}
+}
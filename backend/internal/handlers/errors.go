@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+// Codes for failures detected by the handlers themselves. Conversion
+// failures carry the converter codes.
+const (
+	codeBadRequest       = "bad_request"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeNotFound         = "not_found"
+	codeInternal         = "internal_error"
+	codeBusy             = "server_busy"
+)
+
+// Response status of each converter error code
+var conversionStatuses = map[converter.Code]int{
+	converter.CodeInvalidOptions:    http.StatusBadRequest,
+	converter.CodeUnsupportedFormat: http.StatusUnsupportedMediaType,
+	converter.CodeCorruptInput:      http.StatusUnprocessableEntity,
+	converter.CodeInvalidPassword:   http.StatusUnprocessableEntity,
+	converter.CodeLimitExceeded:     http.StatusRequestEntityTooLarge,
+	converter.CodeDependencyMissing: http.StatusServiceUnavailable,
+	converter.CodeTimeout:           http.StatusGatewayTimeout,
+}
+
+// errorResponse is the JSON body of every error response
+type errorResponse struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id"`
+}
+
+// writeError responds with a JSON error body
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	recordFailure(r, code)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorResponse{Code: code, Message: message, RequestID: requestID(r)})
+}
+
+// writeConversionError responds to a failed conversion. Errors with a
+// converter code are reported with their message; anything else is logged
+// and reported as an internal error, so paths and library details stay on
+// the server.
+func writeConversionError(w http.ResponseWriter, r *http.Request, prefix string, err error) {
+	code := converter.ErrorCode(err)
+	status, ok := conversionStatuses[code]
+	if !ok {
+		logger(r).Error(prefix, "error", err)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, prefix+": internal error")
+		return
+	}
+	writeError(w, r, status, string(code), fmt.Sprintf("%s: %v", prefix, err))
+}
+
+// uploadError is an upload failure carrying the HTTP status and error code
+// to respond with
+type uploadError struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *uploadError) Error() string { return e.msg }
+
+// writeUploadError responds with the status carried by an upload error
+func writeUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var uploadErr *uploadError
+	if errors.As(err, &uploadErr) {
+		writeError(w, r, uploadErr.status, uploadErr.code, uploadErr.msg)
+		return
+	}
+	logger(r).Error("Upload error", "error", err)
+	writeError(w, r, http.StatusInternalServerError, codeInternal, "Error saving uploaded file")
+}
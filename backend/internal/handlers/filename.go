@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+// Longest accepted upload filename in bytes, the common filesystem limit
+const maxFilenameLength = 255
+
+// validateFilename rejects client supplied names that are empty, too long,
+// not UTF-8, or contain path separators or control characters
+func validateFilename(name string) error {
+	invalid := func(reason string) error {
+		return &uploadError{http.StatusBadRequest, codeBadRequest, "Invalid filename: " + reason}
+	}
+
+	switch {
+	case name == "" || name == "." || name == "..":
+		return invalid("name is empty")
+	case len(name) > maxFilenameLength:
+		return invalid(fmt.Sprintf("longer than %d bytes", maxFilenameLength))
+	case !utf8.ValidString(name):
+		return invalid("not valid UTF-8")
+	case strings.ContainsAny(name, `/\`):
+		return invalid("contains a path separator")
+	case strings.IndexFunc(name, unicode.IsControl) >= 0:
+		return invalid("contains control characters")
+	}
+	return nil
+}
+
+// internalFilename generates the name an upload is stored under, so client
+// input never reaches the filesystem. The extension is added once the content
+// has been sniffed.
+func internalFilename() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating filename: %w", err)
+	}
+	return "upload-" + hex.EncodeToString(id), nil
+}
+
+// detectUploadFormat sniffs the format of a saved upload and rejects content
+// that is unsupported or disagrees with the extension of the original name.
+// Names without a known extension, such as "Report v1.2", are accepted as
+// whatever the content is.
+func detectUploadFormat(path, original string) (string, error) {
+	format, err := converter.DetectFormat(path)
+	if err != nil {
+		return "", &uploadError{http.StatusInternalServerError, codeInternal, "Error reading uploaded file"}
+	}
+	if format == "" {
+		return "", &uploadError{http.StatusUnsupportedMediaType, string(converter.CodeUnsupportedFormat), "Unsupported file content"}
+	}
+
+	ext := strings.ToLower(filepath.Ext(original))
+	if known := converter.FormatForExtension(ext); known != "" && known != format {
+		return "", &uploadError{http.StatusUnsupportedMediaType, string(converter.CodeUnsupportedFormat),
+			fmt.Sprintf("File content is %s but the extension is %s", format, ext)}
+	}
+	return format, nil
+}
+
+// downloadFilename replaces the extension of the original upload name with
+// suffix, e.g. "report.docx" and ".pdf" give "report.pdf"
+func downloadFilename(original, suffix string) string {
+	return strings.TrimSuffix(original, filepath.Ext(original)) + suffix
+}
+
+// contentDisposition formats an attachment header per RFC 6266: a quoted
+// ASCII fallback name, plus the UTF-8 name encoded per RFC 5987 when the two
+// differ
+func contentDisposition(filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' || r == '%' {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	value := fmt.Sprintf("attachment; filename=\"%s\"", fallback)
+	if fallback != filename {
+		value += "; filename*=UTF-8''" + encodeRFC5987(filename)
+	}
+	return value
+}
+
+// encodeRFC5987 percent-encodes every byte outside the RFC 5987 attr-char set
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x80 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)) || strings.IndexByte("!#$&+-.^_`|~", c) >= 0) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
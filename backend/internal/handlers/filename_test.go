@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+func TestValidateFilename(t *testing.T) {
+	for _, name := range []string{"report.pdf", "Quarterly report.docx", "résumé.pdf", ".hidden", "a..b.png"} {
+		if err := validateFilename(name); err != nil {
+			t.Errorf("validateFilename(%q): %v", name, err)
+		}
+	}
+
+	for _, name := range []string{
+		"", ".", "..",
+		"../etc/passwd", "dir/file.pdf", `..\windows.pdf`,
+		"bad\x00.pdf", "line\nbreak.pdf",
+		"\xff\xfe.pdf",
+		strings.Repeat("a", maxFilenameLength+1),
+	} {
+		err := validateFilename(name)
+		upload, ok := err.(*uploadError)
+		if !ok || upload.status != http.StatusBadRequest {
+			t.Errorf("validateFilename(%q) = %v, want a 400 upload error", name, err)
+		}
+	}
+}
+
+func TestInternalFilename(t *testing.T) {
+	a, err := internalFilename()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := internalFilename()
+	if a == b || !strings.HasPrefix(a, "upload-") || strings.ContainsAny(a, `./\`) {
+		t.Errorf("internalFilename gave %q and %q", a, b)
+	}
+}
+
+func TestDownloadFilename(t *testing.T) {
+	tests := []struct{ original, suffix, want string }{
+		{"report.docx", ".pdf", "report.pdf"},
+		{"scan.tar.png", "-merged.pdf", "scan.tar-merged.pdf"},
+		{"noext", ".png", "noext.png"},
+	}
+	for _, tt := range tests {
+		if got := downloadFilename(tt.original, tt.suffix); got != tt.want {
+			t.Errorf("downloadFilename(%q, %q) = %q, want %q", tt.original, tt.suffix, got, tt.want)
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct{ filename, want string }{
+		{"report.pdf", `attachment; filename="report.pdf"`},
+		{`say "hi".pdf`, `attachment; filename="say _hi_.pdf"; filename*=UTF-8''say%20%22hi%22.pdf`},
+		{"résumé.pdf", `attachment; filename="r_sum_.pdf"; filename*=UTF-8''r%C3%A9sum%C3%A9.pdf`},
+	}
+	for _, tt := range tests {
+		if got := contentDisposition(tt.filename); got != tt.want {
+			t.Errorf("contentDisposition(%q) = %s, want %s", tt.filename, got, tt.want)
+		}
+	}
+}
+
+func TestDetectUploadFormat(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "upload")
+	svg := "\xef\xbb\xbf<?xml version=\"1.0\"?><svg xmlns=\"http://www.w3.org/2000/svg\"/>"
+	if err := os.WriteFile(file, []byte(svg), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, original := range []string{"logo.svg", "LOGO.SVG", "logo", "logo.exe", "Logo v1.2", "my.logo"} {
+		if format, err := detectUploadFormat(file, original); err != nil || format != converter.FormatSVG {
+			t.Errorf("detectUploadFormat(%q) = %q, %v, want svg", original, format, err)
+		}
+	}
+
+	for _, original := range []string{"logo.png", "logo.PDF", "logo.jpeg"} {
+		_, err := detectUploadFormat(file, original)
+		if upload, ok := err.(*uploadError); !ok || upload.status != http.StatusUnsupportedMediaType {
+			t.Errorf("detectUploadFormat(%q) = %v, want a 415 upload error", original, err)
+		}
+	}
+
+	if err := os.WriteFile(file, []byte("plain text"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := detectUploadFormat(file, "notes")
+	if upload, ok := err.(*uploadError); !ok || upload.status != http.StatusUnsupportedMediaType {
+		t.Errorf("detectUploadFormat of text = %v, want a 415 upload error", err)
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+// Time allowed for an external tool to print its version
+const toolCheckTimeout = 5 * time.Second
+
+// How long readiness probes reuse the last dependency check before running
+// the tools again
+const dependencyCheckTTL = 30 * time.Second
+
+// toolErrors holds the result of the last dependency check: the error of
+// each tool that cannot be run, and when the tools were run
+var toolErrors struct {
+	sync.RWMutex
+	errs    map[converter.Tool]error
+	checked time.Time
+}
+
+// dependencyCheck serializes the checks started by readiness probes, so
+// concurrent probes run the tools once
+var dependencyCheck sync.Mutex
+
+// CheckDependencies runs every external tool once and records which ones
+// work, enabling or disabling the conversions that need them. It returns
+// the error of each tool that cannot be run.
+func CheckDependencies() map[converter.Tool]error {
+	errs := map[converter.Tool]error{}
+	for _, tool := range converter.Tools {
+		if err := converter.CheckTool(cfg.Tools.Converter(), tool, toolCheckTimeout); err != nil {
+			errs[tool] = err
+		}
+	}
+
+	toolErrors.Lock()
+	toolErrors.errs = errs
+	toolErrors.checked = time.Now()
+	toolErrors.Unlock()
+	return errs
+}
+
+// recentDependencies returns the result of the last dependency check, and
+// runs the tools again when it is older than dependencyCheckTTL
+func recentDependencies() map[converter.Tool]error {
+	dependencyCheck.Lock()
+	defer dependencyCheck.Unlock()
+
+	toolErrors.RLock()
+	errs, checked := toolErrors.errs, toolErrors.checked
+	toolErrors.RUnlock()
+	if errs != nil && time.Since(checked) < dependencyCheckTTL {
+		return errs
+	}
+	return CheckDependencies()
+}
+
+// conversionError returns why a conversion is disabled, or nil when every
+// tool it needs passed the last dependency check
+func conversionError(name string) error {
+	toolErrors.RLock()
+	defer toolErrors.RUnlock()
+	for _, conversion := range converter.Conversions {
+		if conversion.Name != name {
+			continue
+		}
+		for _, tool := range conversion.Tools {
+			if err := toolErrors.errs[tool]; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// requireConversion responds with 503 and returns false when a conversion
+// is disabled because a tool it needs is unavailable
+func requireConversion(w http.ResponseWriter, r *http.Request, name string) bool {
+	if err := conversionError(name); err != nil {
+		writeConversionError(w, r, fmt.Sprintf("Conversion %s is unavailable", name), err)
+		return false
+	}
+	return true
+}
+
+// checkTempDir verifies that request work files can be written
+func checkTempDir() error {
+	file, err := os.CreateTemp(cfg.Server.TempDir, "readyz-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString("ok"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// dependencyStatus is the availability of a tool or conversion
+type dependencyStatus struct {
+	Available bool   `json:"available"`
+	Error     string `json:"error,omitempty"`
+}
+
+// readinessResponse is the JSON body of /readyz
+type readinessResponse struct {
+	Status      string                      `json:"status"` // "ready", "degraded" or "unavailable"
+	TempDir     dependencyStatus            `json:"temp_dir"`
+	Tools       map[string]dependencyStatus `json:"tools"`
+	Conversions map[string]dependencyStatus `json:"conversions"`
+}
+
+// newDependencyStatus reports err, or availability when err is nil
+func newDependencyStatus(err error) dependencyStatus {
+	if err != nil {
+		return dependencyStatus{Error: err.Error()}
+	}
+	return dependencyStatus{Available: true}
+}
+
+// Healthz reports that the process is running and serving requests
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Readyz checks that the temp directory is writable and that the external
+// tools run, and reports the availability of every conversion. The tools
+// are run at most once per dependencyCheckTTL. Missing
+// tools only disable the conversions that need them, so the server stays
+// ready with a "degraded" status; an unwritable temp directory fails every
+// conversion and responds with 503.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	tempDirErr := checkTempDir()
+	toolErrs := recentDependencies()
+
+	response := readinessResponse{
+		Status:      "ready",
+		TempDir:     newDependencyStatus(tempDirErr),
+		Tools:       map[string]dependencyStatus{},
+		Conversions: map[string]dependencyStatus{},
+	}
+	for _, tool := range converter.Tools {
+		response.Tools[string(tool)] = newDependencyStatus(toolErrs[tool])
+	}
+	for _, conversion := range converter.Conversions {
+		status := newDependencyStatus(conversionError(conversion.Name))
+		response.Conversions[conversion.Name] = status
+		if !status.Available {
+			response.Status = "degraded"
+		}
+	}
+
+	status := http.StatusOK
+	if tempDirErr != nil {
+		response.Status = "unavailable"
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+// forgetDependencies clears the last dependency check
+func forgetDependencies() {
+	toolErrors.Lock()
+	toolErrors.errs, toolErrors.checked = nil, time.Time{}
+	toolErrors.Unlock()
+}
+
+// probe serves one request to handler and decodes the JSON response
+func probe(t *testing.T, handler http.HandlerFunc, method string, body any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(method, "/", nil))
+	if body != nil && rec.Code != http.StatusMethodNotAllowed {
+		if err := json.NewDecoder(rec.Body).Decode(body); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+	}
+	return rec.Code
+}
+
+func TestHealthz(t *testing.T) {
+	var body map[string]string
+	if code := probe(t, Healthz, http.MethodGet, &body); code != http.StatusOK || body["status"] != "ok" {
+		t.Errorf("GET: status %d, body %v, want 200 ok", code, body)
+	}
+	if code := probe(t, Healthz, http.MethodPost, nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want 405", code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	saved := cfg
+	defer Configure(saved)
+	defer forgetDependencies()
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		name      string
+		tempDir   string
+		pdftotext string
+		code      int
+		status    string
+	}{
+		{"ready", t.TempDir(), "true", http.StatusOK, "ready"},
+		{"tool missing", t.TempDir(), missing, http.StatusOK, "degraded"},
+		{"temp dir missing", missing, "true", http.StatusServiceUnavailable, "unavailable"},
+	}
+	for _, tt := range tests {
+		c := config.Default()
+		c.Server.TempDir = tt.tempDir
+		c.Tools.Pdftotext, c.Tools.Pdftoppm = tt.pdftotext, "true"
+		Configure(c)
+		forgetDependencies()
+
+		var body readinessResponse
+		code := probe(t, Readyz, http.MethodGet, &body)
+		if code != tt.code || body.Status != tt.status {
+			t.Errorf("%s: status %d %q, want %d %q", tt.name, code, body.Status, tt.code, tt.status)
+		}
+		if body.TempDir.Available != (tt.tempDir != missing) {
+			t.Errorf("%s: temp dir %+v", tt.name, body.TempDir)
+		}
+		toolAvailable := tt.pdftotext != missing
+		if got := body.Tools[string(converter.ToolPdftotext)]; got.Available != toolAvailable || !toolAvailable && got.Error == "" {
+			t.Errorf("%s: pdftotext %+v, want available %v", tt.name, got, toolAvailable)
+		}
+		if got := body.Conversions[converter.ConversionPDFToDocx]; got.Available != toolAvailable {
+			t.Errorf("%s: pdf-to-docx %+v, want available %v", tt.name, got, toolAvailable)
+		}
+		if got := body.Conversions[converter.ConversionImageToPDF]; !got.Available {
+			t.Errorf("%s: image-to-pdf %+v, want available", tt.name, got)
+		}
+	}
+
+	if code := probe(t, Readyz, http.MethodPost, nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want 405", code)
+	}
+}
+
+func TestReadyzReusesDependencyCheck(t *testing.T) {
+	saved := cfg
+	defer Configure(saved)
+	defer forgetDependencies()
+	c := config.Default()
+	c.Server.TempDir = t.TempDir()
+	c.Tools.Pdftotext, c.Tools.Pdftoppm = "true", "true"
+	Configure(c)
+	forgetDependencies()
+
+	var body readinessResponse
+	if probe(t, Readyz, http.MethodGet, &body); body.Status != "ready" {
+		t.Fatalf("status %q, want ready", body.Status)
+	}
+
+	// Within the TTL the tools are not run again
+	c.Tools.Pdftotext = filepath.Join(t.TempDir(), "missing")
+	if probe(t, Readyz, http.MethodGet, &body); body.Status != "ready" {
+		t.Errorf("status %q within the TTL, want the cached ready", body.Status)
+	}
+
+	toolErrors.Lock()
+	toolErrors.checked = time.Now().Add(-dependencyCheckTTL)
+	toolErrors.Unlock()
+	if probe(t, Readyz, http.MethodGet, &body); body.Status != "degraded" {
+		t.Errorf("status %q after the TTL, want degraded", body.Status)
+	}
+	if err := conversionError(converter.ConversionPDFToDocx); err == nil {
+		t.Error("pdf-to-docx is still enabled after pdftotext went missing")
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+// Inspect returns the format, dimensions, color model, frame count and EXIF
+// fields of an uploaded image as JSON
+func Inspect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Content-Type must be multipart/form-data")
+		return
+	}
+
+	tempDir, err := newTempDir()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error creating temporary directory")
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	tempFile, _, err := saveUpload(r, tempDir)
+	if err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+	release, ok := startConversion(w, r, sourceFormat(tempFile), "inspect")
+	if !ok {
+		return
+	}
+	defer release()
+
+	info, err := converter.InspectImage(tempFile, converterOptions(r)...)
+	if err != nil {
+		writeConversionError(w, r, "Inspection error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
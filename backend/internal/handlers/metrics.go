@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Label value for a source or target not known when a request fails
+const unknownFormat = "unknown"
+
+// Conversion metrics, labelled by source format and target
+var (
+	conversionRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "reformat_conversion_requests_total",
+		Help: "Conversion requests handled, by source format and target.",
+	}, []string{"source", "target"})
+
+	conversionFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "reformat_conversion_failures_total",
+		Help: "Failed conversion requests, by source format, target and error code.",
+	}, []string{"source", "target", "code"})
+
+	conversionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "reformat_conversion_duration_seconds",
+		Help:    "Time spent handling a conversion request once it got a worker.",
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"source", "target"})
+
+	conversionInputBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "reformat_conversion_input_bytes",
+		Help:    "Size of conversion request bodies.",
+		Buckets: prometheus.ExponentialBuckets(1<<10, 4, 11), // 1KB to 1GB
+	}, []string{"source", "target"})
+
+	conversionOutputBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "reformat_conversion_output_bytes",
+		Help:    "Size of conversion response bodies.",
+		Buckets: prometheus.ExponentialBuckets(1<<10, 4, 11),
+	}, []string{"source", "target"})
+
+	conversionQueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "reformat_conversion_queue_depth",
+		Help: "Conversion requests waiting for a worker.",
+	})
+
+	conversionWorkersActive = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "reformat_conversion_workers_active",
+		Help: "Conversion workers busy with a request.",
+	})
+
+	conversionRejections = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "reformat_conversion_rejections_total",
+		Help: "Conversion requests rejected because no worker became free in time.",
+	})
+
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "reformat_cache_lookups_total",
+		Help: "Result cache lookups, by result: hit or miss.",
+	}, []string{"result"})
+
+	conversionThrottled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "reformat_conversion_throttled_total",
+		Help: "Conversion requests refused by the client rate limit or a per-conversion cap.",
+	}, []string{"reason"})
+)
+
+// metricsRegistry holds the conversion metrics and the Go runtime and
+// process metrics
+var metricsRegistry = prometheus.NewRegistry()
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		conversionRequests,
+		conversionFailures,
+		conversionDuration,
+		conversionInputBytes,
+		conversionOutputBytes,
+		conversionQueueDepth,
+		conversionWorkersActive,
+		conversionRejections,
+		conversionThrottled,
+		cacheLookups,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "reformat_cache_size_bytes",
+			Help: "Bytes of cached conversion results.",
+		}, func() float64 {
+			if resultCache == nil {
+				return 0
+			}
+			size, _ := resultCache.Size()
+			return float64(size)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "reformat_cache_entries",
+			Help: "Cached conversion results.",
+		}, func() float64 {
+			if resultCache == nil {
+				return 0
+			}
+			_, entries := resultCache.Size()
+			return float64(entries)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "reformat_conversion_workers",
+			Help: "Conversion workers configured.",
+		}, func() float64 { return float64(cap(conversionSlots)) }),
+	)
+}
+
+var metricsHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+// Metrics serves the metrics in the Prometheus text format
+func Metrics(w http.ResponseWriter, r *http.Request) {
+	metricsHandler.ServeHTTP(w, r)
+}
+
+// conversionRecord collects the labels and outcome of one conversion
+// request as the handler learns them
+type conversionRecord struct {
+	source string
+	target string
+	code   string // error code of a failed request
+}
+
+type conversionRecordKey struct{}
+
+// labelConversion sets the source format and target reported for the
+// request. Both must come from a fixed set, never straight from the client.
+func labelConversion(r *http.Request, source, target string) {
+	if rec, ok := r.Context().Value(conversionRecordKey{}).(*conversionRecord); ok {
+		rec.source, rec.target = source, target
+	}
+}
+
+// recordFailure notes the error code of a failed conversion request
+func recordFailure(r *http.Request, code string) {
+	if rec, ok := r.Context().Value(conversionRecordKey{}).(*conversionRecord); ok {
+		rec.code = code
+	}
+}
+
+// sourceFormat is the label of a saved upload, named after its content
+func sourceFormat(tempFile string) string {
+	if ext := strings.TrimPrefix(filepath.Ext(tempFile), "."); ext != "" {
+		return ext
+	}
+	return unknownFormat
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter counts the bytes of a response body and keeps its status
+type countingWriter struct {
+	http.ResponseWriter
+	n      int64
+	status int
+}
+
+func (c *countingWriter) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	n, err := c.ResponseWriter.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingWriter) Unwrap() http.ResponseWriter { return c.ResponseWriter }
+
+// InstrumentConversions records the count, failures, duration and sizes of
+// conversion requests, labelled by what the handler reports through
+// labelConversion, and logs a summary of each
+func InstrumentConversions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &conversionRecord{source: unknownFormat, target: unknownFormat}
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		cw := &countingWriter{ResponseWriter: w}
+		r = r.WithContext(context.WithValue(r.Context(), conversionRecordKey{}, rec))
+
+		start := time.Now()
+		next.ServeHTTP(cw, r)
+		duration := time.Since(start)
+
+		conversionRequests.WithLabelValues(rec.source, rec.target).Inc()
+		if rec.code != "" {
+			conversionFailures.WithLabelValues(rec.source, rec.target, rec.code).Inc()
+		}
+		conversionDuration.WithLabelValues(rec.source, rec.target).Observe(duration.Seconds())
+		conversionInputBytes.WithLabelValues(rec.source, rec.target).Observe(float64(body.n))
+		if rec.code == "" {
+			conversionOutputBytes.WithLabelValues(rec.source, rec.target).Observe(float64(cw.n))
+		}
+
+		outcome, level := "success", slog.LevelInfo
+		if rec.code != "" {
+			outcome = rec.code
+			if cw.status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			} else {
+				level = slog.LevelWarn
+			}
+		}
+		logger(r).Log(r.Context(), level, "Conversion finished",
+			"path", r.URL.Path,
+			"source", rec.source,
+			"target", rec.target,
+			"status", cw.status,
+			"outcome", outcome,
+			"input_bytes", body.n,
+			"output_bytes", cw.n,
+			"duration_ms", float64(duration.Microseconds())/1000,
+		)
+	})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// uploadRequest builds a multipart POST of data as the "file" field
+func uploadRequest(t *testing.T, target, filename string, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, target, &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+// testPNG returns an encoded w by h image
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// counterValue reads the current value of a counter
+func counterValue(c prometheus.Counter) float64 {
+	var m dto.Metric
+	c.Write(&m)
+	return m.GetCounter().GetValue()
+}
+
+func TestInstrumentConversionsLabels(t *testing.T) {
+	saved := cfg
+	defer Configure(saved)
+	c := config.Default()
+	c.Server.TempDir = t.TempDir()
+	Configure(c)
+
+	image := testPNG(t, 10, 10)
+	corrupt := append(image[:20:20], "garbage"...)
+	tests := []struct {
+		name           string
+		target         string
+		data           []byte
+		source, format string // expected labels
+		code           string // expected failure code
+	}{
+		{"converted", "/api/convert?to=pdf", image, "png", "pdf", ""},
+		// Labels never come straight from the client
+		{"invalid target", "/api/convert?to=exe", image, unknownFormat, unknownFormat, codeBadRequest},
+		{"corrupt input", "/api/convert?to=pdf", corrupt, "png", "pdf", string(converter.CodeCorruptInput)},
+	}
+	handler := InstrumentConversions(http.HandlerFunc(Convert))
+	for _, tt := range tests {
+		requests := conversionRequests.WithLabelValues(tt.source, tt.format)
+		before := counterValue(requests)
+		failuresBefore := 0.0
+		if tt.code != "" {
+			failuresBefore = counterValue(conversionFailures.WithLabelValues(tt.source, tt.format, tt.code))
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, uploadRequest(t, tt.target, "in.png", tt.data))
+		if (rec.Code == http.StatusOK) != (tt.code == "") {
+			t.Errorf("%s: status %d", tt.name, rec.Code)
+		}
+
+		if got := counterValue(requests) - before; got != 1 {
+			t.Errorf("%s: requests{%s,%s} grew by %v, want 1", tt.name, tt.source, tt.format, got)
+		}
+		if tt.code != "" {
+			failures := conversionFailures.WithLabelValues(tt.source, tt.format, tt.code)
+			if got := counterValue(failures) - failuresBefore; got != 1 {
+				t.Errorf("%s: failures{%s,%s,%s} grew by %v, want 1", tt.name, tt.source, tt.format, tt.code, got)
+			}
+		}
+	}
+
+	// The series are exported with the same labels
+	rec := httptest.NewRecorder()
+	Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, series := range []string{
+		`reformat_conversion_requests_total{source="png",target="pdf"}`,
+		`reformat_conversion_failures_total{code="corrupt_input",source="png",target="pdf"}`,
+		`reformat_conversion_output_bytes_count{source="png",target="pdf"}`,
+		`reformat_conversion_workers `,
+	} {
+		if !strings.Contains(rec.Body.String(), series) {
+			t.Errorf("metrics miss %s", series)
+		}
+	}
+}
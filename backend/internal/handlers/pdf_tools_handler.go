@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+// Suffixes added to the download name of each tool's result
+var pdfToolSuffixes = map[string]string{
+	"merge":    "merged",
+	"split":    "split",
+	"extract":  "extract",
+	"reorder":  "reordered",
+	"rotate":   "rotated",
+	"metadata": "metadata",
+	"encrypt":  "encrypted",
+	"decrypt":  "decrypted",
+}
+
+// PDFTools runs the PDF tool named by the last path segment, e.g.
+// /api/pdf/merge, on the uploaded file or files
+func PDFTools(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Content-Type must be multipart/form-data")
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/api/pdf/")
+	tool, err := converter.GetPDFTool(name)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, codeNotFound, fmt.Sprintf("Unknown PDF tool: %s", name))
+		return
+	}
+	release, ok := startConversion(w, r, "pdf", "pdf-"+name)
+	if !ok {
+		return
+	}
+	defer release()
+
+	query := r.URL.Query()
+	metadata := parsePDFMetadata(query)
+	options := append(converterOptions(r),
+		converter.WithPageRanges(query.Get("pages")),
+		converter.WithPDFMetadata(metadata),
+	)
+	if value := query.Get("angle"); value != "" {
+		angle, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invalid 'angle': must be a multiple of 90")
+			return
+		}
+		options = append(options, converter.WithPageRotation(angle))
+	}
+	byURL, err := parseDelivery(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	tempDir, err := newTempDir()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error creating temporary directory")
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	_, span := traceStage(r, "upload")
+	inputFiles, filename, err := savePDFToolUploads(r, tempDir, name == "merge")
+	endStage(span, err)
+	if err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+
+	switch name {
+	case "split":
+		// Parts are named after the upload, not the name it is stored under
+		options = append(options, converter.WithPartName(filename))
+	case "encrypt":
+		protection, err := parsePDFProtection(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+			return
+		}
+		if protection != nil {
+			options = append(options, converter.WithPDFProtection(*protection))
+		}
+	}
+	// Protected input is opened with input_password, or for decryption
+	// with password as well
+	password := r.PostFormValue("input_password")
+	if password == "" && name == "decrypt" {
+		password = r.PostFormValue("password")
+	}
+	if password != "" {
+		options = append(options, converter.WithInputPassword(password))
+	}
+
+	// Password protected documents are never kept in storage
+	if name == "encrypt" || name == "decrypt" || password != "" {
+		if byURL {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, "delivery=url is not available for password protected documents")
+			return
+		}
+	} else {
+		keepInputs(r, inputFiles...)
+	}
+
+	// Without any fields to set, the metadata tool reports the current values
+	if name == "metadata" && metadata.IsZero() {
+		current, err := converter.ReadPDFMetadata(inputFiles[0], password)
+		if err != nil {
+			writeConversionError(w, r, "Conversion error", err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(current)
+		return
+	}
+
+	ext, contentTypeOut := ".pdf", "application/pdf"
+	if name == "split" {
+		ext, contentTypeOut = ".zip", "application/zip"
+	}
+	outputFile := filepath.Join(tempDir, "result"+ext)
+	ctx, span := traceStage(r, "convert")
+	options = append(options, converter.WithOutputPath(outputFile), converter.WithContext(ctx))
+
+	err = tool.Process(inputFiles, options...)
+	endStage(span, err)
+	if err != nil {
+		writeConversionError(w, r, "Conversion error", err)
+		return
+	}
+
+	deliverOutput(w, r, outputFile, contentTypeOut, downloadFilename(filename, "-"+pdfToolSuffixes[name]+ext), byURL)
+}
+
+// ValidatePDF checks an uploaded PDF against PDF/A and returns the report as
+// JSON. The level query parameter defaults to the level the file claims.
+func ValidatePDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Content-Type must be multipart/form-data")
+		return
+	}
+
+	release, ok := startConversion(w, r, "pdf", "pdfa-validation")
+	if !ok {
+		return
+	}
+	defer release()
+
+	level := r.URL.Query().Get("level")
+	if level != "" {
+		if _, err := converter.ParsePDFALevel(level); err != nil {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, "Invalid 'level': must be 1b or 2b")
+			return
+		}
+	}
+
+	tempDir, err := newTempDir()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error creating temporary directory")
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	_, span := traceStage(r, "upload")
+	tempFile, _, err := saveUpload(r, tempDir)
+	if err == nil {
+		err = requirePDF(tempFile)
+	}
+	endStage(span, err)
+	if err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+
+	_, span = traceStage(r, "convert")
+	report, err := converter.ValidatePDFA(tempFile, level)
+	endStage(span, err)
+	if err != nil {
+		writeConversionError(w, r, "Validation error", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// savePDFToolUploads saves the "files" field for merges, or the "file" field
+// otherwise, and returns the saved paths with the first original filename
+func savePDFToolUploads(r *http.Request, tempDir string, multiple bool) ([]string, string, error) {
+	if !multiple {
+		tempFile, header, err := saveUpload(r, tempDir)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := requirePDF(tempFile); err != nil {
+			return nil, "", err
+		}
+		return []string{tempFile}, header.Filename, nil
+	}
+
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		return nil, "", &uploadError{http.StatusBadRequest, codeBadRequest, "Unable to parse multipart form"}
+	}
+	headers := r.MultipartForm.File["files"]
+	if len(headers) < 2 {
+		return nil, "", &uploadError{http.StatusBadRequest, codeBadRequest, "Merging needs at least two files in 'files'"}
+	}
+	if len(headers) > cfg.Limits.MaxMergeFiles {
+		return nil, "", &uploadError{http.StatusBadRequest, codeBadRequest, fmt.Sprintf("Too many files: maximum is %d", cfg.Limits.MaxMergeFiles)}
+	}
+
+	inputFiles := make([]string, 0, len(headers))
+	for _, header := range headers {
+		// Internal names are unique, so duplicate upload names can't collide
+		tempFile, err := saveFileHeader(header, tempDir)
+		if err != nil {
+			return nil, "", err
+		}
+		if err := requirePDF(tempFile); err != nil {
+			return nil, "", err
+		}
+		inputFiles = append(inputFiles, tempFile)
+	}
+	return inputFiles, headers[0].Filename, nil
+}
+
+// requirePDF rejects saved uploads whose sniffed content is not a PDF
+func requirePDF(tempFile string) error {
+	if filepath.Ext(tempFile) != converter.FormatExtension(converter.FormatPDF) {
+		return &uploadError{http.StatusUnsupportedMediaType, string(converter.CodeUnsupportedFormat), "File content is not a PDF"}
+	}
+	return nil
+}
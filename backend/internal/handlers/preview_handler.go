@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+// Largest preview that can be requested, in pixels
+const maxPreviewDimension = 2048
+
+// Preview returns a PNG thumbnail of an uploaded image, PDF or DOCX.
+// Protected PDFs are opened with the input_password form field.
+func Preview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, r, http.StatusMethodNotAllowed, codeMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if !strings.HasPrefix(contentType, "multipart/form-data") {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "Content-Type must be multipart/form-data")
+		return
+	}
+
+	options := converterOptions(r)
+	if value := r.URL.Query().Get("max"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 || size > maxPreviewDimension {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, fmt.Sprintf("Invalid 'max': must be between 1 and %d", maxPreviewDimension))
+			return
+		}
+		options = append(options, converter.WithPreviewMaxDimension(size))
+	}
+	byURL, err := parseDelivery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, err.Error())
+		return
+	}
+
+	tempDir, err := newTempDir()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error creating temporary directory")
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	_, span := traceStage(r, "upload")
+	tempFile, _, err := saveUpload(r, tempDir)
+	endStage(span, err)
+	if err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+	release, ok := startConversion(w, r, sourceFormat(tempFile), "preview")
+	if !ok {
+		return
+	}
+	defer release()
+
+	switch filepath.Ext(tempFile) {
+	case ".pdf":
+		if !requireConversion(w, r, converter.ConversionPDFPreview) {
+			return
+		}
+	case ".docx":
+		if !requireConversion(w, r, converter.ConversionDocxPreview) {
+			return
+		}
+	}
+
+	// Protected PDFs are opened with input_password and never kept in storage
+	password := r.PostFormValue("input_password")
+	if password != "" {
+		if byURL {
+			writeError(w, r, http.StatusBadRequest, codeBadRequest, "delivery=url is not available for password protected documents")
+			return
+		}
+		options = append(options, converter.WithInputPassword(password))
+	} else {
+		keepInputs(r, tempFile)
+	}
+
+	outputFile := converter.GetOutputFilename(tempFile, "-preview.png")
+	options = append(options, converter.WithOutputPath(outputFile))
+
+	ctx, span := traceStage(r, "convert")
+	err = converter.NewPreviewConverter().GeneratePreview(tempFile, append(options, converter.WithContext(ctx))...)
+	endStage(span, err)
+	if err != nil {
+		writeConversionError(w, r, "Preview error", err)
+		return
+	}
+
+	deliverOutput(w, r, outputFile, "image/png", "", byURL)
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/auth"
+	"github.com/KennyMwendwaX/reformat/internal/ratelimit"
+	"github.com/KennyMwendwaX/reformat/pkg/converter"
+)
+
+// Code of requests refused by the per-client rate limit
+const codeRateLimited = "rate_limited"
+
+// Wait suggested to clients refused because conversions are at capacity
+const busyRetryAfter = 5 * time.Second
+
+// limiter throttles each client, nil when rate limiting is disabled. Set by
+// Configure.
+var limiter *ratelimit.Limiter
+
+// conversionCaps holds one token per conversion of a type running at once,
+// for the types with a configured cap. Set by Configure.
+var conversionCaps = map[string]chan struct{}{}
+
+// configureLimits builds the rate limiter and the per-type caps of the
+// configuration
+func configureLimits() {
+	limiter = nil
+	if cfg.RateLimit.Rate > 0 {
+		limiter = ratelimit.New(cfg.RateLimit.Rate, cfg.RateLimit.Burst)
+	}
+	conversionCaps = map[string]chan struct{}{}
+	for name, n := range cfg.Workers.PerConversion {
+		conversionCaps[name] = make(chan struct{}, n)
+	}
+}
+
+// RateLimit refuses conversion requests of a client that has used up its
+// token bucket with 429 and a Retry-After header. Clients are told apart by
+// API key, or by IP address when the request has none.
+func RateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := limiter
+		if l == nil || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if ok, wait := l.Allow(clientID(r)); !ok {
+			conversionThrottled.WithLabelValues("rate_limit").Inc()
+			w.Header().Set("Retry-After", retryAfter(time.Now().Add(wait)))
+			writeError(w, r, http.StatusTooManyRequests, codeRateLimited, "Too many requests, slow down")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientID names the client of r for rate limiting
+func clientID(r *http.Request) string {
+	if key, ok := r.Context().Value(apiKeyKey{}).(*auth.Key); ok {
+		return "key:" + key.Name
+	}
+	return "ip:" + clientIP(r)
+}
+
+// clientIP is the address of the client of r. Behind a trusted proxy it is
+// the last X-Forwarded-For address, the one the proxy added; earlier ones
+// are set by the client and cannot be trusted.
+func clientIP(r *http.Request) string {
+	if cfg.RateLimit.TrustProxy {
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			hops := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(hops[len(hops)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// startConversion labels the conversion of r, checks that its API key may
+// convert to target and takes a slot of the conversion type when the type
+// is capped. When the request may go on it returns true and a function
+// freeing the slot; otherwise it has responded with 403 or 429.
+func startConversion(w http.ResponseWriter, r *http.Request, source, target string) (func(), bool) {
+	labelConversion(r, source, target)
+	if !allowTarget(w, r, target) {
+		return nil, false
+	}
+
+	name := conversionType(source, target)
+	slots, ok := conversionCaps[name]
+	if !ok {
+		return func() {}, true
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	default:
+		conversionThrottled.WithLabelValues("conversion_cap").Inc()
+		w.Header().Set("Retry-After", retryAfter(time.Now().Add(busyRetryAfter)))
+		writeError(w, r, http.StatusTooManyRequests, codeBusy,
+			fmt.Sprintf("Too many %s conversions in progress, try again later", name))
+		return nil, false
+	}
+}
+
+// conversionType maps the labels of a conversion to its converter.Conversion
+// name, or to none for inspections, which only read headers and are never
+// capped
+func conversionType(source, target string) string {
+	switch {
+	case target == "inspect":
+		return ""
+	case target == "pdf" && source == "docx":
+		return converter.ConversionDocxToPDF
+	case target == "pdf":
+		return converter.ConversionImageToPDF
+	case target == "docx" && source == "pdf":
+		return converter.ConversionPDFToDocx
+	case target == "docx":
+		return converter.ConversionImageToDocx
+	case target == "preview" && source == "pdf":
+		return converter.ConversionPDFPreview
+	case target == "preview" && source == "docx":
+		return converter.ConversionDocxPreview
+	case target == "preview":
+		return converter.ConversionImagePreview
+	case strings.HasPrefix(target, "contact-sheet-"):
+		return converter.ConversionContactSheet
+	case target == "pdfa-validation":
+		return converter.ConversionPDFAValidation
+	case strings.HasPrefix(target, "pdf-"):
+		return converter.ConversionPDFTools
+	}
+	return converter.ConversionImageToImage
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+
+	"github.com/KennyMwendwaX/reformat/internal/auth"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header carrying the request ID in both directions
+const requestIDHeader = "X-Request-ID"
+
+// Longest client supplied request ID that is kept
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID tags each request with the ID from its X-Request-ID header, or
+// a generated one, and echoes it in the response so clients can quote it
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// requestID returns the ID assigned to r by RequestID
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// logger returns the default logger with the request ID of r attached, and
+// the API key name and trace ID when the request has them
+func logger(r *http.Request) *slog.Logger {
+	l := slog.Default().With("request_id", requestID(r))
+	if key, ok := r.Context().Value(apiKeyKey{}).(*auth.Key); ok {
+		l = l.With("api_key", key.Name)
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+		l = l.With("trace_id", sc.TraceID().String())
+	}
+	return l
+}
+
+// validRequestID accepts short IDs made of letters, digits and the
+// punctuation used by common ID formats, so IDs are safe to log and echo
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random 128-bit ID in hex
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDHeader(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	tests := []struct {
+		name string
+		sent string
+		kept bool
+	}{
+		{"uuid", "3f2b8c1e-9d4a-4f6b-8e2a-1c5d7b9e0f12", true},
+		{"punctuation", "trace:abc_1.2", true},
+		{"longest", strings.Repeat("a", maxRequestIDLength), true},
+		{"none", "", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"spaces", "a b", false},
+		{"log injection", "abc\nlevel=ERROR", false},
+		{"markup", "<script>", false},
+	}
+	for _, tt := range tests {
+		var seen string
+		handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = requestID(r)
+		}))
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.sent != "" {
+			r.Header.Set(requestIDHeader, tt.sent)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+
+		echoed := rec.Header().Get(requestIDHeader)
+		if echoed != seen {
+			t.Errorf("%s: echoed %q, handler saw %q", tt.name, echoed, seen)
+		}
+		if tt.kept && echoed != tt.sent {
+			t.Errorf("%s: echoed %q, want the sent ID", tt.name, echoed)
+		}
+		if !tt.kept && !generated.MatchString(echoed) {
+			t.Errorf("%s: echoed %q, want a generated ID", tt.name, echoed)
+		}
+	}
+
+	// Generated IDs differ between requests
+	ids := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		RequestID(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		ids[rec.Header().Get(requestIDHeader)] = true
+	}
+	if len(ids) != 3 {
+		t.Errorf("generated IDs repeat: %v", ids)
+	}
+}
+
+func TestRequestIDPropagation(t *testing.T) {
+	var logs bytes.Buffer
+	savedLogger := slog.Default()
+	defer slog.SetDefault(savedLogger)
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	handler := RequestID(InstrumentConversions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		labelConversion(r, "png", "pdf")
+		writeError(w, r, http.StatusBadRequest, codeBadRequest, "bad")
+	})))
+	r := httptest.NewRequest(http.MethodPost, "/api/convert", nil)
+	r.Header.Set(requestIDHeader, "req-42")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	var body errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.RequestID != "req-42" || rec.Header().Get(requestIDHeader) != "req-42" {
+		t.Errorf("error body ID %q, header %q, want req-42 in both", body.RequestID, rec.Header().Get(requestIDHeader))
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("log %q: %v", logs.String(), err)
+	}
+	want := map[string]any{"msg": "Conversion finished", "request_id": "req-42", "outcome": codeBadRequest, "level": "WARN"}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("log %s = %v, want %v", key, record[key], value)
+		}
+	}
+}
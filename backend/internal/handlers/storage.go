@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/cache"
+	"github.com/KennyMwendwaX/reformat/internal/storage"
+)
+
+// Storage key prefixes of kept uploads and of results outside the cache.
+// Objects under them are removed by SweepStorage after the retention time.
+const (
+	inputPrefix  = "inputs/"
+	outputPrefix = "outputs/"
+)
+
+// fileStore keeps uploads and results beyond their request, where every
+// replica can serve them. Set by OpenStorage.
+var fileStore storage.Store
+
+// OpenStorage opens the configured storage, and the result cache in it when
+// caching is enabled. It must be called after Configure and before the
+// server starts.
+func OpenStorage(ctx context.Context) error {
+	fileStore, resultCache = nil, nil
+	store, err := storage.New(ctx, cfg.Storage, cfg.Cache.Path())
+	if err != nil {
+		return err
+	}
+	fileStore = store
+	if !cfg.Cache.Enabled {
+		return nil
+	}
+	resultCache, err = cache.Open(ctx, store, int64(cfg.Cache.MaxSize))
+	return err
+}
+
+// SweepStorage removes kept uploads and uncached results older than the
+// retention time and returns how many it removed. Cached results are left
+// to the cache's own eviction.
+func SweepStorage(ctx context.Context) (int, error) {
+	cutoff := time.Now().Add(-cfg.Storage.Retention)
+	removed := 0
+	var errs []error
+	for _, prefix := range []string{inputPrefix, outputPrefix} {
+		objects, err := fileStore.List(ctx, prefix)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, obj := range objects {
+			if !obj.ModTime.Before(cutoff) {
+				continue
+			}
+			if err := fileStore.Delete(ctx, obj.Key); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			removed++
+		}
+	}
+	return removed, errors.Join(errs...)
+}
+
+// storeFile copies file into storage under prefix and a random name with
+// the file's extension, and returns its key
+func storeFile(ctx context.Context, prefix, file string, header map[string]string) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating storage key: %w", err)
+	}
+	key := prefix + hex.EncodeToString(id) + strings.ToLower(filepath.Ext(file))
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if err := fileStore.Put(ctx, key, f, info.Size(), header); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// keepInputs copies the uploads of r into storage when keep_inputs is set.
+// Failures are logged and do not fail the request. Uploads of requests
+// with passwords are never kept.
+func keepInputs(r *http.Request, files ...string) {
+	if !cfg.Storage.KeepInputs {
+		return
+	}
+	ctx, span := traceStage(r, "store")
+	defer endStage(span, nil)
+	for _, file := range files {
+		contentType := getContentType(strings.TrimPrefix(filepath.Ext(file), "."))
+		key, err := storeFile(ctx, inputPrefix, file, map[string]string{"Content-Type": contentType})
+		if err != nil {
+			logger(r).Warn("Error keeping upload", "error", err)
+			continue
+		}
+		logger(r).Debug("Kept upload", "key", key)
+	}
+}
+
+// deliverOutput responds with a result that is not cached: in the response
+// body, or when byURL is set, as a presigned URL to a copy kept in storage
+// for the retention time
+func deliverOutput(w http.ResponseWriter, r *http.Request, outputFile, contentType, filename string, byURL bool) {
+	if !byURL {
+		sendOutput(w, r, outputFile, contentType, filename)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	ctx, span := traceStage(r, "store")
+	key, err := storeFile(ctx, outputPrefix, outputFile, map[string]string{"Content-Type": contentType})
+	endStage(span, err)
+	if err != nil {
+		logger(r).Error("Error storing conversion result", "error", err)
+		writeError(w, r, http.StatusInternalServerError, codeInternal, "Error storing converted file")
+		return
+	}
+	respondURL(w, r, key, "", filename)
+}
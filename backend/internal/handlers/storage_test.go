@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+	"github.com/KennyMwendwaX/reformat/internal/storage"
+)
+
+func TestSweepStorage(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewLocal(dir, []byte("secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, savedStore := cfg.Storage.Retention, fileStore
+	defer func() { cfg.Storage.Retention, fileStore = saved, savedStore }()
+	cfg.Storage.Retention = time.Hour
+	fileStore = store
+
+	ctx := context.Background()
+	old := time.Now().Add(-2 * time.Hour)
+	for _, key := range []string{"inputs/old.png", "inputs/new.png", "outputs/old.pdf", "outputs/new.pdf", "results/old"} {
+		if err := store.Put(ctx, key, strings.NewReader("x"), 1, nil); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(key, "old") {
+			os.Chtimes(filepath.Join(dir, filepath.FromSlash(key)), old, old)
+		}
+	}
+
+	removed, err := SweepStorage(ctx)
+	if err != nil || removed != 2 {
+		t.Fatalf("SweepStorage = %d, %v, want 2 removed", removed, err)
+	}
+	for key, kept := range map[string]bool{
+		"inputs/old.png": false, "inputs/new.png": true,
+		"outputs/old.pdf": false, "outputs/new.pdf": true,
+		"results/old": true, // evicted by the cache, not by age
+	} {
+		_, _, err := store.Get(ctx, key)
+		if (err == nil) != kept {
+			t.Errorf("%s: Get error %v, want kept %v", key, err, kept)
+		}
+	}
+}
+
+func TestConvertKeepsEveryUpload(t *testing.T) {
+	saved, savedStore := cfg, fileStore
+	defer func() { Configure(saved); fileStore = savedStore }()
+	c := config.Default()
+	c.Server.TempDir = t.TempDir()
+	c.Storage.KeepInputs = true
+	Configure(c)
+	store, err := storage.NewLocal(t.TempDir(), []byte("secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileStore = store
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for field, data := range map[string][]byte{"file": testPNG(t, 10, 10), "watermark_image": testPNG(t, 4, 4)} {
+		part, err := mw.CreateFormFile(field, field+".png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(data)
+	}
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/api/convert?to=pdf", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	Convert(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	objects, err := store.List(context.Background(), inputPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Errorf("kept %d uploads, want the file and the watermark image", len(objects))
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	spanRecorder     = tracetest.NewSpanRecorder()
+	spanRecorderOnce sync.Once
+)
+
+// recordSpans installs a tracer provider recording every span and the W3C
+// propagator, and returns a function listing the spans ended since it was
+// last called. The global provider can only be replaced once, so all tests
+// share it.
+func recordSpans(t *testing.T) func() []sdktrace.ReadOnlySpan {
+	spanRecorderOnce.Do(func() {
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spanRecorder)))
+	})
+	saved := otel.GetTextMapPropagator()
+	t.Cleanup(func() { otel.SetTextMapPropagator(saved) })
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	seen := len(spanRecorder.Ended())
+	return func() []sdktrace.ReadOnlySpan {
+		ended := spanRecorder.Ended()
+		spans := ended[seen:]
+		seen = len(ended)
+		return spans
+	}
+}
+
+// spanAttribute returns the value of a span attribute, or nil
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) any {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value.AsInterface()
+		}
+	}
+	return nil
+}
+
+func TestTraceConversion(t *testing.T) {
+	saved := cfg
+	defer Configure(saved)
+	c := config.Default()
+	c.Server.TempDir = t.TempDir()
+	Configure(c)
+	endedSpans := recordSpans(t)
+
+	var logs bytes.Buffer
+	savedLogger := slog.Default()
+	defer slog.SetDefault(savedLogger)
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/convert", InstrumentConversions(http.HandlerFunc(Convert)))
+	handler := RequestID(Trace(mux))
+
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	r := uploadRequest(t, "/api/convert?to=pdf", "in.png", testPNG(t, 10, 10))
+	r.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	r.Header.Set(requestIDHeader, "req-7")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range endedSpans() {
+		spans[span.Name()] = span
+	}
+	server, ok := spans["POST /api/convert"]
+	if !ok {
+		t.Fatalf("no server span named after the route in %v", spans)
+	}
+	if got := server.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("trace ID %s, want the one from traceparent", got)
+	}
+	if got := server.Parent().SpanID().String(); got != parentID || !server.Parent().IsRemote() {
+		t.Errorf("server span parent %s, want the remote %s", got, parentID)
+	}
+	for key, want := range map[attribute.Key]any{
+		"request.id":                "req-7",
+		"http.route":                "/api/convert",
+		"http.response.status_code": int64(http.StatusOK),
+	} {
+		if got := spanAttribute(server, key); got != want {
+			t.Errorf("server span %s = %v, want %v", key, got, want)
+		}
+	}
+
+	// The handler stages hang off the server span, and the converter's
+	// stages off the convert stage
+	for _, stage := range []string{"handler.upload", "handler.convert", "handler.respond"} {
+		span, ok := spans[stage]
+		if !ok {
+			t.Errorf("no %s span", stage)
+			continue
+		}
+		if span.Parent().SpanID() != server.SpanContext().SpanID() {
+			t.Errorf("%s is not a child of the server span", stage)
+		}
+	}
+	nested := 0
+	for name, span := range spans {
+		if strings.HasPrefix(name, "converter.") {
+			nested++
+			if span.Parent().SpanID() != spans["handler.convert"].SpanContext().SpanID() {
+				t.Errorf("%s is not a child of handler.convert", name)
+			}
+		}
+	}
+	if nested == 0 {
+		t.Error("no converter spans")
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("log %q: %v", logs.String(), err)
+	}
+	if record["trace_id"] != traceID || record["request_id"] != "req-7" {
+		t.Errorf("log trace_id %v, request_id %v, want %s and req-7", record["trace_id"], record["request_id"], traceID)
+	}
+}
+
+func TestTraceStatus(t *testing.T) {
+	endedSpans := recordSpans(t)
+	tests := []struct {
+		status int
+		code   codes.Code
+	}{
+		{http.StatusOK, codes.Unset},
+		{http.StatusBadRequest, codes.Unset},
+		{http.StatusInternalServerError, codes.Error},
+		{http.StatusServiceUnavailable, codes.Error},
+	}
+	for _, tt := range tests {
+		handler := Trace(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, span := traceStage(r, "convert")
+			endStage(span, nil)
+			w.WriteHeader(tt.status)
+			w.WriteHeader(http.StatusTeapot) // ignored, the status is sent
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unrouted", nil))
+
+		spans := endedSpans()
+		if len(spans) != 2 {
+			t.Fatalf("%d: %d spans, want the stage and the server span", tt.status, len(spans))
+		}
+		server := spans[1]
+		if server.Name() != http.MethodGet || spanAttribute(server, "http.route") != nil {
+			t.Errorf("%d: unrouted span %q has a route", tt.status, server.Name())
+		}
+		if got := spanAttribute(server, "http.response.status_code"); got != int64(tt.status) {
+			t.Errorf("%d: status attribute %v", tt.status, got)
+		}
+		if got := server.Status().Code; got != tt.code {
+			t.Errorf("%d: span status %s, want %s", tt.status, got, tt.code)
+		}
+	}
+}
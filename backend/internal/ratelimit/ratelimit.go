@@ -0,0 +1,79 @@
+// Package ratelimit throttles clients with a token bucket each.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Buckets idle longer than this past being full are forgotten
+const idleTimeout = time.Minute
+
+// Limiter gives each client a bucket of burst tokens refilled at rate
+// tokens per second. Each request takes one token.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a limiter allowing rate requests per second per client, in
+// bursts of up to burst requests
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the bucket of client. When the bucket is empty
+// it returns false and how long until a token is available.
+func (l *Limiter) Allow(client string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets the buckets that have refilled and stayed idle, at most
+// once per idleTimeout, so the map does not grow with every client seen.
+// The caller holds mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < idleTimeout {
+		return
+	}
+	l.lastSweep = now
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.last) > refill+idleTimeout {
+			delete(l.buckets, client)
+		}
+	}
+}
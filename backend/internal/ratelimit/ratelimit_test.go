@@ -0,0 +1,54 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		at     time.Duration // since start
+		client string
+		ok     bool
+		wait   time.Duration
+	}{
+		{"burst 1", 0, "a", true, 0},
+		{"burst 2", 0, "a", true, 0},
+		{"empty", 0, "a", false, 500 * time.Millisecond},
+		{"other client", 0, "b", true, 0},
+		{"half refilled", 250 * time.Millisecond, "a", false, 250 * time.Millisecond},
+		{"refilled", 500 * time.Millisecond, "a", true, 0},
+		{"empty again", 500 * time.Millisecond, "a", false, 500 * time.Millisecond},
+		{"capped at burst 1", 10 * time.Second, "a", true, 0},
+		{"capped at burst 2", 10 * time.Second, "a", true, 0},
+		{"capped at burst 3", 10 * time.Second, "a", false, 500 * time.Millisecond},
+	}
+
+	l := New(2, 2)
+	for _, tt := range tests {
+		l.now = func() time.Time { return start.Add(tt.at) }
+		ok, wait := l.Allow(tt.client)
+		if ok != tt.ok || wait != tt.wait {
+			t.Errorf("%s: Allow = %v, %s, want %v, %s", tt.name, ok, wait, tt.ok, tt.wait)
+		}
+	}
+}
+
+func TestSweepForgetsIdleBuckets(t *testing.T) {
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	l := New(1, 5)
+	l.now = func() time.Time { return start }
+	l.Allow("idle")
+
+	// Refilled after 5s, then idle for longer than idleTimeout
+	l.now = func() time.Time { return start.Add(5*time.Second + idleTimeout + time.Second) }
+	l.Allow("active")
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("idle bucket was not forgotten")
+	}
+	if _, ok := l.buckets["active"]; !ok {
+		t.Error("active bucket was forgotten")
+	}
+}
@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Path under which the server serves presigned local downloads
+const DownloadPath = "/api/files/"
+
+// Suffix of the file holding the headers of an object
+const headerSuffix = ".header.json"
+
+// Prefix of files being written
+const tempPrefix = ".tmp-"
+
+// Age after which a file being written, or headers without their object,
+// are taken as left by an interrupted write. Younger ones may belong to a
+// Put running on another replica.
+const staleTempAge = time.Hour
+
+// Errors of presigned local download URLs
+var (
+	ErrURLExpired   = errors.New("download URL has expired")
+	ErrURLSignature = errors.New("download URL signature is invalid")
+)
+
+// Local keeps objects as files under a directory. Its presigned URLs point
+// at DownloadPath on this server and are signed with an HMAC key, which
+// replicas sharing the directory must share too.
+type Local struct {
+	dir       string
+	secret    []byte
+	publicURL string
+}
+
+// NewLocal returns a store in dir, creating it if needed. Download URLs are
+// signed with secret, random when empty, and start with publicURL, or are
+// relative to the server when it is empty.
+func NewLocal(dir string, secret []byte, publicURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating storage directory: %w", err)
+	}
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &Local{dir: dir, secret: secret, publicURL: strings.TrimSuffix(publicURL, "/")}, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
+
+func (l *Local) Put(ctx context.Context, key string, body io.Reader, size int64, header map[string]string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	written, err := io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written != size {
+		err = fmt.Errorf("wrote %d bytes of %d", written, size)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The headers go first, so every object on disk has them
+	data, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+headerSuffix, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, Object{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Object{}, err
+	}
+	obj, err := l.stat(key, path)
+	if err != nil {
+		f.Close()
+		return nil, Object{}, err
+	}
+	return f, obj, nil
+}
+
+func (l *Local) Delete(ctx context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(path + headerSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// List walks the whole directory. Files left by interrupted writes more
+// than staleTempAge ago are removed on the way.
+func (l *Local) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	err := filepath.WalkDir(l.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(l.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		switch {
+		case strings.HasPrefix(d.Name(), tempPrefix):
+			if stale(d) {
+				os.Remove(path)
+			}
+			return nil
+		case strings.HasSuffix(key, headerSuffix):
+			if _, err := os.Stat(strings.TrimSuffix(path, headerSuffix)); errors.Is(err, fs.ErrNotExist) && stale(d) {
+				os.Remove(path)
+			}
+			return nil
+		case !strings.HasPrefix(key, prefix) || !validKey(key):
+			return nil
+		}
+		obj, err := l.stat(key, path)
+		if err != nil {
+			return nil // removed meanwhile, or has no headers
+		}
+		objects = append(objects, obj)
+		return nil
+	})
+	return objects, err
+}
+
+// stale reports whether a file was last written more than staleTempAge ago
+func stale(d fs.DirEntry) bool {
+	info, err := d.Info()
+	return err == nil && time.Since(info.ModTime()) > staleTempAge
+}
+
+func (l *Local) stat(key, path string) (Object, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Object{}, err
+	}
+	data, err := os.ReadFile(path + headerSuffix)
+	if err != nil {
+		return Object{}, err
+	}
+	var header map[string]string
+	if err := json.Unmarshal(data, &header); err != nil {
+		return Object{}, err
+	}
+	return Object{Key: key, Size: info.Size(), ModTime: info.ModTime(), Header: header}, nil
+}
+
+// PresignGet returns a URL under DownloadPath carrying its expiry time and
+// an HMAC of the key, expiry and filename
+func (l *Local) PresignGet(ctx context.Context, key string, opts URLOptions) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	expires := strconv.FormatInt(time.Now().Add(opts.Expires).Unix(), 10)
+	query := url.Values{"expires": {expires}, "signature": {hex.EncodeToString(l.mac(key, expires, opts.Filename))}}
+	if opts.Filename != "" {
+		query.Set("filename", opts.Filename)
+	}
+	return l.publicURL + DownloadPath + key + "?" + query.Encode(), nil
+}
+
+// Verify checks the signature and expiry of a download URL made by
+// PresignGet, given the key from its path and its query. It returns the
+// download name.
+func (l *Local) Verify(key string, query url.Values) (string, error) {
+	expires, filename := query.Get("expires"), query.Get("filename")
+	given, err := hex.DecodeString(query.Get("signature"))
+	if err != nil || !hmac.Equal(given, l.mac(key, expires, filename)) {
+		return "", ErrURLSignature
+	}
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return "", ErrURLExpired
+	}
+	return filename, nil
+}
+
+func (l *Local) mac(key, expires, filename string) []byte {
+	mac := hmac.New(sha256.New, l.secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s", key, expires, filename)
+	return mac.Sum(nil)
+}
+
+// validKey accepts slash separated paths of letters, digits, dashes,
+// underscores and dots, without empty, "." or ".." elements or the names
+// of the files Local keeps beside its objects
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." || strings.HasPrefix(part, tempPrefix) ||
+			strings.HasSuffix(part, headerSuffix) {
+			return false
+		}
+		for _, c := range part {
+			switch {
+			case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+			case c == '-', c == '_', c == '.':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
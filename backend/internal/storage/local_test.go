@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalListKeepsRecentTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocal(dir, []byte("secret"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := store.Put(ctx, "results/a", strings.NewReader("abc"), 3, map[string]string{"Content-Type": "text/plain"}); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * staleTempAge)
+	files := map[string]bool{ // name: removed by List
+		tempPrefix + "recent":      false,
+		tempPrefix + "old":         true,
+		"results/b" + headerSuffix: false, // a Put in progress elsewhere
+		"results/c" + headerSuffix: true,
+		"results/a" + headerSuffix: false,
+	}
+	for name, removed := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if name != "results/a"+headerSuffix {
+			if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if removed {
+			os.Chtimes(path, old, old)
+		}
+	}
+
+	objects, err := store.List(ctx, "results/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 1 || objects[0].Key != "results/a" || objects[0].Size != 3 || objects[0].Header["Content-Type"] != "text/plain" {
+		t.Errorf("List = %+v, want results/a only", objects)
+	}
+	for name, removed := range files {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		if (err != nil) != removed {
+			t.Errorf("%s: stat error %v, want removed %v", name, err, removed)
+		}
+	}
+}
+
+func TestLocalVerify(t *testing.T) {
+	store, err := NewLocal(t.TempDir(), []byte("secret"), "https://files.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewLocal(t.TempDir(), []byte("other"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	presign := func(key string, opts URLOptions) url.Values {
+		raw, err := store.PresignGet(context.Background(), key, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "https://files.example.com" + DownloadPath + key; u.Scheme+"://"+u.Host+u.Path != want {
+			t.Errorf("PresignGet = %s, want a URL under %s", raw, want)
+		}
+		return u.Query()
+	}
+
+	tests := []struct {
+		name     string
+		verifier *Local
+		key      string
+		query    func() url.Values
+		filename string
+		err      error
+	}{
+		{"valid", store, "outputs/a.pdf", func() url.Values {
+			return presign("outputs/a.pdf", URLOptions{Expires: time.Hour, Filename: "report.pdf"})
+		}, "report.pdf", nil},
+		{"no filename", store, "outputs/a.pdf", func() url.Values {
+			return presign("outputs/a.pdf", URLOptions{Expires: time.Hour})
+		}, "", nil},
+		{"other key", store, "outputs/b.pdf", func() url.Values {
+			return presign("outputs/a.pdf", URLOptions{Expires: time.Hour})
+		}, "", ErrURLSignature},
+		{"changed filename", store, "outputs/a.pdf", func() url.Values {
+			q := presign("outputs/a.pdf", URLOptions{Expires: time.Hour, Filename: "report.pdf"})
+			q.Set("filename", "other.pdf")
+			return q
+		}, "", ErrURLSignature},
+		{"extended expiry", store, "outputs/a.pdf", func() url.Values {
+			q := presign("outputs/a.pdf", URLOptions{Expires: time.Hour})
+			q.Set("expires", strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10))
+			return q
+		}, "", ErrURLSignature},
+		{"bad signature", store, "outputs/a.pdf", func() url.Values {
+			q := presign("outputs/a.pdf", URLOptions{Expires: time.Hour})
+			q.Set("signature", "not hex")
+			return q
+		}, "", ErrURLSignature},
+		{"other secret", other, "outputs/a.pdf", func() url.Values {
+			return presign("outputs/a.pdf", URLOptions{Expires: time.Hour})
+		}, "", ErrURLSignature},
+		{"expired", store, "outputs/a.pdf", func() url.Values {
+			return presign("outputs/a.pdf", URLOptions{Expires: -time.Minute})
+		}, "", ErrURLExpired},
+	}
+
+	for _, tt := range tests {
+		filename, err := tt.verifier.Verify(tt.key, tt.query())
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+		}
+		if filename != tt.filename {
+			t.Errorf("%s: filename = %q, want %q", tt.name, filename, tt.filename)
+		}
+	}
+}
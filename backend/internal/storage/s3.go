@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+)
+
+// S3 keeps objects in a bucket of an S3-compatible service such as AWS S3
+// or MinIO. Its presigned URLs point at the service itself.
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3 connects to the bucket of c and checks that it exists. Without
+// configured keys the credentials come from the AWS_ or MINIO_ environment
+// variables, or the instance role on AWS.
+func NewS3(ctx context.Context, c config.S3Config) (*S3, error) {
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint: %w", err)
+	}
+	creds := credentials.NewStaticV4(c.AccessKey, c.SecretKey, "")
+	if c.AccessKey == "" {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		})
+	}
+	lookup := minio.BucketLookupAuto
+	if c.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(endpoint.Host, &minio.Options{
+		Creds:        creds,
+		Secure:       endpoint.Scheme == "https",
+		Region:       c.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating S3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, c.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("error checking S3 bucket %s: %w", c.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("S3 bucket %s does not exist", c.Bucket)
+	}
+	prefix := strings.Trim(c.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3{client: client, bucket: c.Bucket, prefix: prefix}, nil
+}
+
+func (s *S3) name(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return s.prefix + key, nil
+}
+
+// Put keeps the Content-Type header as the content type of the object and
+// the other headers as user metadata
+func (s *S3) Put(ctx context.Context, key string, body io.Reader, size int64, header map[string]string) error {
+	name, err := s.name(key)
+	if err != nil {
+		return err
+	}
+	opts := minio.PutObjectOptions{UserMetadata: map[string]string{}}
+	for field, value := range header {
+		if http.CanonicalHeaderKey(field) == "Content-Type" {
+			opts.ContentType = value
+		} else {
+			opts.UserMetadata[field] = value
+		}
+	}
+	_, err = s.client.PutObject(ctx, s.bucket, name, body, size, opts)
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	name, err := s.name(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, Object{}, s.error(err)
+	}
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, Object{}, s.error(err)
+	}
+	header := map[string]string{}
+	for field, value := range info.UserMetadata {
+		header[http.CanonicalHeaderKey(field)] = value
+	}
+	if info.ContentType != "" {
+		header["Content-Type"] = info.ContentType
+	}
+	return obj, Object{Key: key, Size: info.Size, ModTime: info.LastModified, Header: header}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	name, err := s.name(key)
+	if err != nil {
+		return err
+	}
+	return s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{})
+}
+
+// List leaves out the headers, which S3 does not list
+func (s *S3) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	for info := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix + prefix,
+		Recursive: true,
+	}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+		key := strings.TrimPrefix(info.Key, s.prefix)
+		if validKey(key) {
+			objects = append(objects, Object{Key: key, Size: info.Size, ModTime: info.LastModified})
+		}
+	}
+	return objects, nil
+}
+
+// PresignGet signs a GET of the object with the service credentials,
+// overriding the download name when one is given
+func (s *S3) PresignGet(ctx context.Context, key string, opts URLOptions) (string, error) {
+	name, err := s.name(key)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	if opts.Filename != "" {
+		params.Set("response-content-disposition",
+			mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(opts.Filename)}))
+	}
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, name, opts.Expires, params)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// error maps a missing object to ErrNotFound
+func (s *S3) error(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+)
+
+// newTestS3 connects to the MinIO or S3 service named by
+// REFORMAT_TEST_S3_ENDPOINT, skipping the test when it is unset, and returns
+// a store under a prefix of its own
+func newTestS3(t *testing.T) *S3 {
+	t.Helper()
+	endpoint := os.Getenv("REFORMAT_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("REFORMAT_TEST_S3_ENDPOINT is not set")
+	}
+	bucket := os.Getenv("REFORMAT_TEST_S3_BUCKET")
+	if bucket == "" {
+		bucket = "reformat"
+	}
+	id := make([]byte, 6)
+	rand.Read(id)
+
+	store, err := NewS3(context.Background(), config.S3Config{
+		Endpoint:  endpoint,
+		Region:    os.Getenv("REFORMAT_TEST_S3_REGION"),
+		Bucket:    bucket,
+		Prefix:    "test-" + hex.EncodeToString(id),
+		AccessKey: os.Getenv("REFORMAT_TEST_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("REFORMAT_TEST_S3_SECRET_KEY"),
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		objects, _ := store.List(context.Background(), "")
+		for _, obj := range objects {
+			store.Delete(context.Background(), obj.Key)
+		}
+	})
+	return store
+}
+
+func TestS3(t *testing.T) {
+	store := newTestS3(t)
+	ctx := context.Background()
+
+	objects := []struct {
+		key, body string
+		header    map[string]string
+	}{
+		{"results/a", "first", map[string]string{"Content-Type": "application/pdf", "X-Image-Quality": "80"}},
+		{"results/b", "second!", nil},
+		{"outputs/c.png", "third", map[string]string{"Content-Type": "image/png"}},
+	}
+	for _, obj := range objects {
+		if err := store.Put(ctx, obj.key, strings.NewReader(obj.body), int64(len(obj.body)), obj.header); err != nil {
+			t.Fatalf("Put %s: %v", obj.key, err)
+		}
+	}
+
+	for _, obj := range objects {
+		body, info, err := store.Get(ctx, obj.key)
+		if err != nil {
+			t.Errorf("Get %s: %v", obj.key, err)
+			continue
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if string(data) != obj.body || info.Key != obj.key || info.Size != int64(len(obj.body)) {
+			t.Errorf("Get %s = %q, %+v", obj.key, data, info)
+		}
+		for field, value := range obj.header {
+			if info.Header[field] != value {
+				t.Errorf("Get %s: header %s = %q, want %q", obj.key, field, info.Header[field], value)
+			}
+		}
+	}
+
+	listed, err := store.List(ctx, "results/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, obj := range listed {
+		keys = append(keys, obj.Key)
+		if obj.ModTime.IsZero() || time.Since(obj.ModTime) > time.Hour {
+			t.Errorf("List %s: modification time %s", obj.Key, obj.ModTime)
+		}
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "results/a,results/b" {
+		t.Errorf("List results/ = %q, want results/a and results/b", keys)
+	}
+
+	if err := store.Delete(ctx, "results/a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Get(ctx, "results/a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "results/missing"); err != nil {
+		t.Errorf("Delete of a missing object: %v", err)
+	}
+	if err := store.Put(ctx, "../escape", strings.NewReader("x"), 1, nil); err == nil {
+		t.Error("Put accepted an invalid key")
+	}
+}
+
+func TestS3PresignGet(t *testing.T) {
+	store := newTestS3(t)
+	ctx := context.Background()
+	if err := store.Put(ctx, "outputs/c.png", strings.NewReader("image"), 5, map[string]string{"Content-Type": "image/png"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		key         string
+		opts        URLOptions
+		status      int
+		disposition string
+	}{
+		{"download", "outputs/c.png", URLOptions{Expires: time.Minute, Filename: "photo.png"}, http.StatusOK, `attachment; filename=photo.png`},
+		{"no filename", "outputs/c.png", URLOptions{Expires: time.Minute}, http.StatusOK, ""},
+		{"missing object", "outputs/missing.png", URLOptions{Expires: time.Minute}, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		u, err := store.PresignGet(ctx, tt.key, tt.opts)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		resp, err := http.Get(u)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+			continue
+		}
+		if tt.status == http.StatusOK {
+			if string(data) != "image" || resp.Header.Get("Content-Type") != "image/png" {
+				t.Errorf("%s: got %q as %s", tt.name, data, resp.Header.Get("Content-Type"))
+			}
+			if got := resp.Header.Get("Content-Disposition"); got != tt.disposition {
+				t.Errorf("%s: Content-Disposition = %q, want %q", tt.name, got, tt.disposition)
+			}
+		}
+	}
+
+	// A tampered signature is refused
+	u, err := store.PresignGet(ctx, "outputs/c.png", URLOptions{Expires: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(strings.Replace(u, "X-Amz-Expires=60", "X-Amz-Expires=600", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("tampered URL: status %d, want 403", resp.StatusCode)
+	}
+}
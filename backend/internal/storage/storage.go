@@ -0,0 +1,61 @@
+// Package storage keeps objects such as uploads and conversion results in a
+// local directory or an S3-compatible bucket, where every replica of the
+// server can read them, and hands out presigned download URLs.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/KennyMwendwaX/reformat/internal/config"
+)
+
+// ErrNotFound is returned for a key with no object
+var ErrNotFound = errors.New("object not found")
+
+// Object describes a stored object
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	Header  map[string]string // HTTP headers served with the object, such as Content-Type
+}
+
+// URLOptions shape a presigned download URL
+type URLOptions struct {
+	Expires  time.Duration // lifetime of the URL
+	Filename string        // download name sent in Content-Disposition, empty for none
+}
+
+// Store keeps objects by key. Keys are slash separated paths of letters,
+// digits, dashes, underscores and dots.
+type Store interface {
+	// Put stores size bytes read from body under key, replacing any object
+	// already there
+	Put(ctx context.Context, key string, body io.Reader, size int64, header map[string]string) error
+	// Get opens the object under key. The caller closes the body.
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	// Delete removes the object under key; a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// List returns every object whose key starts with prefix. Headers may
+	// be left out; Get returns them.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// PresignGet returns a URL downloading the object under key without
+	// other credentials until it expires
+	PresignGet(ctx context.Context, key string, opts URLOptions) (string, error)
+}
+
+// New opens the store selected by c. The local backend keeps objects in
+// localDir.
+func New(ctx context.Context, c config.StorageConfig, localDir string) (Store, error) {
+	switch c.Backend {
+	case "local":
+		return NewLocal(localDir, []byte(c.SigningKey), c.PublicURL)
+	case "s3":
+		return NewS3(ctx, c.S3)
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", c.Backend)
+}
@@ -1,8 +1,16 @@
 package converter
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // ConvertOptions holds all conversion settings
@@ -21,6 +29,46 @@ type ConvertOptions struct {
 	JPEGQuality   float64 // 0-100
 	GIFNumColors  float64 // 2-256
 	PreserveAlpha bool    // Preserve alpha channel when possible
+
+	// TargetFileSize is the maximum output size in bytes (JPEG only, 0 disables)
+	TargetFileSize int64
+	StripMetadata  bool // Remove EXIF/XMP/IPTC metadata from image output
+
+	// Preview specific options
+	PreviewMaxDimension int // longest side of generated thumbnails in pixels
+
+	// Contact sheet specific options
+	SheetColumns  int     // images per row
+	SheetSpacing  float64 // gap between cells, mm for PDF and pixels for images
+	SheetCellSize int     // cell width in pixels for image sheets
+	SheetCaptions bool    // draw a caption under each image
+
+	// SVG rasterization options
+	SVGWidth  int     // output width in pixels, 0 derives it from the SVG
+	SVGHeight int     // output height in pixels, 0 derives it from the SVG
+	SVGDPI    float64 // resolution used when no explicit size is given
+
+	Watermark *Watermark // stamp applied to image and PDF output, nil disables
+
+	// PDF tool options
+	PageRanges   string // page selection such as "1-3,7,10-"
+	PageRotation int    // clockwise rotation in degrees, a multiple of 90
+	PartName     string // base name of split parts, empty for the input file name
+
+	Metadata PDFMetadata // document information written to PDF output
+
+	Protection    *PDFProtection // encryption applied to PDF output, nil disables
+	InputPassword string         // password used to open protected PDF input
+
+	PDFA string // PDF/A conformance level of PDF output, "1b" or "2b", empty disables
+
+	Limits Limits // caps on the decoded size of the input
+
+	CommandTimeout time.Duration // limit on each external tool run, 0 disables
+	Tools          ToolPaths     // external programs used by some conversions
+
+	Logger  *slog.Logger    // receives debug logs of conversion stages
+	Context context.Context // stops the conversion when done and parents its trace spans
 }
 
 // DefaultOptions returns the default conversion options
@@ -34,6 +82,23 @@ func DefaultOptions() ConvertOptions {
 		LineHeight:         10,
 		DocxImageWidth:     6.0,
 		DocxImageMaxHeight: 8.0,
+
+		PreviewMaxDimension: 256,
+
+		SheetColumns:  4,
+		SheetSpacing:  4,
+		SheetCellSize: 240,
+		SheetCaptions: true,
+
+		SVGDPI: 96,
+
+		Limits: DefaultLimits(),
+
+		CommandTimeout: 60 * time.Second,
+		Tools:          DefaultToolPaths(),
+
+		Logger:  slog.Default(),
+		Context: context.Background(),
 	}
 }
 
@@ -48,6 +113,17 @@ type BaseConverter struct {
 	progressCallback ProgressCallback
 }
 
+// progress returns the progress callback of the converter, or one that
+// logs each step at debug level when none is set
+func (b *BaseConverter) progress(conversion string) ProgressCallback {
+	if b.progressCallback != nil {
+		return b.progressCallback
+	}
+	return func(progress float64) {
+		b.Options.Logger.Debug("Conversion progress", "conversion", conversion, "percent", progress)
+	}
+}
+
 // WithOutputPath sets a custom output path
 func WithOutputPath(path string) ConvertOption {
 	return func(o *ConvertOptions) {
@@ -62,8 +138,206 @@ func WithMaxImageWidth(width float64) ConvertOption {
 	}
 }
 
+// WithJPEGQuality sets the JPEG encoding quality (0-100)
+func WithJPEGQuality(quality float64) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.JPEGQuality = quality
+	}
+}
+
+// WithTargetFileSize sets the maximum output size in bytes
+func WithTargetFileSize(size int64) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.TargetFileSize = size
+	}
+}
+
+// WithStripMetadata removes metadata from image output
+func WithStripMetadata(strip bool) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.StripMetadata = strip
+	}
+}
+
+// WithPreviewMaxDimension sets the longest side of generated previews
+func WithPreviewMaxDimension(size int) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.PreviewMaxDimension = size
+	}
+}
+
+// WithSheetLayout sets the column count and cell spacing of contact sheets
+func WithSheetLayout(columns int, spacing float64) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.SheetColumns = columns
+		o.SheetSpacing = spacing
+	}
+}
+
+// WithSheetCellSize sets the cell width in pixels of image contact sheets
+func WithSheetCellSize(size int) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.SheetCellSize = size
+	}
+}
+
+// WithSheetCaptions enables or disables contact sheet captions
+func WithSheetCaptions(captions bool) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.SheetCaptions = captions
+	}
+}
+
+// WithSVGSize sets the pixel size of rasterized SVG input
+func WithSVGSize(width, height int) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.SVGWidth = width
+		o.SVGHeight = height
+	}
+}
+
+// WithSVGDPI sets the resolution of rasterized SVG input
+func WithSVGDPI(dpi float64) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.SVGDPI = dpi
+	}
+}
+
+// WithWatermark stamps text or an image on every output page or image
+func WithWatermark(wm Watermark) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.Watermark = &wm
+	}
+}
+
+// WithPageRanges sets the pages a PDF tool operates on
+func WithPageRanges(ranges string) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.PageRanges = ranges
+	}
+}
+
+// WithPageRotation sets the clockwise page rotation in degrees
+func WithPageRotation(degrees int) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.PageRotation = degrees
+	}
+}
+
+// WithPartName sets the base name of the parts written by the PDF splitter,
+// such as the original name of an upload stored under a generated one
+func WithPartName(name string) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.PartName = name
+	}
+}
+
+// WithPDFMetadata sets the title, author, subject, keywords and creator of
+// PDF output
+func WithPDFMetadata(metadata PDFMetadata) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.Metadata = metadata
+	}
+}
+
+// WithPDFProtection encrypts PDF output with the given passwords and
+// permissions
+func WithPDFProtection(protection PDFProtection) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.Protection = &protection
+	}
+}
+
+// WithInputPassword sets the password used to open protected PDF input
+func WithInputPassword(password string) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.InputPassword = password
+	}
+}
+
+// WithPDFA produces PDF/A output at the given conformance level
+func WithPDFA(level string) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.PDFA = level
+	}
+}
+
+// WithLimits sets the resource limits checked before decoding input
+func WithLimits(limits Limits) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.Limits = limits
+	}
+}
+
+// WithCommandTimeout sets how long external tools may run
+func WithCommandTimeout(timeout time.Duration) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.CommandTimeout = timeout
+	}
+}
+
+// WithToolPaths sets the external programs to run
+func WithToolPaths(tools ToolPaths) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.Tools = tools
+	}
+}
+
+// WithLogger sets the logger that receives debug logs of conversion stages
+func WithLogger(logger *slog.Logger) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.Logger = logger
+	}
+}
+
+// WithContext sets the context of a conversion. The conversion stops with
+// an error between stages once it is done, external tools are killed, and
+// its span parents the spans of conversion stages.
+func WithContext(ctx context.Context) ConvertOption {
+	return func(o *ConvertOptions) {
+		o.Context = ctx
+	}
+}
+
 // Helper function for generating output filenames
 func GetOutputFilename(inputFile, newExt string) string {
 	ext := filepath.Ext(inputFile)
 	return strings.TrimSuffix(inputFile, ext) + newExt
 }
+
+// Fingerprint identifies the output the options produce: options with the
+// same fingerprint give the same output for the same input and target.
+// Settings that only bound or observe a conversion, such as the output path,
+// limits, tool paths, logger and context, are left out, and a watermark
+// image counts by its content rather than its path.
+func Fingerprint(options ...ConvertOption) (string, error) {
+	opts := DefaultOptions()
+	for _, opt := range options {
+		opt(&opts)
+	}
+	opts.OutputPath = ""
+	opts.Limits = Limits{}
+	opts.CommandTimeout = 0
+	opts.Tools = ToolPaths{}
+	opts.Logger = nil
+	opts.Context = nil
+
+	if opts.Watermark != nil && opts.Watermark.Image != "" {
+		wm := *opts.Watermark
+		data, err := os.ReadFile(wm.Image)
+		if err != nil {
+			return "", fmt.Errorf("error reading watermark image: %w", err)
+		}
+		sum := sha256.Sum256(data)
+		wm.Image = hex.EncodeToString(sum[:])
+		opts.Watermark = &wm
+	}
+
+	// Fields are encoded in declaration order, so equal options encode alike
+	data, err := json.Marshal(opts)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
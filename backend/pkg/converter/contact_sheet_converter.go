@@ -0,0 +1,270 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Caption layout for contact sheets
+const (
+	sheetCaptionHeightMM = 5.0
+	sheetCaptionFontSize = 8.0
+	sheetCaptionPadding  = 4
+)
+
+// SheetItem is an image placed on a contact sheet
+type SheetItem struct {
+	Path    string
+	Caption string
+}
+
+// ContactSheetConverter lays out many images in a grid
+type ContactSheetConverter struct {
+	BaseConverter
+}
+
+// NewContactSheetConverter creates a new ContactSheetConverter
+func NewContactSheetConverter() *ContactSheetConverter {
+	return &ContactSheetConverter{
+		BaseConverter: BaseConverter{Options: DefaultOptions()},
+	}
+}
+
+// CreateSheet lays out items in a grid on A4 PDF pages, or on a single PNG
+// or JPEG image, depending on outputFormat
+func (c *ContactSheetConverter) CreateSheet(items []SheetItem, outputFormat string, options ...ConvertOption) error {
+	// Apply options
+	for _, opt := range options {
+		opt(&c.Options)
+	}
+
+	if len(items) == 0 {
+		return invalidOption("contact sheet needs at least one image")
+	}
+	if c.Options.SheetColumns <= 0 {
+		return invalidOption("invalid column count: %d", c.Options.SheetColumns)
+	}
+	if c.Options.SheetSpacing < 0 {
+		return invalidOption("invalid spacing: %g", c.Options.SheetSpacing)
+	}
+
+	outputFormat = strings.ToLower(outputFormat)
+	outputFile := c.Options.OutputPath
+	if outputFile == "" {
+		outputFile = GetOutputFilename(items[0].Path, "-sheet."+outputFormat)
+	}
+
+	switch outputFormat {
+	case "pdf":
+		return c.createPDFSheet(items, outputFile)
+	case "png", "jpg", "jpeg":
+		return c.createImageSheet(items, outputFormat, outputFile)
+	default:
+		return unsupportedFormat("contact sheet format", outputFormat)
+	}
+}
+
+// createPDFSheet places the images on as many A4 pages as needed, with the
+// watermark, metadata, protection and PDF/A settings of other PDF output
+func (c *ContactSheetConverter) createPDFSheet(items []SheetItem, outputFile string) error {
+	pdf, err := newPDFDocument(c.Options)
+	if err != nil {
+		return err
+	}
+	pdf.SetFont(documentFont(c.Options), "", sheetCaptionFontSize)
+	translate := pdfTranslator(pdf, c.Options)
+	register := pdfImageRegistrar(c.Options)
+
+	pageWidth, pageHeight := pdf.GetPageSize()
+	columns := c.Options.SheetColumns
+	spacing := c.Options.SheetSpacing
+	usableWidth := pageWidth - 2*c.Options.MarginLeft
+	usableHeight := pageHeight - 2*c.Options.MarginTop
+
+	cellWidth := (usableWidth - float64(columns-1)*spacing) / float64(columns)
+	if cellWidth <= 0 {
+		return invalidOption("too many columns for the page width")
+	}
+	cellHeight := cellWidth
+	if c.Options.SheetCaptions {
+		cellHeight += sheetCaptionHeightMM
+	}
+	rows := int((usableHeight + spacing) / (cellHeight + spacing))
+	if rows < 1 {
+		rows = 1
+	}
+	perPage := rows * columns
+
+	span := startStage(c.Options, stageRender, attribute.Int("images", len(items)))
+	for i, item := range items {
+		if err := checkContext(c.Options); err != nil {
+			endStage(span, err)
+			return err
+		}
+		if i%perPage == 0 {
+			pdf.AddPage()
+		}
+		slot := i % perPage
+		x := c.Options.MarginLeft + float64(slot%columns)*(cellWidth+spacing)
+		y := c.Options.MarginTop + float64(slot/columns)*(cellHeight+spacing)
+
+		name, size, err := register(pdf, item.Path, c.Options.Limits)
+		if err != nil {
+			endStage(span, err)
+			return fmt.Errorf("error adding %s: %w", item.Caption, err)
+		}
+
+		// Fit the image in the square part of the cell, centered
+		width, height := cellWidth, cellWidth
+		if size.X >= size.Y {
+			height = cellWidth * float64(size.Y) / float64(size.X)
+		} else {
+			width = cellWidth * float64(size.X) / float64(size.Y)
+		}
+		pdf.ImageOptions(name, x+(cellWidth-width)/2, y+(cellWidth-height)/2, width, height,
+			false, fpdf.ImageOptions{}, 0, "")
+
+		if c.Options.SheetCaptions && item.Caption != "" {
+			caption := fitCaption(item.Caption, cellWidth, func(s string) float64 {
+				return pdf.GetStringWidth(translate(s))
+			})
+			pdf.SetXY(x, y+cellWidth)
+			pdf.CellFormat(cellWidth, sheetCaptionHeightMM, translate(caption), "", 0, "C", false, 0, "")
+		}
+	}
+
+	endStage(span, pdf.Error())
+
+	return writePDFDocument(pdf, outputFile, c.Options)
+}
+
+// createImageSheet draws all images onto a single raster image
+func (c *ContactSheetConverter) createImageSheet(items []SheetItem, outputFormat, outputFile string) error {
+	columns := c.Options.SheetColumns
+	if len(items) < columns {
+		columns = len(items)
+	}
+	rows := (len(items) + columns - 1) / columns
+	spacing := int(c.Options.SheetSpacing)
+	cellSize := c.Options.SheetCellSize
+	if cellSize <= 0 {
+		return invalidOption("invalid cell size: %d", cellSize)
+	}
+
+	face := basicfont.Face7x13
+	cellHeight := cellSize
+	if c.Options.SheetCaptions {
+		cellHeight += face.Height + sheetCaptionPadding
+	}
+
+	width := columns*cellSize + (columns+1)*spacing
+	height := rows*cellHeight + (rows+1)*spacing
+	if err := c.Options.Limits.checkPixels(width, height); err != nil {
+		return err
+	}
+	sheet := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{Dst: sheet, Src: image.NewUniform(color.Black), Face: face}
+	measure := func(s string) float64 { return float64(drawer.MeasureString(s).Ceil()) }
+
+	span := startStage(c.Options, stageRender, attribute.Int("images", len(items)))
+	for i, item := range items {
+		if err := checkContext(c.Options); err != nil {
+			endStage(span, err)
+			return err
+		}
+		x := spacing + (i%columns)*(cellSize+spacing)
+		y := spacing + (i/columns)*(cellHeight+spacing)
+
+		img, err := decodeImageFile(item.Path, c.Options.Limits)
+		if err != nil {
+			endStage(span, err)
+			return fmt.Errorf("error adding %s: %w", item.Caption, err)
+		}
+		img = fitImage(img, cellSize)
+
+		bounds := img.Bounds()
+		offset := image.Pt(x+(cellSize-bounds.Dx())/2, y+(cellSize-bounds.Dy())/2)
+		draw.Draw(sheet, bounds.Sub(bounds.Min).Add(offset), img, bounds.Min, draw.Over)
+
+		if c.Options.SheetCaptions && item.Caption != "" {
+			caption := fitCaption(item.Caption, float64(cellSize), measure)
+			textWidth := drawer.MeasureString(caption).Ceil()
+			drawer.Dot = fixed.P(x+(cellSize-textWidth)/2, y+cellSize+sheetCaptionPadding/2+face.Ascent)
+			drawer.DrawString(caption)
+		}
+	}
+
+	endStage(span, nil)
+
+	span = startStage(c.Options, stageEncode, attribute.String("format", outputFormat))
+	output, err := os.Create(outputFile)
+	if err != nil {
+		endStage(span, err)
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer output.Close()
+
+	if outputFormat == "png" {
+		err = png.Encode(output, sheet)
+	} else {
+		var opts *jpeg.Options
+		if c.Options.JPEGQuality > 0 {
+			opts = &jpeg.Options{Quality: int(c.Options.JPEGQuality)}
+		}
+		err = jpeg.Encode(output, sheet, opts)
+	}
+	endStage(span, err)
+	if err != nil {
+		return fmt.Errorf("error encoding contact sheet: %w", err)
+	}
+	return nil
+}
+
+// fitCaption shortens a caption with an ellipsis until it fits in width
+func fitCaption(caption string, width float64, measure func(string) float64) string {
+	if measure(caption) <= width {
+		return caption
+	}
+	runes := []rune(caption)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if shortened := string(runes) + "..."; measure(shortened) <= width {
+			return shortened
+		}
+	}
+	return ""
+}
+
+// decodeImageFile opens and decodes an image file, checking its dimensions
+// against limits first
+func decodeImageFile(inputFile string, limits Limits) (image.Image, error) {
+	if err := limits.checkImageFile(inputFile); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("error opening input file: %w", err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, corruptInput("error decoding image", err)
+	}
+	return img, nil
+}
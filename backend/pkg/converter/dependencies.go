@@ -0,0 +1,83 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Tool is an external program some conversions run
+type Tool string
+
+// External programs used by the converters
+const (
+	ToolPdftotext Tool = "pdftotext"
+	ToolPdftoppm  Tool = "pdftoppm"
+)
+
+// Tools lists every external program the converters may run
+var Tools = []Tool{ToolPdftotext, ToolPdftoppm}
+
+// Path returns the configured path of tool
+func (p ToolPaths) Path(tool Tool) string {
+	switch tool {
+	case ToolPdftotext:
+		return p.Pdftotext
+	case ToolPdftoppm:
+		return p.Pdftoppm
+	}
+	return ""
+}
+
+// CheckTool verifies that tool is installed and starts, by asking it for its
+// version. The error matches ErrDependencyMissing.
+func CheckTool(paths ToolPaths, tool Tool, timeout time.Duration) error {
+	path := paths.Path(tool)
+	if path == "" {
+		return fmt.Errorf("%w: no path configured for %s", ErrDependencyMissing, tool)
+	}
+	opts := DefaultOptions()
+	opts.CommandTimeout = timeout
+	_, err := runCommand(opts, path, "-v")
+	if err == nil || errors.Is(err, ErrDependencyMissing) {
+		return err
+	}
+	return &kindError{ErrDependencyMissing, fmt.Errorf("%s cannot be run: %w", path, err)}
+}
+
+// Conversion names a conversion offered by the converters and the external
+// programs it needs
+type Conversion struct {
+	Name  string
+	Tools []Tool
+}
+
+// Names of the conversions
+const (
+	ConversionImageToPDF     = "image-to-pdf"
+	ConversionDocxToPDF      = "docx-to-pdf"
+	ConversionPDFToDocx      = "pdf-to-docx"
+	ConversionImageToDocx    = "image-to-docx"
+	ConversionImageToImage   = "image-to-image"
+	ConversionImagePreview   = "image-preview"
+	ConversionPDFPreview     = "pdf-preview"
+	ConversionDocxPreview    = "docx-preview"
+	ConversionContactSheet   = "contact-sheet"
+	ConversionPDFTools       = "pdf-tools"
+	ConversionPDFAValidation = "pdfa-validation"
+)
+
+// Conversions lists every conversion with its external programs
+var Conversions = []Conversion{
+	{Name: ConversionImageToPDF},
+	{Name: ConversionDocxToPDF},
+	{Name: ConversionPDFToDocx, Tools: []Tool{ToolPdftotext}},
+	{Name: ConversionImageToDocx},
+	{Name: ConversionImageToImage},
+	{Name: ConversionImagePreview},
+	{Name: ConversionPDFPreview, Tools: []Tool{ToolPdftoppm}},
+	{Name: ConversionDocxPreview, Tools: []Tool{ToolPdftoppm}},
+	{Name: ConversionContactSheet},
+	{Name: ConversionPDFTools},
+	{Name: ConversionPDFAValidation},
+}
@@ -1,14 +1,15 @@
 package converter
 
 import (
+	"errors"
 	"fmt"
-	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/unidoc/unioffice/common"
 	"github.com/unidoc/unioffice/document"
 	"github.com/unidoc/unioffice/measurement"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // DocxConverterInterface interface for converting files to DOCX
@@ -61,11 +62,19 @@ func (c *PDFToDocxConverter) ConvertToDocx(inputFile string, options ...ConvertO
 		opt(&c.Options)
 	}
 
-	text, err := extractTextFromPDF(inputFile)
+	// pdftotext copes with damaged files pdfcpu cannot count, so only a
+	// countable page total is enforced here
+	err := c.Options.Limits.checkPDFFiles([]string{inputFile}, c.Options.InputPassword)
+	if err != nil && !errors.Is(err, ErrCorruptInput) {
+		return err
+	}
+
+	text, err := extractTextFromPDF(inputFile, c.Options)
 	if err != nil {
 		return fmt.Errorf("error extracting text: %w", err)
 	}
 
+	span := startStage(c.Options, stageRender)
 	doc := document.New()
 	paragraphs := strings.Split(text, "\n\n")
 	for _, p := range paragraphs {
@@ -75,12 +84,13 @@ func (c *PDFToDocxConverter) ConvertToDocx(inputFile string, options ...ConvertO
 			run.AddText(strings.TrimSpace(p))
 		}
 	}
+	endStage(span, nil)
 
 	outputFile := c.Options.OutputPath
 	if outputFile == "" {
 		outputFile = GetOutputFilename(inputFile, ".docx")
 	}
-	return doc.SaveToFile(outputFile)
+	return saveDocx(doc, outputFile, c.Options)
 }
 
 // ConvertToDocx converts an image file to DOCX format
@@ -90,14 +100,22 @@ func (c *ImageToDocxConverter) ConvertToDocx(inputFile string, options ...Conver
 		opt(&c.Options)
 	}
 
-	doc := document.New()
-	para := doc.AddParagraph()
-
+	// ImageFromFile decodes the whole image, so check its size first
+	span := startStage(c.Options, stageDecode)
+	err := c.Options.Limits.checkImageFile(inputFile)
+	if err != nil {
+		endStage(span, err)
+		return err
+	}
 	img, err := common.ImageFromFile(inputFile)
+	endStage(span, err)
 	if err != nil {
 		return fmt.Errorf("error loading image: %w", err)
 	}
 
+	doc := document.New()
+	para := doc.AddParagraph()
+
 	imgRef, err := doc.AddImage(img)
 	if err != nil {
 		return fmt.Errorf("error adding image to document: %w", err)
@@ -124,15 +142,36 @@ func (c *ImageToDocxConverter) ConvertToDocx(inputFile string, options ...Conver
 	if outputFile == "" {
 		outputFile = GetOutputFilename(inputFile, ".docx")
 	}
-	return doc.SaveToFile(outputFile)
+	return saveDocx(doc, outputFile, c.Options)
+}
+
+// saveDocx writes a finished document to outputFile
+func saveDocx(doc *document.Document, outputFile string, opts ConvertOptions) error {
+	if err := checkContext(opts); err != nil {
+		return err
+	}
+	span := startStage(opts, stageEncode, attribute.String("format", "docx"))
+	err := doc.SaveToFile(outputFile)
+	endStage(span, err)
+	return err
 }
 
-// Helper function for PDF text extraction
-func extractTextFromPDF(inputFile string) (string, error) {
-	cmd := exec.Command("pdftotext", inputFile, "-")
-	output, err := cmd.Output()
+// Helper function for PDF text extraction. A non-empty InputPassword is
+// tried as both the user and the owner password of protected files, which
+// are decrypted to a temporary copy first.
+func extractTextFromPDF(inputFile string, opts ConvertOptions) (string, error) {
+	if opts.InputPassword != "" {
+		decrypted, remove, err := decryptedCopy(inputFile, opts.InputPassword)
+		if err != nil {
+			return "", err
+		}
+		defer remove()
+		inputFile = decrypted
+	}
+
+	output, err := runCommand(opts, opts.Tools.Pdftotext, inputFile, "-")
 	if err != nil {
-		return "", fmt.Errorf("pdftotext error: %w", err)
+		return "", err
 	}
 	return string(output), nil
 }
@@ -141,13 +180,13 @@ func extractTextFromPDF(inputFile string) (string, error) {
 func GetDocxConverter(inputFile string) (DocxConverterInterface, error) {
 	ext := strings.ToLower(filepath.Ext(inputFile))
 	switch ext {
-	case ".jpg", ".jpeg", ".png", ".gif", ".bmp":
+	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".tif", ".tiff":
 		return NewImageToDocxConverter(), nil
 	case ".pdf":
 		return NewPDFToDocxConverter(), nil
 	case ".docx":
-		return nil, fmt.Errorf("file is already in DOCX format: %s", inputFile)
+		return nil, invalidOption("file is already in DOCX format")
 	default:
-		return nil, fmt.Errorf("unsupported file type: %s", ext)
+		return nil, unsupportedFormat("file type", ext)
 	}
 }
@@ -0,0 +1,178 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Code classifies a conversion failure for clients
+type Code string
+
+// Codes reported by ErrorCode
+const (
+	CodeInvalidOptions    Code = "invalid_options"
+	CodeUnsupportedFormat Code = "unsupported_format"
+	CodeCorruptInput      Code = "corrupt_input"
+	CodeLimitExceeded     Code = "limit_exceeded"
+	CodeDependencyMissing Code = "dependency_missing"
+	CodeTimeout           Code = "timeout"
+	CodeInvalidPassword   Code = "invalid_password"
+)
+
+// Sentinel errors wrapped by conversion failures of each kind. Errors
+// without one of these are internal failures.
+var (
+	ErrInvalidOptions    = errors.New("invalid options")
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	ErrCorruptInput      = errors.New("corrupt input")
+	ErrLimitExceeded     = errors.New("resource limit exceeded")
+	ErrDependencyMissing = errors.New("dependency missing")
+	ErrTimeout           = errors.New("timed out")
+	ErrInvalidPassword   = errors.New("missing or wrong password")
+)
+
+var errorCodes = []struct {
+	err  error
+	code Code
+}{
+	{ErrInvalidOptions, CodeInvalidOptions},
+	{ErrUnsupportedFormat, CodeUnsupportedFormat},
+	{ErrCorruptInput, CodeCorruptInput},
+	{ErrLimitExceeded, CodeLimitExceeded},
+	{ErrDependencyMissing, CodeDependencyMissing},
+	{ErrTimeout, CodeTimeout},
+	{ErrInvalidPassword, CodeInvalidPassword},
+}
+
+// ErrorCode returns the code of the first sentinel err wraps, or "" for
+// internal failures
+func ErrorCode(err error) Code {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return ""
+}
+
+// kindError tags an error with one of the sentinels without changing its
+// message
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string { return e.err.Error() }
+
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// invalidOption reports options or parameters that cannot be applied
+func invalidOption(format string, args ...any) error {
+	return &kindError{ErrInvalidOptions, fmt.Errorf(format, args...)}
+}
+
+// corruptInput reports input that cannot be decoded
+func corruptInput(msg string, err error) error {
+	return &kindError{ErrCorruptInput, fmt.Errorf("%s: %w", msg, err)}
+}
+
+// pdfReadError classifies an error from pdfcpu reading an input file
+func pdfReadError(msg string, err error) error {
+	if errors.Is(err, pdfcpu.ErrWrongPassword) {
+		return fmt.Errorf("%s: %w", msg, ErrInvalidPassword)
+	}
+	return corruptInput(msg, err)
+}
+
+// pdfProcessError classifies an error from pdfcpu rewriting an input file.
+// Only a missing or wrong password is the client's fault.
+func pdfProcessError(msg string, err error) error {
+	if errors.Is(err, pdfcpu.ErrWrongPassword) {
+		return fmt.Errorf("%s: %w", msg, ErrInvalidPassword)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// unsupportedFormat reports a file type or format no converter handles
+func unsupportedFormat(kind, format string) error {
+	return &kindError{ErrUnsupportedFormat, fmt.Errorf("unsupported %s: %s", kind, format)}
+}
+
+// ToolPaths holds the paths of the external programs used for PDF text
+// extraction and rendering
+type ToolPaths struct {
+	Pdftotext string
+	Pdftoppm  string
+}
+
+// DefaultToolPaths looks the programs up in PATH
+func DefaultToolPaths() ToolPaths {
+	return ToolPaths{Pdftotext: "pdftotext", Pdftoppm: "pdftoppm"}
+}
+
+// checkContext fails once the context of a conversion is done. A passed
+// deadline matches ErrTimeout; a cancellation, such as the client going
+// away, is an internal failure.
+func checkContext(opts ConvertOptions) error {
+	if opts.Context == nil {
+		return nil
+	}
+	switch err := opts.Context.Err(); {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return &kindError{ErrTimeout, fmt.Errorf("conversion stopped: %w", err)}
+	default:
+		return fmt.Errorf("conversion stopped: %w", err)
+	}
+}
+
+// runCommand runs an external tool under the conversion context, killing it
+// when that is done or after the command timeout when that is positive, and
+// returns its standard output. A missing executable matches
+// ErrDependencyMissing and an expired deadline matches ErrTimeout.
+func runCommand(opts ConvertOptions, name string, args ...string) ([]byte, error) {
+	if err := checkContext(opts); err != nil {
+		return nil, err
+	}
+
+	timeout := opts.CommandTimeout
+	ctx := opts.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	span := startStage(opts, stageSubprocess, attribute.String("command", name))
+	start := time.Now()
+	err := cmd.Run()
+	endStage(span, err)
+	opts.Logger.Debug("External command finished", "command", name,
+		"duration_ms", float64(time.Since(start).Microseconds())/1000, "error", err)
+	switch {
+	case err == nil:
+		return stdout.Bytes(), nil
+	case errors.Is(err, exec.ErrNotFound):
+		return nil, fmt.Errorf("%w: %s is not installed", ErrDependencyMissing, name)
+	case checkContext(opts) != nil:
+		return nil, fmt.Errorf("%s killed: %w", name, checkContext(opts))
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, fmt.Errorf("%s %w after %s", name, ErrTimeout, timeout)
+	}
+	return nil, fmt.Errorf("%s error: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+}
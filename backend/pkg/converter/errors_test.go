@@ -0,0 +1,75 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckContext(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		code Code
+		ok   bool
+	}{
+		{"no context", nil, "", true},
+		{"running", context.Background(), "", true},
+		{"deadline passed", expired, CodeTimeout, false},
+		{"canceled", canceled, "", false},
+	}
+	for _, tt := range tests {
+		err := checkContext(ConvertOptions{Context: tt.ctx})
+		if (err == nil) != tt.ok || ErrorCode(err) != tt.code {
+			t.Errorf("%s: checkContext = %v (code %q), want ok %v and code %q", tt.name, err, ErrorCode(err), tt.ok, tt.code)
+		}
+	}
+}
+
+func TestRunCommandStopsAtDeadline(t *testing.T) {
+	if _, err := os.Stat("/bin/sleep"); err != nil {
+		t.Skip("sleep not available")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	opts := DefaultOptions()
+	opts.Context = ctx
+	start := time.Now()
+	_, err := runCommand(opts, "/bin/sleep", "5")
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("command ran for %s after the deadline", elapsed)
+	}
+}
+
+func TestConvertStopsAtDeadline(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	f.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	err = NewImageFormatConverter().Convert(input, "jpg",
+		WithOutputPath(filepath.Join(dir, "out.jpg")), WithContext(ctx))
+	if ErrorCode(err) != CodeTimeout {
+		t.Errorf("error = %v, want a timeout", err)
+	}
+}
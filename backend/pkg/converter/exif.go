@@ -0,0 +1,193 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// TIFF tags that point to nested IFDs
+const (
+	tagExifIFD = 0x8769
+	tagGPSIFD  = 0x8825
+)
+
+// exifTagNames maps IFD0 and Exif IFD tags to readable names
+var exifTagNames = map[uint16]string{
+	0x010E: "ImageDescription",
+	0x010F: "Make",
+	0x0110: "Model",
+	0x0112: "Orientation",
+	0x011A: "XResolution",
+	0x011B: "YResolution",
+	0x0128: "ResolutionUnit",
+	0x0131: "Software",
+	0x0132: "DateTime",
+	0x013B: "Artist",
+	0x8298: "Copyright",
+	0x829A: "ExposureTime",
+	0x829D: "FNumber",
+	0x8822: "ExposureProgram",
+	0x8827: "ISOSpeedRatings",
+	0x9003: "DateTimeOriginal",
+	0x9004: "DateTimeDigitized",
+	0x9201: "ShutterSpeedValue",
+	0x9202: "ApertureValue",
+	0x9204: "ExposureBiasValue",
+	0x9207: "MeteringMode",
+	0x9209: "Flash",
+	0x920A: "FocalLength",
+	0x9290: "SubSecTime",
+	0xA001: "ColorSpace",
+	0xA002: "PixelXDimension",
+	0xA003: "PixelYDimension",
+	0xA402: "ExposureMode",
+	0xA403: "WhiteBalance",
+	0xA405: "FocalLengthIn35mmFilm",
+	0xA420: "ImageUniqueID",
+	0xA430: "CameraOwnerName",
+	0xA431: "BodySerialNumber",
+	0xA433: "LensMake",
+	0xA434: "LensModel",
+}
+
+// gpsTagNames maps GPS IFD tags to readable names
+var gpsTagNames = map[uint16]string{
+	0x0000: "GPSVersionID",
+	0x0001: "GPSLatitudeRef",
+	0x0002: "GPSLatitude",
+	0x0003: "GPSLongitudeRef",
+	0x0004: "GPSLongitude",
+	0x0005: "GPSAltitudeRef",
+	0x0006: "GPSAltitude",
+	0x0007: "GPSTimeStamp",
+	0x000C: "GPSSpeedRef",
+	0x000D: "GPSSpeed",
+	0x0010: "GPSImgDirectionRef",
+	0x0011: "GPSImgDirection",
+	0x001D: "GPSDateStamp",
+}
+
+// Byte sizes of the TIFF field types, indexed by type id
+var tiffTypeSizes = [...]int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+// parseEXIF decodes the TIFF structure of an EXIF payload into named fields.
+// Unknown tags and binary values are skipped.
+func parseEXIF(data []byte) (map[string]string, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("exif data too short")
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("invalid exif byte order")
+	}
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, fmt.Errorf("invalid exif header")
+	}
+
+	fields := make(map[string]string)
+	p := exifParser{data: data, order: order, fields: fields}
+	p.readIFD(order.Uint32(data[4:8]), exifTagNames, 0)
+	return fields, nil
+}
+
+type exifParser struct {
+	data   []byte
+	order  binary.ByteOrder
+	fields map[string]string
+}
+
+// readIFD reads a single IFD and follows the Exif and GPS sub-IFD pointers
+func (p *exifParser) readIFD(offset uint32, names map[uint16]string, depth int) {
+	if depth > 2 || int(offset)+2 > len(p.data) {
+		return
+	}
+
+	count := int(p.order.Uint16(p.data[offset:]))
+	for i := 0; i < count; i++ {
+		entry := int(offset) + 2 + i*12
+		if entry+12 > len(p.data) {
+			return
+		}
+
+		tag := p.order.Uint16(p.data[entry:])
+		typ := p.order.Uint16(p.data[entry+2:])
+		n := p.order.Uint32(p.data[entry+4:])
+
+		switch tag {
+		case tagExifIFD:
+			p.readIFD(p.order.Uint32(p.data[entry+8:]), exifTagNames, depth+1)
+			continue
+		case tagGPSIFD:
+			p.readIFD(p.order.Uint32(p.data[entry+8:]), gpsTagNames, depth+1)
+			continue
+		}
+
+		name, ok := names[tag]
+		if !ok || int(typ) >= len(tiffTypeSizes) || tiffTypeSizes[typ] == 0 {
+			continue
+		}
+
+		size := tiffTypeSizes[typ] * int(n)
+		if size < 0 || n > 1<<16 {
+			continue
+		}
+		value := p.data[entry+8 : entry+12]
+		if size > 4 {
+			start := int(p.order.Uint32(value))
+			if start+size > len(p.data) || start < 0 {
+				continue
+			}
+			value = p.data[start : start+size]
+		}
+
+		if formatted, ok := p.formatValue(typ, int(n), value); ok {
+			p.fields[name] = formatted
+		}
+	}
+}
+
+// formatValue renders a TIFF field value as a string
+func (p *exifParser) formatValue(typ uint16, n int, value []byte) (string, bool) {
+	var parts []string
+	switch typ {
+	case 2: // ASCII
+		return strings.TrimRight(string(bytes.TrimRight(value[:n], "\x00")), " "), true
+	case 1: // BYTE
+		for i := 0; i < n; i++ {
+			parts = append(parts, fmt.Sprint(value[i]))
+		}
+	case 3: // SHORT
+		for i := 0; i < n; i++ {
+			parts = append(parts, fmt.Sprint(p.order.Uint16(value[i*2:])))
+		}
+	case 4: // LONG
+		for i := 0; i < n; i++ {
+			parts = append(parts, fmt.Sprint(p.order.Uint32(value[i*4:])))
+		}
+	case 9: // SLONG
+		for i := 0; i < n; i++ {
+			parts = append(parts, fmt.Sprint(int32(p.order.Uint32(value[i*4:]))))
+		}
+	case 5: // RATIONAL
+		for i := 0; i < n; i++ {
+			parts = append(parts, fmt.Sprintf("%d/%d",
+				p.order.Uint32(value[i*8:]), p.order.Uint32(value[i*8+4:])))
+		}
+	case 10: // SRATIONAL
+		for i := 0; i < n; i++ {
+			parts = append(parts, fmt.Sprintf("%d/%d",
+				int32(p.order.Uint32(value[i*8:])), int32(p.order.Uint32(value[i*8+4:]))))
+		}
+	default:
+		return "", false
+	}
+	return strings.Join(parts, ", "), true
+}
@@ -0,0 +1,100 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Description of the generated sRGB profile, also used as the output
+// condition of PDF/A output intents
+const srgbProfileName = "sRGB IEC61966-2.1"
+
+// Entries in the sRGB tone curve table
+const srgbCurvePoints = 1024
+
+// srgbICCProfile builds a version 2 ICC display profile for sRGB. Colorants
+// are the standard sRGB primaries adapted to the D50 profile connection
+// space, and the tone curve is the piecewise sRGB transfer function.
+func srgbICCProfile() []byte {
+	xyz := func(x, y, z float64) []byte {
+		var b bytes.Buffer
+		b.WriteString("XYZ \x00\x00\x00\x00")
+		for _, v := range []float64{x, y, z} {
+			binary.Write(&b, binary.BigEndian, s15Fixed16(v))
+		}
+		return b.Bytes()
+	}
+
+	var curve bytes.Buffer
+	curve.WriteString("curv\x00\x00\x00\x00")
+	binary.Write(&curve, binary.BigEndian, uint32(srgbCurvePoints))
+	for i := 0; i < srgbCurvePoints; i++ {
+		v := float64(i) / (srgbCurvePoints - 1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		binary.Write(&curve, binary.BigEndian, uint16(math.Round(v*65535)))
+	}
+
+	var desc bytes.Buffer
+	desc.WriteString("desc\x00\x00\x00\x00")
+	binary.Write(&desc, binary.BigEndian, uint32(len(srgbProfileName)+1))
+	desc.WriteString(srgbProfileName + "\x00")
+	// Empty Unicode and ScriptCode descriptions
+	desc.Write(make([]byte, 4+4+2+1+67))
+
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", desc.Bytes()},
+		{"cprt", []byte("text\x00\x00\x00\x00No copyright, use freely\x00")},
+		{"wtpt", xyz(0.9642, 1.0, 0.8249)},
+		{"rXYZ", xyz(0.4360747, 0.2225045, 0.0139322)},
+		{"gXYZ", xyz(0.3850649, 0.7168786, 0.0971045)},
+		{"bXYZ", xyz(0.1430804, 0.0606169, 0.7141733)},
+		{"rTRC", curve.Bytes()},
+		{"gTRC", nil}, // the three channels share one curve
+		{"bTRC", nil},
+	}
+
+	// Lay out the tag data after the header and tag table, 4-byte aligned
+	offset := 128 + 4 + 12*len(tags)
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	var shared [2]uint32
+	for _, tag := range tags {
+		if tag.data != nil {
+			shared = [2]uint32{uint32(offset + data.Len()), uint32(len(tag.data))}
+			data.Write(tag.data)
+			for data.Len()%4 != 0 {
+				data.WriteByte(0)
+			}
+		}
+		table.WriteString(tag.sig)
+		binary.Write(&table, binary.BigEndian, shared)
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(offset+data.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // version 2.1
+	copy(header[12:], "mntrRGB XYZ ")
+	// Creation date 1998-02-09, matching the IEC specification
+	for i, v := range []uint16{1998, 2, 9} {
+		binary.BigEndian.PutUint16(header[24+2*i:], v)
+	}
+	copy(header[36:], "acsp")
+	for i, v := range []float64{0.9642, 1.0, 0.8249} {
+		binary.BigEndian.PutUint32(header[68+4*i:], uint32(s15Fixed16(v)))
+	}
+
+	return append(append(header, table.Bytes()...), data.Bytes()...)
+}
+
+// s15Fixed16 encodes v as a signed 15.16 fixed point number
+func s15Fixed16(v float64) int32 {
+	return int32(math.Round(v * 65536))
+}
@@ -1,16 +1,24 @@
 package converter
 
 import (
+	"bytes"
 	"fmt"
 	"image"
 	"image/gif"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+
+	// Register decoders for WebP and TIFF input
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
 )
 
 // ImageFormatConverterInterface interface for converting image formats
@@ -21,8 +29,26 @@ type ImageFormatConverterInterface interface {
 // ImageFormatConverter handles image format conversions
 type ImageFormatConverter struct {
 	BaseConverter
+
+	// Result describes the last image written by Convert
+	Result ImageResult
 }
 
+// ImageResult reports the encoding parameters of a converted image
+type ImageResult struct {
+	Quality int // JPEG quality used, 0 for other formats
+	Width   int
+	Height  int
+	Size    int64
+}
+
+// Bounds used when searching for a JPEG quality that fits a target size
+const (
+	minTargetQuality = 10
+	maxTargetQuality = 95
+	minTargetSide    = 16
+)
+
 // NewImageFormatConverter creates a new ImageFormatConverter
 func NewImageFormatConverter() *ImageFormatConverter {
 	return &ImageFormatConverter{
@@ -39,13 +65,12 @@ func (c *ImageFormatConverter) Convert(inputFile string, outputFormat string, op
 
 	// Validate input format
 	if !ValidateFormat(outputFormat) {
-		return fmt.Errorf("unsupported output format: %s", outputFormat)
+		return unsupportedFormat("output format", outputFormat)
 	}
 
-	// Load image
-	img, err := c.loadImage(inputFile)
-	if err != nil {
-		return err
+	isJPEG := strings.EqualFold(outputFormat, "jpg") || strings.EqualFold(outputFormat, "jpeg")
+	if c.Options.TargetFileSize > 0 && !isJPEG {
+		return invalidOption("target file size is only supported for JPEG output")
 	}
 
 	// Generate output filename
@@ -54,31 +79,193 @@ func (c *ImageFormatConverter) Convert(inputFile string, outputFormat string, op
 		outputFile = GetOutputFilename(inputFile, "."+outputFormat)
 	}
 
+	// JPEG to JPEG can drop metadata segments without re-encoding. Every
+	// other path re-encodes, and the encoders never write metadata.
+	if c.Options.StripMetadata && isJPEG && c.Options.TargetFileSize == 0 &&
+		c.Options.Watermark == nil && isJPEGFile(inputFile) {
+		return c.stripJPEG(inputFile, outputFile)
+	}
+
+	// Load image
+	img, err := c.loadImage(inputFile, outputFormat)
+	if err != nil {
+		return err
+	}
+
+	if err := checkContext(c.Options); err != nil {
+		return err
+	}
+	if c.Options.Watermark != nil {
+		span := startStage(c.Options, stageTransform, attribute.String("operation", "watermark"))
+		img, err = applyImageWatermark(img, c.Options.Watermark, c.Options.Limits)
+		endStage(span, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := checkContext(c.Options); err != nil {
+		return err
+	}
+	span := startStage(c.Options, stageEncode, attribute.String("format", strings.ToLower(outputFormat)))
+	if c.Options.TargetFileSize > 0 {
+		err := c.writeTargetSize(img, outputFile)
+		endStage(span, err)
+		return err
+	}
+
 	// Create output file
 	output, err := os.Create(outputFile)
 	if err != nil {
+		endStage(span, err)
 		return fmt.Errorf("error creating output file: %w", err)
 	}
 	defer output.Close()
 
 	// Encode image based on format
-	return c.encodeImage(img, output, outputFormat)
+	err = c.encodeImage(img, output, outputFormat)
+	endStage(span, err)
+	if err != nil {
+		return err
+	}
+
+	c.Result = ImageResult{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	if isJPEG {
+		c.Result.Quality = int(c.Options.JPEGQuality)
+	}
+	if info, err := output.Stat(); err == nil {
+		c.Result.Size = info.Size()
+	}
+	return nil
 }
 
-// loadImage loads and decodes the input image
-func (c *ImageFormatConverter) loadImage(inputFile string) (image.Image, error) {
-	input, err := os.Open(inputFile)
+// writeTargetSize encodes img as JPEG no larger than TargetFileSize, lowering
+// the quality first and then the dimensions until the output fits
+func (c *ImageFormatConverter) writeTargetSize(img image.Image, outputFile string) error {
+	target := c.Options.TargetFileSize
+	maxQuality := maxTargetQuality
+	if q := int(c.Options.JPEGQuality); q > 0 && q < maxQuality {
+		maxQuality = q
+	}
+
+	for {
+		if err := checkContext(c.Options); err != nil {
+			return err
+		}
+		data, quality, err := searchJPEGQuality(img, target, maxQuality)
+		if err != nil {
+			return err
+		}
+
+		bounds := img.Bounds()
+		if data != nil {
+			if err := os.WriteFile(outputFile, data, 0644); err != nil {
+				return fmt.Errorf("error writing output file: %w", err)
+			}
+			c.Result = ImageResult{
+				Quality: quality,
+				Width:   bounds.Dx(),
+				Height:  bounds.Dy(),
+				Size:    int64(len(data)),
+			}
+			return nil
+		}
+
+		// Even the lowest quality is too large, shrink the image and retry
+		width := bounds.Dx() * 3 / 4
+		height := bounds.Dy() * 3 / 4
+		if width < minTargetSide || height < minTargetSide {
+			return invalidOption("unable to compress image below %d bytes", target)
+		}
+		img = resizeImage(img, width, height)
+	}
+}
+
+// searchJPEGQuality binary searches for the highest quality whose encoding
+// fits in target bytes. It returns nil data when no quality fits.
+func searchJPEGQuality(img image.Image, target int64, maxQuality int) ([]byte, int, error) {
+	var best []byte
+	bestQuality := 0
+
+	low, high := minTargetQuality, maxQuality
+	for low <= high {
+		quality := (low + high) / 2
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, 0, fmt.Errorf("error encoding image to jpeg: %w", err)
+		}
+
+		if int64(buf.Len()) <= target {
+			best = buf.Bytes()
+			bestQuality = quality
+			low = quality + 1
+		} else {
+			high = quality - 1
+		}
+	}
+	return best, bestQuality, nil
+}
+
+// resizeImage scales img to the given dimensions
+func resizeImage(img image.Image, width, height int) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	return dst
+}
+
+// stripJPEG writes a copy of a JPEG with its metadata segments removed
+func (c *ImageFormatConverter) stripJPEG(inputFile, outputFile string) error {
+	data, err := os.ReadFile(inputFile)
 	if err != nil {
-		return nil, fmt.Errorf("error opening input file: %w", err)
+		return fmt.Errorf("error opening input file: %w", err)
 	}
-	defer input.Close()
 
-	img, _, err := image.Decode(input)
+	cfg, err := jpeg.DecodeConfig(bytes.NewReader(data))
 	if err != nil {
-		return nil, fmt.Errorf("error decoding image: %w", err)
+		return fmt.Errorf("error decoding image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := StripJPEGMetadata(bytes.NewReader(data), &buf); err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputFile, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing output file: %w", err)
+	}
+
+	c.Result = ImageResult{Width: cfg.Width, Height: cfg.Height, Size: int64(buf.Len())}
+	return nil
+}
+
+// isJPEGFile reports whether the file starts with a JPEG signature
+func isJPEGFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, []byte{0xFF, markerSOI, 0xFF})
+}
+
+// loadImage loads and decodes the input image, rasterizing SVG input
+func (c *ImageFormatConverter) loadImage(inputFile, outputFormat string) (image.Image, error) {
+	if isSVGFile(inputFile) {
+		opts := c.Options
+		if strings.EqualFold(outputFormat, "png") {
+			opts.PreserveAlpha = true
+		}
+		return rasterizeSVG(inputFile, opts)
 	}
 
-	return img, nil
+	span := startStage(c.Options, stageDecode)
+	img, err := decodeImageFile(inputFile, c.Options.Limits)
+	endStage(span, err)
+	return img, err
 }
 
 // encodeImage encodes the image in the specified format
@@ -98,7 +285,7 @@ func (c *ImageFormatConverter) encodeImage(img image.Image, output *os.File, for
 	case "bmp":
 		err = bmp.Encode(output, img)
 	default:
-		return fmt.Errorf("unsupported output format: %s", format)
+		return unsupportedFormat("output format", format)
 	}
 
 	if err != nil {
@@ -168,7 +355,7 @@ func GetFormatInfo(format string) (*Format, error) {
 			}
 		}
 	}
-	return nil, fmt.Errorf("unsupported format: %s", format)
+	return nil, unsupportedFormat("format", format)
 }
 
 // GetFormatFromFilename extracts the format from a filename
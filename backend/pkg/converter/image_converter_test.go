@@ -0,0 +1,134 @@
+package converter
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// noisyImage returns an image that compresses poorly, so the JPEG size
+// follows the quality closely
+func noisyImage(width, height int) *image.RGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.Intn(256))
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	return img
+}
+
+// jpegSize returns the encoded size of img at quality
+func jpegSize(t *testing.T, img image.Image, quality int) int64 {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return int64(buf.Len())
+}
+
+func TestSearchJPEGQuality(t *testing.T) {
+	img := noisyImage(64, 64)
+	tests := []struct {
+		name       string
+		target     int64
+		maxQuality int
+		want       int // quality, 0 when none fits
+	}{
+		{"everything fits", 1 << 20, 95, 95},
+		{"capped", 1 << 20, 70, 70},
+		{"exact size", jpegSize(t, img, 50), 95, 50},
+		{"just below", jpegSize(t, img, 50) - 1, 95, 49},
+		{"lowest quality", jpegSize(t, img, minTargetQuality), 95, minTargetQuality},
+		{"nothing fits", jpegSize(t, img, minTargetQuality) - 1, 95, 0},
+	}
+	for _, tt := range tests {
+		data, quality, err := searchJPEGQuality(img, tt.target, tt.maxQuality)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if quality != tt.want || (data == nil) != (tt.want == 0) {
+			t.Errorf("%s: quality %d with %d bytes, want %d", tt.name, quality, len(data), tt.want)
+		}
+		if int64(len(data)) > tt.target {
+			t.Errorf("%s: %d bytes, over the %d byte target", tt.name, len(data), tt.target)
+		}
+	}
+}
+
+func TestTargetFileSize(t *testing.T) {
+	dir := t.TempDir()
+	img := noisyImage(200, 150)
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, img)
+	f.Close()
+
+	tests := []struct {
+		name       string
+		format     string
+		target     int64
+		quality    float64 // requested
+		minQuality int     // of the result
+		maxQuality int
+		resized    bool
+		err        error
+	}{
+		{"fits at top quality", "jpg", 1 << 20, 0, maxTargetQuality, maxTargetQuality, false, nil},
+		{"quality caps the search", "jpeg", 1 << 20, 60, 60, 60, false, nil},
+		{"lower quality", "jpg", jpegSize(t, img, 40), 0, 40, 41, false, nil},
+		{"smaller image", "jpg", jpegSize(t, img, minTargetQuality) / 2, 0, minTargetQuality, maxTargetQuality, true, nil},
+		{"unreachable", "jpg", 500, 0, 0, 0, false, ErrInvalidOptions},
+		{"not jpeg", "png", 1 << 20, 0, 0, 0, false, ErrInvalidOptions},
+	}
+	for _, tt := range tests {
+		output := filepath.Join(dir, "out."+tt.format)
+		c := NewImageFormatConverter()
+		err := c.Convert(input, tt.format, WithOutputPath(output), WithTargetFileSize(tt.target), WithJPEGQuality(tt.quality))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+
+		info, err := os.Stat(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := c.Result
+		if info.Size() > tt.target || r.Size != info.Size() {
+			t.Errorf("%s: %d bytes written, result says %d, target %d", tt.name, info.Size(), r.Size, tt.target)
+		}
+		if r.Quality < tt.minQuality || r.Quality > tt.maxQuality {
+			t.Errorf("%s: quality %d, want %d to %d", tt.name, r.Quality, tt.minQuality, tt.maxQuality)
+		}
+		if resized := r.Width != 200 || r.Height != 150; resized != tt.resized {
+			t.Errorf("%s: size %dx%d, want resized %v", tt.name, r.Width, r.Height, tt.resized)
+		}
+
+		out, err := os.Open(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := jpeg.DecodeConfig(out)
+		out.Close()
+		if err != nil || cfg.Width != r.Width || cfg.Height != r.Height || cfg.ColorModel != color.YCbCrModel {
+			t.Errorf("%s: output is %+v, %v, want a %dx%d JPEG", tt.name, cfg, err, r.Width, r.Height)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package converter
+
+import (
+	"archive/zip"
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// Limits bounds the resources a single input may consume once decoded. The
+// checks run on headers and directories before any full decode, so small
+// files that expand enormously are rejected cheaply. Zero disables a limit.
+type Limits struct {
+	MaxPixels          int64 // width * height of a decoded image
+	MaxZipEntries      int   // files in a DOCX archive
+	MaxZipUncompressed int64 // total uncompressed bytes of a DOCX archive
+	MaxPages           int   // pages of a PDF input
+}
+
+// DefaultLimits returns the limits used unless configured otherwise
+func DefaultLimits() Limits {
+	return Limits{
+		MaxPixels:          100_000_000,
+		MaxZipEntries:      10_000,
+		MaxZipUncompressed: 512 << 20,
+		MaxPages:           2_000,
+	}
+}
+
+// LimitError reports an input that would exceed one of the Limits
+type LimitError struct {
+	Resource string // what was measured, e.g. "image pixels"
+	Value    int64
+	Max      int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s of %d exceeds the limit of %d", e.Resource, e.Value, e.Max)
+}
+
+func (e *LimitError) Is(target error) bool { return target == ErrLimitExceeded }
+
+// checkPixels fails when an image of width x height exceeds MaxPixels
+func (l Limits) checkPixels(width, height int) error {
+	pixels := int64(width) * int64(height)
+	if l.MaxPixels > 0 && pixels > l.MaxPixels {
+		return &LimitError{"image pixels", pixels, l.MaxPixels}
+	}
+	return nil
+}
+
+// checkAnimation fails when the frames of an animation cover more than
+// MaxPixels together, as they are all decoded at once
+func (l Limits) checkAnimation(pixels int64) error {
+	if l.MaxPixels > 0 && pixels > l.MaxPixels {
+		return &LimitError{"animation pixels", pixels, l.MaxPixels}
+	}
+	return nil
+}
+
+// checkImageFile reads only the header of an image file and fails when its
+// dimensions exceed MaxPixels
+func (l Limits) checkImageFile(inputFile string) error {
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return fmt.Errorf("error opening input file: %w", err)
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return corruptInput("error decoding image", err)
+	}
+	return l.checkPixels(cfg.Width, cfg.Height)
+}
+
+// checkZipFile inspects the central directory of a ZIP based document and
+// fails when it holds too many entries or expands beyond MaxZipUncompressed
+func (l Limits) checkZipFile(inputFile string) error {
+	archive, err := zip.OpenReader(inputFile)
+	if err != nil {
+		return corruptInput("error reading document archive", err)
+	}
+	defer archive.Close()
+
+	entries := int64(len(archive.File))
+	if l.MaxZipEntries > 0 && entries > int64(l.MaxZipEntries) {
+		return &LimitError{"archive entries", entries, int64(l.MaxZipEntries)}
+	}
+
+	var total int64
+	for _, entry := range archive.File {
+		// The declared sizes are trusted here; archive/zip fails reads that
+		// produce more than an entry declares
+		total += int64(entry.UncompressedSize64)
+		if l.MaxZipUncompressed > 0 && (total > l.MaxZipUncompressed || total < 0) {
+			return &LimitError{"archive uncompressed bytes", total, l.MaxZipUncompressed}
+		}
+	}
+	return nil
+}
+
+// checkPages fails when a PDF has more than MaxPages pages
+func (l Limits) checkPages(pageCount int) error {
+	if l.MaxPages > 0 && pageCount > l.MaxPages {
+		return &LimitError{"pages", int64(pageCount), int64(l.MaxPages)}
+	}
+	return nil
+}
+
+// checkPDFFiles counts the pages of PDF files, opening them with password
+// when they are protected, and fails when there are more than MaxPages in
+// total
+func (l Limits) checkPDFFiles(inputFiles []string, password string) error {
+	if l.MaxPages <= 0 {
+		return nil
+	}
+
+	conf := pdfcpuConfig(password)
+
+	total := 0
+	for _, inputFile := range inputFiles {
+		input, err := os.Open(inputFile)
+		if err != nil {
+			return fmt.Errorf("error opening input file: %w", err)
+		}
+		pageCount, err := api.PageCount(input, conf)
+		input.Close()
+		if err != nil {
+			return pdfReadError("error reading pdf", err)
+		}
+
+		total += pageCount
+		if err := l.checkPages(total); err != nil {
+			return err
+		}
+	}
+	return nil
+}
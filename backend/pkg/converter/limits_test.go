@@ -0,0 +1,51 @@
+package converter
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestImageToDocxChecksPixels(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 100, 100)))
+	f.Close()
+
+	err = NewImageToDocxConverter().ConvertToDocx(input,
+		WithOutputPath(filepath.Join(dir, "out.docx")), WithLimits(Limits{MaxPixels: 5_000}))
+	var limit *LimitError
+	if !errors.As(err, &limit) || limit.Value != 10_000 {
+		t.Errorf("error = %v, want a limit error for 10000 pixels", err)
+	}
+}
+
+func TestImageSheetChecksPixels(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	f.Close()
+
+	items := make([]SheetItem, 4)
+	for i := range items {
+		items[i] = SheetItem{Path: input}
+	}
+	err = NewContactSheetConverter().CreateSheet(items, "png",
+		WithOutputPath(filepath.Join(dir, "sheet.png")), WithSheetLayout(2, 0), WithSheetCellSize(100), WithSheetCaptions(false),
+		WithLimits(Limits{MaxPixels: 30_000}))
+	var limit *LimitError
+	if !errors.As(err, &limit) || limit.Value != 40_000 {
+		t.Errorf("error = %v, want a limit error for 40000 pixels", err)
+	}
+}
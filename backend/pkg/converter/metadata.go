@@ -0,0 +1,318 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+)
+
+// ImageInfo describes an image without converting it
+type ImageInfo struct {
+	Format     string            `json:"format"`
+	Width      int               `json:"width"`
+	Height     int               `json:"height"`
+	ColorModel string            `json:"color_model"`
+	Frames     int               `json:"frames"`
+	HasXMP     bool              `json:"has_xmp"`
+	EXIF       map[string]string `json:"exif,omitempty"`
+}
+
+// JPEG markers used when walking segments
+const (
+	markerSOI   = 0xD8
+	markerSOS   = 0xDA
+	markerAPP1  = 0xE1
+	markerAPP2  = 0xE2
+	markerAPP13 = 0xED
+	markerAPP14 = 0xEE
+	markerCOM   = 0xFE
+)
+
+var (
+	exifHeader = []byte("Exif\x00\x00")
+	xmpHeader  = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	iccHeader  = []byte("ICC_PROFILE\x00")
+)
+
+// InspectImage reads the format, dimensions, color model, frame count and
+// metadata of an image file. Only headers are read, and the dimensions are
+// checked against the pixel limit of options like any other input.
+func InspectImage(inputFile string, options ...ConvertOption) (*ImageInfo, error) {
+	opts := DefaultOptions()
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	data, err := os.ReadFile(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("error opening input file: %w", err)
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, corruptInput("error decoding image", err)
+	}
+	if err := opts.Limits.checkPixels(cfg.Width, cfg.Height); err != nil {
+		return nil, err
+	}
+
+	info := &ImageInfo{
+		Format:     format,
+		Width:      cfg.Width,
+		Height:     cfg.Height,
+		ColorModel: colorModelName(cfg.ColorModel),
+		Frames:     1,
+	}
+
+	if format == "gif" {
+		frames, pixels, err := gifFrames(data)
+		if err != nil {
+			return nil, corruptInput("error reading gif frames", err)
+		}
+		if err := opts.Limits.checkAnimation(pixels); err != nil {
+			return nil, err
+		}
+		info.Frames = frames
+	}
+
+	var exif []byte
+	switch format {
+	case "jpeg":
+		exif, info.HasXMP = jpegMetadata(data)
+	case "png":
+		exif, info.HasXMP = pngMetadata(data)
+	}
+	if exif != nil {
+		if fields, err := parseEXIF(exif); err == nil && len(fields) > 0 {
+			info.EXIF = fields
+		}
+	}
+
+	return info, nil
+}
+
+// gifFrames walks the blocks of a GIF file, skipping the compressed image
+// data, and returns the number of frames and their total area in pixels
+func gifFrames(data []byte) (frames int, pixels int64, err error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+	// Header and logical screen descriptor
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, err
+	}
+	if err := skipColorTable(r, header[10]); err != nil {
+		return 0, 0, err
+	}
+
+	for {
+		block, err := r.ReadByte()
+		if err != nil {
+			return 0, 0, err
+		}
+		switch block {
+		case 0x21: // extension: label, then sub-blocks
+			if _, err := r.ReadByte(); err != nil {
+				return 0, 0, err
+			}
+		case 0x2C: // image descriptor, then LZW code size and sub-blocks
+			desc := make([]byte, 9)
+			if _, err := io.ReadFull(r, desc); err != nil {
+				return 0, 0, err
+			}
+			width := int64(binary.LittleEndian.Uint16(desc[4:6]))
+			height := int64(binary.LittleEndian.Uint16(desc[6:8]))
+			frames++
+			pixels += width * height
+			if err := skipColorTable(r, desc[8]); err != nil {
+				return 0, 0, err
+			}
+			if _, err := r.ReadByte(); err != nil {
+				return 0, 0, err
+			}
+		case 0x3B: // trailer
+			return frames, pixels, nil
+		default:
+			return 0, 0, fmt.Errorf("unknown gif block 0x%02x", block)
+		}
+		if err := skipSubBlocks(r); err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+// skipColorTable skips the color table announced by the packed field of a
+// GIF screen or image descriptor
+func skipColorTable(r *bufio.Reader, packed byte) error {
+	if packed&0x80 == 0 {
+		return nil
+	}
+	_, err := r.Discard(3 << ((packed & 0x07) + 1))
+	return err
+}
+
+// skipSubBlocks skips GIF data sub-blocks up to the empty terminator
+func skipSubBlocks(r *bufio.Reader) error {
+	for {
+		size, err := r.ReadByte()
+		if err != nil || size == 0 {
+			return err
+		}
+		if _, err := r.Discard(int(size)); err != nil {
+			return err
+		}
+	}
+}
+
+// colorModelName returns a readable name for the standard color models
+func colorModelName(model color.Model) string {
+	if _, ok := model.(color.Palette); ok {
+		return "paletted"
+	}
+	switch model {
+	case color.RGBAModel:
+		return "rgba"
+	case color.RGBA64Model:
+		return "rgba64"
+	case color.NRGBAModel:
+		return "nrgba"
+	case color.NRGBA64Model:
+		return "nrgba64"
+	case color.AlphaModel, color.Alpha16Model:
+		return "alpha"
+	case color.GrayModel:
+		return "gray"
+	case color.Gray16Model:
+		return "gray16"
+	case color.CMYKModel:
+		return "cmyk"
+	case color.YCbCrModel:
+		return "ycbcr"
+	default:
+		return "unknown"
+	}
+}
+
+// jpegMetadata returns the EXIF payload of a JPEG and whether it carries XMP
+func jpegMetadata(data []byte) (exif []byte, hasXMP bool) {
+	walkJPEGSegments(data, func(marker byte, payload []byte) {
+		if marker != markerAPP1 {
+			return
+		}
+		if bytes.HasPrefix(payload, exifHeader) && exif == nil {
+			exif = payload[len(exifHeader):]
+		}
+		if bytes.HasPrefix(payload, xmpHeader) {
+			hasXMP = true
+		}
+	})
+	return exif, hasXMP
+}
+
+// walkJPEGSegments calls fn for every marker segment before the scan data
+func walkJPEGSegments(data []byte, fn func(marker byte, payload []byte)) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != markerSOI {
+		return
+	}
+
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == markerSOS {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return
+		}
+		fn(marker, data[pos+4:pos+2+length])
+		pos += 2 + length
+	}
+}
+
+// pngMetadata returns the eXIf chunk of a PNG and whether it carries XMP
+func pngMetadata(data []byte) (exif []byte, hasXMP bool) {
+	pos := 8
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		kind := string(data[pos+4 : pos+8])
+		if length < 0 || pos+12+length > len(data) {
+			break
+		}
+		chunk := data[pos+8 : pos+8+length]
+
+		switch kind {
+		case "eXIf":
+			exif = chunk
+		case "iTXt":
+			if bytes.HasPrefix(chunk, []byte("XML:com.adobe.xmp\x00")) {
+				hasXMP = true
+			}
+		case "IEND":
+			return exif, hasXMP
+		}
+		pos += 12 + length
+	}
+	return exif, hasXMP
+}
+
+// StripJPEGMetadata copies a JPEG from r to w without EXIF, XMP, IPTC and
+// comment segments. The compressed image data is copied unchanged, so the
+// result is lossless. ICC profiles and Adobe color transform markers are kept.
+func StripJPEGMetadata(r io.Reader, w io.Writer) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading jpeg: %w", err)
+	}
+	if len(data) < 2 || data[0] != 0xFF || data[1] != markerSOI {
+		return fmt.Errorf("input is not a jpeg image")
+	}
+
+	out := bufio.NewWriter(w)
+	out.Write(data[:2])
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return &kindError{ErrCorruptInput, fmt.Errorf("invalid jpeg segment at offset %d", pos)}
+		}
+		marker := data[pos+1]
+		if marker == markerSOS {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return &kindError{ErrCorruptInput, fmt.Errorf("truncated jpeg segment at offset %d", pos)}
+		}
+
+		if keepJPEGSegment(marker, data[pos+4:end]) {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	// Everything from the start of scan onwards is image data
+	out.Write(data[pos:])
+	return out.Flush()
+}
+
+// keepJPEGSegment reports whether a segment is needed to render the image
+func keepJPEGSegment(marker byte, payload []byte) bool {
+	switch {
+	case marker == markerAPP2:
+		return bytes.HasPrefix(payload, iccHeader)
+	case marker == markerAPP14:
+		return true // Adobe color transform
+	case marker == markerCOM, marker == markerAPP13:
+		return false
+	case marker >= markerAPP1 && marker <= 0xEF:
+		return false
+	default:
+		return true // APP0 (JFIF), tables and frame headers
+	}
+}
@@ -0,0 +1,302 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// tiffEntry is one field of a test IFD. A value of an IFD pointer tag is
+// filled in with the offset of the nested IFD.
+type tiffEntry struct {
+	tag   uint16
+	typ   uint16
+	n     uint32
+	value []byte
+	ifd   []tiffEntry // nested IFD for tagExifIFD and tagGPSIFD
+}
+
+// buildEXIF lays out a TIFF structure with ifd0 and its nested IFDs
+func buildEXIF(order binary.ByteOrder, ifd0 []tiffEntry) []byte {
+	var buf bytes.Buffer
+	if order == binary.LittleEndian {
+		buf.WriteString("II")
+	} else {
+		buf.WriteString("MM")
+	}
+	binary.Write(&buf, order, uint16(42))
+	binary.Write(&buf, order, uint32(8))
+
+	var writeIFD func(entries []tiffEntry)
+	writeIFD = func(entries []tiffEntry) {
+		start := buf.Len()
+		// Values and nested IFDs follow the entries and the next IFD offset
+		data := start + 2 + 12*len(entries) + 4
+		var tail bytes.Buffer
+		var nested [][]tiffEntry
+		var nestedAt []int
+		binary.Write(&buf, order, uint16(len(entries)))
+		for _, e := range entries {
+			binary.Write(&buf, order, e.tag)
+			binary.Write(&buf, order, e.typ)
+			binary.Write(&buf, order, e.n)
+			switch {
+			case e.ifd != nil:
+				nested, nestedAt = append(nested, e.ifd), append(nestedAt, buf.Len())
+				buf.Write(make([]byte, 4))
+			case len(e.value) > 4:
+				binary.Write(&buf, order, uint32(data+tail.Len()))
+				tail.Write(e.value)
+			default:
+				buf.Write(append(e.value, make([]byte, 4-len(e.value))...))
+			}
+		}
+		buf.Write(make([]byte, 4))
+		buf.Write(tail.Bytes())
+		for i, entries := range nested {
+			order.PutUint32(buf.Bytes()[nestedAt[i]:], uint32(buf.Len()))
+			writeIFD(entries)
+		}
+	}
+	writeIFD(ifd0)
+	return buf.Bytes()
+}
+
+func ascii(s string) (uint16, uint32, []byte) { return 2, uint32(len(s) + 1), append([]byte(s), 0) }
+
+// testEXIF returns an EXIF payload with fields in IFD0, the Exif IFD and
+// the GPS IFD, and the fields parseEXIF should find in it
+func testEXIF(order binary.ByteOrder) ([]byte, map[string]string) {
+	short := func(v uint16) []byte { b := make([]byte, 2); order.PutUint16(b, v); return b }
+	rational := func(num, den uint32) []byte {
+		b := make([]byte, 8)
+		order.PutUint32(b, num)
+		order.PutUint32(b[4:], den)
+		return b
+	}
+	entry := func(tag uint16, typ uint16, n uint32, value []byte) tiffEntry {
+		return tiffEntry{tag: tag, typ: typ, n: n, value: value}
+	}
+	makeTyp, makeN, makeValue := ascii("Canon")
+	modelTyp, modelN, modelValue := ascii("EOS R5")
+	refTyp, refN, refValue := ascii("N")
+
+	data := buildEXIF(order, []tiffEntry{
+		entry(0x010F, makeTyp, makeN, makeValue),
+		entry(0x0110, modelTyp, modelN, modelValue),
+		entry(0x0112, 3, 1, short(6)),
+		entry(0x9999, 3, 1, short(1)), // unknown tag
+		{tag: tagExifIFD, typ: 4, n: 1, ifd: []tiffEntry{
+			entry(0x829D, 5, 1, rational(28, 10)),
+			entry(0x9204, 10, 1, rational(uint32(0xffffffff), 3)), // -1/3
+			entry(0x8827, 3, 2, append(short(100), short(200)...)),
+			entry(0x927C, 7, 4, []byte("note")), // MakerNote, unknown and binary
+		}},
+		{tag: tagGPSIFD, typ: 4, n: 1, ifd: []tiffEntry{
+			entry(0x0001, refTyp, refN, refValue),
+			entry(0x0002, 5, 3, append(append(rational(51, 1), rational(30, 1)...), rational(0, 1)...)),
+		}},
+	})
+	return data, map[string]string{
+		"Make":              "Canon",
+		"Model":             "EOS R5",
+		"Orientation":       "6",
+		"FNumber":           "28/10",
+		"ExposureBiasValue": "-1/3",
+		"ISOSpeedRatings":   "100, 200",
+		"GPSLatitudeRef":    "N",
+		"GPSLatitude":       "51/1, 30/1, 0/1",
+	}
+}
+
+func TestParseEXIF(t *testing.T) {
+	little, want := testEXIF(binary.LittleEndian)
+	big, _ := testEXIF(binary.BigEndian)
+
+	// IFD0 whose Exif IFD pointer points back at IFD0
+	loop := buildEXIF(binary.LittleEndian, []tiffEntry{{tag: tagExifIFD, typ: 4, n: 1, value: []byte{8, 0, 0, 0}}})
+	// A value pointing past the end of the data
+	outside := buildEXIF(binary.LittleEndian, []tiffEntry{{tag: 0x010F, typ: 2, n: 100, value: []byte{0xf0, 0xff, 0, 0}}})
+
+	tests := []struct {
+		name string
+		data []byte
+		want map[string]string
+		ok   bool
+	}{
+		{"little endian", little, want, true},
+		{"big endian", big, want, true},
+		{"pointer loop", loop, map[string]string{}, true},
+		{"value outside", outside, map[string]string{}, true},
+		{"truncated entries", little[:20], map[string]string{}, true},
+		{"short", []byte("II*\x00"), nil, false},
+		{"bad byte order", []byte("XX*\x00\x08\x00\x00\x00"), nil, false},
+		{"bad magic", []byte("II\x2b\x00\x08\x00\x00\x00"), nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseEXIF(tt.data)
+		if (err == nil) != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: parseEXIF = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// jpegSegment formats a JPEG marker segment
+func jpegSegment(marker byte, payload []byte) []byte {
+	return append([]byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...)
+}
+
+// testJPEG encodes a small JPEG and inserts segments after its SOI marker
+func testJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, data[2:]...)
+}
+
+// pngChunk formats a PNG chunk with its CRC
+func pngChunk(kind string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(append(chunk, kind...), payload...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestInspectImage(t *testing.T) {
+	dir := t.TempDir()
+	exif, fields := testEXIF(binary.BigEndian)
+	xmp := append(append([]byte{}, xmpHeader...), "<x:xmpmeta/>"...)
+
+	var pngData bytes.Buffer
+	png.Encode(&pngData, image.NewNRGBA(image.Rect(0, 0, 5, 4)))
+	// eXIf and XMP chunks go after IHDR, which ends 33 bytes in
+	pngWithEXIF := append(append([]byte{}, pngData.Bytes()[:33]...), pngChunk("eXIf", exif)...)
+	pngWithEXIF = append(pngWithEXIF, pngChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"))...)
+	pngWithEXIF = append(pngWithEXIF, pngData.Bytes()[33:]...)
+
+	var gifData bytes.Buffer
+	frame := image.NewPaletted(image.Rect(0, 0, 3, 2), palette.Plan9)
+	gif.EncodeAll(&gifData, &gif.GIF{Image: []*image.Paletted{frame, frame, frame}, Delay: []int{0, 0, 0}})
+
+	tests := []struct {
+		name   string
+		data   []byte
+		limits Limits
+		want   ImageInfo
+		err    error
+	}{
+		{"jpeg", testJPEG(t), DefaultLimits(),
+			ImageInfo{Format: "jpeg", Width: 8, Height: 6, ColorModel: colorModelName(color.YCbCrModel), Frames: 1}, nil},
+		{"jpeg with metadata", testJPEG(t, jpegSegment(markerAPP1, append(append([]byte{}, exifHeader...), exif...)), jpegSegment(markerAPP1, xmp)), DefaultLimits(),
+			ImageInfo{Format: "jpeg", Width: 8, Height: 6, ColorModel: colorModelName(color.YCbCrModel), Frames: 1, HasXMP: true, EXIF: fields}, nil},
+		{"jpeg with bad exif", testJPEG(t, jpegSegment(markerAPP1, append(append([]byte{}, exifHeader...), "junk"...))), DefaultLimits(),
+			ImageInfo{Format: "jpeg", Width: 8, Height: 6, ColorModel: colorModelName(color.YCbCrModel), Frames: 1}, nil},
+		{"png with metadata", pngWithEXIF, DefaultLimits(),
+			ImageInfo{Format: "png", Width: 5, Height: 4, ColorModel: colorModelName(color.NRGBAModel), Frames: 1, HasXMP: true, EXIF: fields}, nil},
+		{"animated gif", gifData.Bytes(), DefaultLimits(),
+			ImageInfo{Format: "gif", Width: 3, Height: 2, ColorModel: colorModelName(color.Palette(palette.Plan9)), Frames: 3}, nil},
+		{"over the pixel limit", testJPEG(t), Limits{MaxPixels: 40}, ImageInfo{}, ErrLimitExceeded},
+		{"animation over the limit", gifData.Bytes(), Limits{MaxPixels: 15}, ImageInfo{}, ErrLimitExceeded},
+		{"not an image", []byte("hello"), DefaultLimits(), ImageInfo{}, ErrCorruptInput},
+	}
+	for _, tt := range tests {
+		input := filepath.Join(dir, "in")
+		if err := os.WriteFile(input, tt.data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		info, err := InspectImage(input, WithLimits(tt.limits))
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(*info, tt.want) {
+			t.Errorf("%s: InspectImage = %+v, want %+v", tt.name, *info, tt.want)
+		}
+	}
+}
+
+func TestStripJPEGMetadata(t *testing.T) {
+	exif, _ := testEXIF(binary.LittleEndian)
+	kept := [][]byte{
+		jpegSegment(markerAPP2, append(append([]byte{}, iccHeader...), 1, 1, 0, 0)),
+		jpegSegment(markerAPP14, []byte("Adobe\x00\x64\x00\x00\x00\x00\x01")),
+	}
+	removed := [][]byte{
+		jpegSegment(markerAPP1, append(append([]byte{}, exifHeader...), exif...)),
+		jpegSegment(markerAPP1, append(append([]byte{}, xmpHeader...), "<x:xmpmeta/>"...)),
+		jpegSegment(markerAPP13, []byte("Photoshop 3.0\x00")),
+		jpegSegment(markerCOM, []byte("a comment")),
+		jpegSegment(markerAPP2, []byte("MPF\x00")),
+	}
+	plain := testJPEG(t, kept...)
+	input := testJPEG(t, append(append([][]byte{}, removed...), kept...)...)
+
+	var out bytes.Buffer
+	if err := StripJPEGMetadata(bytes.NewReader(input), &out); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), plain) {
+		t.Errorf("stripped jpeg differs from the jpeg without metadata segments")
+	}
+	if exif, xmp := jpegMetadata(out.Bytes()); exif != nil || xmp {
+		t.Error("stripped jpeg still has EXIF or XMP")
+	}
+
+	for name, data := range map[string][]byte{
+		"not a jpeg":        []byte("\x89PNG\r\n\x1a\n"),
+		"truncated segment": append([]byte{0xFF, markerSOI}, jpegSegment(markerAPP1, make([]byte, 20))[:10]...),
+		"garbage segment":   append([]byte{0xFF, markerSOI}, "garbage!"...),
+	} {
+		if err := StripJPEGMetadata(bytes.NewReader(data), &bytes.Buffer{}); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestConvertStripsMetadata(t *testing.T) {
+	dir := t.TempDir()
+	exif, _ := testEXIF(binary.LittleEndian)
+	input := filepath.Join(dir, "in.jpg")
+	if err := os.WriteFile(input, testJPEG(t, jpegSegment(markerAPP1, append(append([]byte{}, exifHeader...), exif...))), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"jpg", "png"} {
+		output := filepath.Join(dir, "out."+format)
+		c := NewImageFormatConverter()
+		if err := c.Convert(input, format, WithOutputPath(output), WithStripMetadata(true)); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		info, err := InspectImage(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.EXIF != nil || info.HasXMP || info.Width != 8 || info.Height != 6 {
+			t.Errorf("%s: output %+v, want an 8x6 image without metadata", format, info)
+		}
+		if c.Result.Width != 8 || c.Result.Height != 6 {
+			t.Errorf("%s: result %+v, want 8x6", format, c.Result)
+		}
+	}
+}
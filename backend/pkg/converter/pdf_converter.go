@@ -1,8 +1,11 @@
 package converter
 
 import (
+	"bytes"
 	"fmt"
 	"image"
+	"image/png"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,6 +13,7 @@ import (
 
 	"github.com/go-pdf/fpdf"
 	"github.com/unidoc/unioffice/document"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // PDFConverter interface for converting files to PDF
@@ -33,6 +37,45 @@ func (c *PDFFileConverter) ConvertToPDF(inputFile string, options ...ConvertOpti
 	return fmt.Errorf("base converter does not implement specific conversion logic")
 }
 
+// newPDFDocument creates an A4 document with the metadata and page
+// decorations, such as watermarks, requested in opts
+func newPDFDocument(opts ConvertOptions) (*fpdf.Fpdf, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	applyPDFMetadata(pdf, opts.Metadata)
+	if opts.PDFA != "" {
+		if err := preparePDFA(pdf, opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Watermark != nil {
+		if err := applyPDFWatermark(pdf, opts); err != nil {
+			return nil, err
+		}
+	}
+	return pdf, nil
+}
+
+// writePDFDocument writes pdf to outputFile and applies the post-processing
+// requested in opts, such as PDF/A conversion or encryption
+func writePDFDocument(pdf *fpdf.Fpdf, outputFile string, opts ConvertOptions) (err error) {
+	if err := checkContext(opts); err != nil {
+		return err
+	}
+	span := startStage(opts, stageEncode, attribute.String("format", "pdf"))
+	defer func() { endStage(span, err) }()
+
+	if opts.PDFA != "" {
+		return writePDFA(pdf, outputFile, opts)
+	}
+	if err := pdf.OutputFileAndClose(outputFile); err != nil {
+		return err
+	}
+	if opts.Protection != nil {
+		return encryptPDF(outputFile, opts.Protection)
+	}
+	return nil
+}
+
 // ImageConverter handles conversion of image files to PDF
 type ImageConverter struct {
 	PDFFileConverter
@@ -67,28 +110,35 @@ func (p *ConversionProgress) Step() {
 
 // ConvertToPDF implements the PDFConverter interface for images
 func (c *ImageConverter) ConvertToPDF(inputFile string, options ...ConvertOption) error {
-	progress := NewConversionProgress(4, func(p float64) {
-		fmt.Printf("Conversion progress: %.2f%%\n", p)
-	})
+	// Apply options
+	for _, opt := range options {
+		opt(&c.Options)
+	}
 
-	f, err := os.Open(inputFile)
-	if err != nil {
-		return fmt.Errorf("failed to open image: %w", err)
+	if isSVGFile(inputFile) {
+		return c.convertSVG(inputFile)
 	}
-	defer f.Close()
-	progress.Step()
 
-	img, _, err := image.Decode(f)
+	progress := NewConversionProgress(3, c.progress(ConversionImageToPDF))
+
+	span := startStage(c.Options, stageDecode)
+	cfg, err := c.decodeConfig(inputFile)
+	endStage(span, err)
 	if err != nil {
-		return fmt.Errorf("failed to decode image: %w", err)
+		return err
 	}
-	progress.Step()
+	progress.Step() // 33%
 
-	bounds := img.Bounds()
+	bounds := image.Rect(0, 0, cfg.Width, cfg.Height)
 	imgWidth := float64(bounds.Dx())
 	imgHeight := float64(bounds.Dy())
 	// PDF creation and image scaling
-	pdf := fpdf.New("P", "mm", "A4", "")
+	span = startStage(c.Options, stageRender)
+	pdf, err := newPDFDocument(c.Options)
+	if err != nil {
+		endStage(span, err)
+		return err
+	}
 	pdf.AddPage()
 	// Scale image to fit on page while maintaining aspect ratio
 	width := imgWidth
@@ -98,18 +148,125 @@ func (c *ImageConverter) ConvertToPDF(inputFile string, options ...ConvertOption
 		width = c.Options.MaxImageWidth
 		height = height * ratio
 	}
-	progress.Step() // 75%
 
-	pdf.Image(inputFile, c.Options.MarginLeft, c.Options.MarginTop, width, height, false, "", 0, "")
+	// fpdf only reads JPEG, PNG and GIF itself, so register the image first
+	imageName, _, err := pdfImageRegistrar(c.Options)(pdf, inputFile, c.Options.Limits)
+	if err != nil {
+		endStage(span, err)
+		return err
+	}
+	pdf.Image(imageName, c.Options.MarginLeft, c.Options.MarginTop, width, height, false, "", 0, "")
+	endStage(span, pdf.Error())
+	progress.Step() // 67%
 
 	// Write PDF
-	outputFile := GetOutputFilename(inputFile, ".pdf")
-	err = pdf.OutputFileAndClose(outputFile)
+	outputFile := c.Options.OutputPath
+	if outputFile == "" {
+		outputFile = GetOutputFilename(inputFile, ".pdf")
+	}
+	err = writePDFDocument(pdf, outputFile, c.Options)
 	progress.Step() // 100%
 
 	return err
 }
 
+// decodeConfig reads the size of an image from its header and checks it
+// against the pixel limit, before the image is registered and decoded
+func (c *ImageConverter) decodeConfig(inputFile string) (image.Config, error) {
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return image.Config{}, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return image.Config{}, corruptInput("failed to decode image", err)
+	}
+	return cfg, c.Options.Limits.checkPixels(cfg.Width, cfg.Height)
+}
+
+// convertSVG rasterizes an SVG at SVGDPI and places it at its physical size,
+// scaled down to MaxImageWidth if needed
+func (c *ImageConverter) convertSVG(inputFile string) error {
+	img, err := rasterizeSVG(inputFile, c.Options)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return fmt.Errorf("failed to encode svg: %w", err)
+	}
+
+	pdf, err := newPDFDocument(c.Options)
+	if err != nil {
+		return err
+	}
+	pdf.AddPage()
+	pdf.RegisterImageOptionsReader(inputFile, fpdf.ImageOptions{ImageType: "png"}, &buf)
+
+	dpi := c.Options.SVGDPI
+	if dpi <= 0 || c.Options.SVGWidth > 0 || c.Options.SVGHeight > 0 {
+		dpi = svgBaseDPI
+	}
+	bounds := img.Bounds()
+	width := float64(bounds.Dx()) * 25.4 / dpi
+	height := float64(bounds.Dy()) * 25.4 / dpi
+	if width > c.Options.MaxImageWidth {
+		height = height * c.Options.MaxImageWidth / width
+		width = c.Options.MaxImageWidth
+	}
+	pdf.ImageOptions(inputFile, c.Options.MarginLeft, c.Options.MarginTop, width, height,
+		false, fpdf.ImageOptions{}, 0, "")
+
+	outputFile := c.Options.OutputPath
+	if outputFile == "" {
+		outputFile = GetOutputFilename(inputFile, ".pdf")
+	}
+	return writePDFDocument(pdf, outputFile, c.Options)
+}
+
+// registerPDFImage adds an image file to pdf and returns its name and pixel
+// size. Formats fpdf cannot read natively are re-encoded as PNG.
+func registerPDFImage(pdf *fpdf.Fpdf, inputFile string, limits Limits) (string, image.Point, error) {
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return "", image.Point{}, fmt.Errorf("failed to open image: %w", err)
+	}
+	defer f.Close()
+
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return "", image.Point{}, corruptInput("failed to decode image", err)
+	}
+	if err := limits.checkPixels(cfg.Width, cfg.Height); err != nil {
+		return "", image.Point{}, err
+	}
+	size := image.Point{X: cfg.Width, Y: cfg.Height}
+
+	switch format {
+	case "jpeg", "png", "gif":
+		pdf.RegisterImageOptions(inputFile, fpdf.ImageOptions{ImageType: format})
+		return inputFile, size, pdf.Error()
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", image.Point{}, fmt.Errorf("failed to read image: %w", err)
+	}
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return "", image.Point{}, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", image.Point{}, fmt.Errorf("failed to encode image: %w", err)
+	}
+	pdf.RegisterImageOptionsReader(inputFile, fpdf.ImageOptions{ImageType: "png"}, &buf)
+	return inputFile, size, pdf.Error()
+}
+
 // DocxConverter handles conversion of Word documents to PDF
 type DocxConverter struct {
 	PDFFileConverter
@@ -123,22 +280,42 @@ func NewDocxConverter() *DocxConverter {
 
 // ConvertToPDF implements the PDFConverter interface for DOCX files
 func (c *DocxConverter) ConvertToPDF(inputFile string, options ...ConvertOption) error {
+	// Apply options
+	for _, opt := range options {
+		opt(&c.Options)
+	}
 
-	progress := NewConversionProgress(4, c.progressCallback)
+	progress := NewConversionProgress(4, c.progress(ConversionDocxToPDF))
 
-	doc, err := document.Open(inputFile)
+	span := startStage(c.Options, stageDecode)
+	doc, err := c.openDocument(inputFile)
+	endStage(span, err)
 	if err != nil {
-		return fmt.Errorf("failed to open document: %w", err)
+		return err
 	}
 	defer doc.Close()
 	progress.Step() // 25%
 
-	pdf := fpdf.New("P", "mm", "A4", "")
+	// Explicit metadata options take precedence over the core properties
+	opts := c.Options
+	opts.Metadata = opts.Metadata.withFallback(docxMetadata(doc))
+
+	span = startStage(c.Options, stageRender)
+	pdf, err := newPDFDocument(opts)
+	if err != nil {
+		endStage(span, err)
+		return err
+	}
 	pdf.AddPage()
-	pdf.SetFont(c.Options.FontName, "", c.Options.FontSize)
+	fontName := documentFont(opts)
+	pdf.SetFont(fontName, "", c.Options.FontSize)
 
 	// Process paragraphs
 	for _, para := range doc.Paragraphs() {
+		if err := checkContext(c.Options); err != nil {
+			endStage(span, err)
+			return err
+		}
 		var text strings.Builder
 
 		for _, run := range para.Runs() {
@@ -150,7 +327,7 @@ func (c *DocxConverter) ConvertToPDF(inputFile string, options ...ConvertOption)
 			if rPr.IsItalic() {
 				style += "I"
 			}
-			pdf.SetFont(c.Options.FontName, style, c.Options.FontSize)
+			pdf.SetFont(fontName, style, c.Options.FontSize)
 			text.WriteString(run.Text())
 		}
 
@@ -161,6 +338,7 @@ func (c *DocxConverter) ConvertToPDF(inputFile string, options ...ConvertOption)
 			pdf.MultiCell(190, c.Options.LineHeight, text.String(), "", "", false)
 		}
 	}
+	endStage(span, pdf.Error())
 	progress.Step() // 50%
 
 	outputFile := c.Options.OutputPath
@@ -169,21 +347,60 @@ func (c *DocxConverter) ConvertToPDF(inputFile string, options ...ConvertOption)
 	}
 	progress.Step() // 75%
 
-	err = pdf.OutputFileAndClose(outputFile)
+	err = writePDFDocument(pdf, outputFile, opts)
 	progress.Step() // 100%
 
 	return err
 }
 
+// openDocument checks the archive limits of a DOCX file and opens it
+func (c *DocxConverter) openDocument(inputFile string) (*document.Document, error) {
+	if err := c.Options.Limits.checkZipFile(inputFile); err != nil {
+		return nil, err
+	}
+	doc, err := document.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open document: %w", err)
+	}
+	return doc, nil
+}
+
 // GetPDFConverter returns the appropriate converter based on file extension
 func GetPDFConverter(inputFile string) (PDFConverter, error) {
 	ext := strings.ToLower(filepath.Ext(inputFile))
 	switch ext {
-	case ".jpg", ".jpeg", ".png", ".gif", ".bmp":
+	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".tif", ".tiff", ".svg":
 		return NewImageConverter(), nil
 	case ".doc", ".docx":
 		return NewDocxConverter(), nil
 	default:
-		return nil, fmt.Errorf("unsupported file type: %s", ext)
+		return nil, unsupportedFormat("file type", ext)
+	}
+}
+
+// GetPDFTool returns the PDF tool registered under name
+func GetPDFTool(name string) (PDFTool, error) {
+	name = strings.ToLower(name)
+	var tool PDFTool
+	switch name {
+	case "merge":
+		tool = NewPDFMerger()
+	case "split":
+		tool = NewPDFSplitter()
+	case "extract":
+		tool = NewPDFPageExtractor()
+	case "reorder":
+		tool = NewPDFPageReorderer()
+	case "rotate":
+		tool = NewPDFRotator()
+	case "metadata":
+		tool = NewPDFMetadataEditor()
+	case "encrypt":
+		tool = NewPDFEncrypter()
+	case "decrypt":
+		tool = NewPDFDecrypter()
+	default:
+		return nil, unsupportedFormat("pdf tool", name)
 	}
+	return &tracedPDFTool{PDFTool: tool, name: name}, nil
 }
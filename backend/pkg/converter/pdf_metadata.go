@@ -0,0 +1,166 @@
+package converter
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/unidoc/unioffice/document"
+)
+
+// Creator recorded in generated PDFs when none is given
+const defaultPDFCreator = "Reformat"
+
+// PDFMetadata holds the document information dictionary of a PDF
+type PDFMetadata struct {
+	Title    string `json:"title,omitempty"`
+	Author   string `json:"author,omitempty"`
+	Subject  string `json:"subject,omitempty"`
+	Keywords string `json:"keywords,omitempty"`
+	Creator  string `json:"creator,omitempty"`
+	Producer string `json:"producer,omitempty"` // read only, set by the PDF writer
+}
+
+// IsZero reports whether no editable field is set
+func (m PDFMetadata) IsZero() bool {
+	return m.Title == "" && m.Author == "" && m.Subject == "" && m.Keywords == "" && m.Creator == ""
+}
+
+// withFallback fills the empty fields of m from fallback
+func (m PDFMetadata) withFallback(fallback PDFMetadata) PDFMetadata {
+	pick := func(value, other string) string {
+		if value != "" {
+			return value
+		}
+		return other
+	}
+	return PDFMetadata{
+		Title:    pick(m.Title, fallback.Title),
+		Author:   pick(m.Author, fallback.Author),
+		Subject:  pick(m.Subject, fallback.Subject),
+		Keywords: pick(m.Keywords, fallback.Keywords),
+		Creator:  pick(m.Creator, fallback.Creator),
+	}
+}
+
+// applyPDFMetadata writes m to the document information of pdf
+func applyPDFMetadata(pdf *fpdf.Fpdf, m PDFMetadata) {
+	if m.Creator == "" {
+		m.Creator = defaultPDFCreator
+	}
+	pdf.SetTitle(m.Title, true)
+	pdf.SetAuthor(m.Author, true)
+	pdf.SetSubject(m.Subject, true)
+	pdf.SetKeywords(m.Keywords, true)
+	pdf.SetCreator(m.Creator, true)
+}
+
+// docxMetadata reads the core properties of a Word document
+func docxMetadata(doc *document.Document) PDFMetadata {
+	props := doc.CoreProperties
+	m := PDFMetadata{
+		Title:  props.Title(),
+		Author: props.Author(),
+	}
+
+	raw := props.X()
+	if raw == nil {
+		return m
+	}
+	if raw.Subject != nil {
+		m.Subject = string(raw.Subject.Data)
+	}
+	if raw.Keywords != nil {
+		var keywords []string
+		for _, k := range raw.Keywords.Value {
+			if k != nil && strings.TrimSpace(k.Content) != "" {
+				keywords = append(keywords, strings.TrimSpace(k.Content))
+			}
+		}
+		m.Keywords = strings.Join(keywords, ", ")
+	}
+	return m
+}
+
+// ReadPDFMetadata returns the document information of an existing PDF,
+// opening it with password when it is protected
+func ReadPDFMetadata(inputFile, password string) (*PDFMetadata, error) {
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("error opening input file: %w", err)
+	}
+	defer input.Close()
+
+	ctx, err := api.ReadContext(input, pdfcpuConfig(password))
+	if err != nil {
+		return nil, pdfReadError("error reading pdf", err)
+	}
+
+	m := &PDFMetadata{}
+	if ctx.Info == nil {
+		return m, nil
+	}
+	info, err := ctx.DereferenceDict(*ctx.Info)
+	if err != nil || info == nil {
+		return m, err
+	}
+
+	for key, field := range map[string]*string{
+		"Title":    &m.Title,
+		"Author":   &m.Author,
+		"Subject":  &m.Subject,
+		"Keywords": &m.Keywords,
+		"Creator":  &m.Creator,
+		"Producer": &m.Producer,
+	} {
+		if value, ok := info[key]; ok {
+			if text, err := ctx.DereferenceText(value); err == nil {
+				*field = text
+			}
+		}
+	}
+	return m, nil
+}
+
+// PDFMetadataEditor sets document information fields on an existing PDF
+type PDFMetadataEditor struct {
+	PDFToolConverter
+}
+
+func NewPDFMetadataEditor() *PDFMetadataEditor {
+	return &PDFMetadataEditor{PDFToolConverter: *NewPDFToolConverter()}
+}
+
+// Process writes the non-empty fields of Options.Metadata to the PDF,
+// leaving the other fields unchanged
+func (c *PDFMetadataEditor) Process(inputFiles []string, options ...ConvertOption) error {
+	outputFile, err := c.apply(inputFiles, 1, "-metadata.pdf", options)
+	if err != nil {
+		return err
+	}
+
+	m := c.Options.Metadata
+	if m.IsZero() {
+		return invalidOption("no metadata fields given")
+	}
+
+	properties := make(map[string]string)
+	for key, value := range map[string]string{
+		"Title":    m.Title,
+		"Author":   m.Author,
+		"Subject":  m.Subject,
+		"Keywords": m.Keywords,
+		"Creator":  m.Creator,
+	} {
+		if value != "" {
+			properties[key] = value
+		}
+	}
+
+	if err := api.AddPropertiesFile(inputFiles[0], outputFile, properties, pdfcpuConfig(c.Options.InputPassword)); err != nil {
+		return pdfProcessError("error writing metadata", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package converter
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/unidoc/unioffice/document"
+)
+
+func TestImageToPDFMetadata(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	f.Close()
+
+	tests := []struct {
+		name     string
+		metadata PDFMetadata
+		want     PDFMetadata
+	}{
+		{"default creator", PDFMetadata{}, PDFMetadata{Creator: defaultPDFCreator}},
+		{
+			"all fields",
+			PDFMetadata{Title: "Report", Author: "Ann", Subject: "Q3", Keywords: "sales, q3", Creator: "Scanner"},
+			PDFMetadata{Title: "Report", Author: "Ann", Subject: "Q3", Keywords: "sales, q3", Creator: "Scanner"},
+		},
+		{"unicode", PDFMetadata{Title: "Überblick – 概要"}, PDFMetadata{Title: "Überblick – 概要", Creator: defaultPDFCreator}},
+	}
+	for _, tt := range tests {
+		output := filepath.Join(dir, "out.pdf")
+		err := NewImageConverter().ConvertToPDF(input, WithOutputPath(output), WithPDFMetadata(tt.metadata))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got, err := ReadPDFMetadata(output, "")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got.Producer = ""
+		if *got != tt.want {
+			t.Errorf("%s: metadata = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestDocxMetadataFallback(t *testing.T) {
+	doc := document.New()
+	doc.CoreProperties.SetTitle("Minutes")
+	doc.CoreProperties.SetAuthor("Bob")
+
+	// Explicit options take precedence over the core properties
+	got := PDFMetadata{Title: "Board minutes", Subject: "October"}.withFallback(docxMetadata(doc))
+	want := PDFMetadata{Title: "Board minutes", Author: "Bob", Subject: "October"}
+	if got != want {
+		t.Errorf("metadata = %+v, want %+v", got, want)
+	}
+}
+
+func TestPDFMetadataEditor(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.pdf")
+	pdf, err := newPDFDocument(ConvertOptions{Metadata: PDFMetadata{Title: "Draft", Author: "Ann"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf.AddPage()
+	if err := pdf.OutputFileAndClose(input); err != nil {
+		t.Fatal(err)
+	}
+	protected := writeProtectedPDF(t, dir, "protected.pdf", 1)
+
+	tests := []struct {
+		name     string
+		input    string
+		password string
+		metadata PDFMetadata
+		want     PDFMetadata
+		code     Code
+	}{
+		{
+			"other fields kept", input, "", PDFMetadata{Title: "Final", Keywords: "a, b"},
+			PDFMetadata{Title: "Final", Author: "Ann", Keywords: "a, b", Creator: defaultPDFCreator}, "",
+		},
+		{"no fields", input, "", PDFMetadata{}, PDFMetadata{}, CodeInvalidOptions},
+		{"protected", protected, "owner", PDFMetadata{Author: "Cy"}, PDFMetadata{Author: "Cy"}, ""},
+		{"protected without password", protected, "", PDFMetadata{Author: "Cy"}, PDFMetadata{}, CodeInvalidPassword},
+	}
+	for _, tt := range tests {
+		output := filepath.Join(dir, "out.pdf")
+		err := NewPDFMetadataEditor().Process([]string{tt.input}, WithOutputPath(output),
+			WithPDFMetadata(tt.metadata), WithInputPassword(tt.password))
+		if code := ErrorCode(err); err != nil && code != tt.code || err == nil && tt.code != "" {
+			t.Errorf("%s: error = %v with code %s, want %s", tt.name, err, code, tt.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		got, err := ReadPDFMetadata(output, tt.password)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got.Producer = ""
+		if *got != tt.want {
+			t.Errorf("%s: metadata = %+v, want %+v", tt.name, *got, tt.want)
+		}
+	}
+}
+
+func TestReadPDFMetadataErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPDF := filepath.Join(dir, "in.pdf")
+	if err := os.WriteFile(notPDF, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	protected := writeProtectedPDF(t, dir, "protected.pdf", 1)
+
+	for _, tt := range []struct {
+		name, input, password string
+		code                  Code
+	}{
+		{"not a pdf", notPDF, "", CodeCorruptInput},
+		{"no password", protected, "", CodeInvalidPassword},
+		{"wrong password", protected, "wrong", CodeInvalidPassword},
+	} {
+		_, err := ReadPDFMetadata(tt.input, tt.password)
+		if code := ErrorCode(err); code != tt.code {
+			t.Errorf("%s: error = %v with code %s, want %s", tt.name, err, code, tt.code)
+		}
+	}
+	if _, err := ReadPDFMetadata(protected, "user"); err != nil {
+		t.Errorf("user password: %v", err)
+	}
+}
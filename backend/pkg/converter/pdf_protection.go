@@ -0,0 +1,206 @@
+package converter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// PDFProtection describes the encryption applied to generated PDFs
+type PDFProtection struct {
+	UserPassword  string // needed to open the document, may be empty
+	OwnerPassword string // needed to change permissions, random when empty
+	AllowPrint    bool
+	AllowCopy     bool
+	AllowModify   bool
+}
+
+// ParsePDFPermissions reads a comma separated list of the permissions
+// print, copy and modify, or "all" or "none"
+func ParsePDFPermissions(list string) (PDFProtection, error) {
+	var p PDFProtection
+	for _, name := range strings.Split(list, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "", "none":
+		case "all":
+			p.AllowPrint, p.AllowCopy, p.AllowModify = true, true, true
+		case "print":
+			p.AllowPrint = true
+		case "copy":
+			p.AllowCopy = true
+		case "modify":
+			p.AllowModify = true
+		default:
+			return p, invalidOption("invalid pdf permission: %s", name)
+		}
+	}
+	return p, nil
+}
+
+// encryptPDF encrypts a finished PDF in place with AES-256. fpdf's own
+// protection is not used: it only offers 40-bit RC4 and corrupts all but the
+// first string of the document information.
+func encryptPDF(file string, p *PDFProtection) error {
+	if p.UserPassword == "" && p.OwnerPassword == "" {
+		return invalidOption("pdf protection needs a user or owner password")
+	}
+
+	conf := pdfcpuConfig("")
+	conf.EncryptUsingAES = true
+	conf.EncryptKeyLength = 256
+	conf.UserPW = p.UserPassword
+	conf.OwnerPW = p.OwnerPassword
+	if conf.OwnerPW == "" {
+		// Like fpdf, use a random owner password so permissions can't be lifted
+		secret := make([]byte, 16)
+		if _, err := rand.Read(secret); err != nil {
+			return fmt.Errorf("error generating owner password: %w", err)
+		}
+		conf.OwnerPW = hex.EncodeToString(secret)
+	}
+	conf.Permissions = p.permissions()
+
+	if err := api.EncryptFile(file, "", conf); err != nil {
+		return fmt.Errorf("error encrypting pdf: %w", err)
+	}
+	return nil
+}
+
+// permissions converts the allowed actions to PDF permission flags
+func (p *PDFProtection) permissions() model.PermissionFlags {
+	flags := model.PermissionsNone
+	if p.AllowPrint {
+		flags |= model.PermissionPrintRev2 | model.PermissionPrintRev3
+	}
+	if p.AllowCopy {
+		flags |= model.PermissionExtract | model.PermissionExtractRev3
+	}
+	if p.AllowModify {
+		flags |= model.PermissionModify | model.PermissionModAnnFillForm |
+			model.PermissionFillRev3 | model.PermissionAssembleRev3
+	}
+	return flags
+}
+
+// PDFEncrypter protects an existing PDF with the passwords and permissions
+// in Options.Protection
+type PDFEncrypter struct {
+	PDFToolConverter
+}
+
+func NewPDFEncrypter() *PDFEncrypter {
+	return &PDFEncrypter{PDFToolConverter: *NewPDFToolConverter()}
+}
+
+// Process writes an encrypted copy of the PDF. A PDF that is already
+// protected is first opened with InputPassword.
+func (c *PDFEncrypter) Process(inputFiles []string, options ...ConvertOption) error {
+	outputFile, err := c.apply(inputFiles, 1, "-encrypted.pdf", options)
+	if err != nil {
+		return err
+	}
+	if c.Options.Protection == nil {
+		return invalidOption("no password given")
+	}
+
+	err = errNotEncrypted
+	if c.Options.InputPassword != "" {
+		err = decryptPDF(inputFiles[0], outputFile, c.Options.InputPassword)
+	}
+	if errors.Is(err, errNotEncrypted) {
+		err = copyFile(inputFiles[0], outputFile)
+	}
+	if err != nil {
+		return err
+	}
+	return encryptPDF(outputFile, c.Options.Protection)
+}
+
+// PDFDecrypter removes the encryption from a protected PDF
+type PDFDecrypter struct {
+	PDFToolConverter
+}
+
+func NewPDFDecrypter() *PDFDecrypter {
+	return &PDFDecrypter{PDFToolConverter: *NewPDFToolConverter()}
+}
+
+// Process writes an unencrypted copy of the PDF, opened with InputPassword
+// as either the user or the owner password
+func (c *PDFDecrypter) Process(inputFiles []string, options ...ConvertOption) error {
+	outputFile, err := c.apply(inputFiles, 1, "-decrypted.pdf", options)
+	if err != nil {
+		return err
+	}
+
+	return decryptPDF(inputFiles[0], outputFile, c.Options.InputPassword)
+}
+
+// errNotEncrypted is returned when decrypting a PDF without encryption
+var errNotEncrypted = &kindError{ErrInvalidOptions, errors.New("pdf is not encrypted")}
+
+// decryptPDF writes an unencrypted copy of a protected PDF, opened with
+// password as either the user or the owner password
+func decryptPDF(inputFile, outputFile, password string) error {
+	err := api.DecryptFile(inputFile, outputFile, pdfcpuConfig(password))
+	// pdfcpu has no sentinel for this case
+	if err != nil && strings.Contains(err.Error(), "not encrypted") {
+		return errNotEncrypted
+	}
+	if err != nil {
+		return pdfProcessError("error decrypting pdf", err)
+	}
+	return nil
+}
+
+// decryptedCopy writes an unencrypted copy of a protected PDF beside it,
+// opened with password, and returns its name and a function removing it.
+// Input without encryption is returned as is. External tools read the copy,
+// as they only take passwords on their command line, where other local
+// users could read them.
+func decryptedCopy(inputFile, password string) (string, func(), error) {
+	decrypted, err := os.CreateTemp(filepath.Dir(inputFile), "decrypted-*.pdf")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating temporary file: %w", err)
+	}
+	decrypted.Close()
+	remove := func() { os.Remove(decrypted.Name()) }
+
+	err = decryptPDF(inputFile, decrypted.Name(), password)
+	switch {
+	case err == nil:
+		return decrypted.Name(), remove, nil
+	case errors.Is(err, errNotEncrypted):
+		remove()
+		return inputFile, func() {}, nil
+	}
+	remove()
+	return "", nil, err
+}
+
+// copyFile copies src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening input file: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("error copying file: %w", err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,229 @@
+package converter
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+func TestParsePDFPermissions(t *testing.T) {
+	tests := []struct {
+		list string
+		want PDFProtection
+		ok   bool
+	}{
+		{"", PDFProtection{}, true},
+		{"none", PDFProtection{}, true},
+		{"all", PDFProtection{AllowPrint: true, AllowCopy: true, AllowModify: true}, true},
+		{"print", PDFProtection{AllowPrint: true}, true},
+		{" Copy , MODIFY ", PDFProtection{AllowCopy: true, AllowModify: true}, true},
+		{"print,,print", PDFProtection{AllowPrint: true}, true},
+		{"print,annotate", PDFProtection{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParsePDFPermissions(tt.list)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParsePDFPermissions(%q) error = %v, want ok %v", tt.list, err, tt.ok)
+			continue
+		}
+		if tt.ok && got != tt.want {
+			t.Errorf("ParsePDFPermissions(%q) = %+v, want %+v", tt.list, got, tt.want)
+		}
+		if !tt.ok && ErrorCode(err) != CodeInvalidOptions {
+			t.Errorf("ParsePDFPermissions(%q) error code = %s, want %s", tt.list, ErrorCode(err), CodeInvalidOptions)
+		}
+	}
+}
+
+// openWith reports how opening file with password fails, or nil
+func openWith(file, password string) error {
+	_, err := pdfPageCount(file, password)
+	return err
+}
+
+func TestPDFEncrypter(t *testing.T) {
+	dir := t.TempDir()
+	plain := writeTestPDF(t, dir, "plain.pdf", 2)
+	protected := writeProtectedPDF(t, dir, "protected.pdf", 2)
+
+	tests := []struct {
+		name       string
+		input      string
+		password   string // input password
+		protection *PDFProtection
+		opens      []string // passwords that open the output
+		refused    []string // passwords that don't
+		code       Code
+	}{
+		{"user and owner", plain, "", &PDFProtection{UserPassword: "u", OwnerPassword: "o"}, []string{"u", "o"}, []string{"", "x"}, ""},
+		{"user only", plain, "", &PDFProtection{UserPassword: "u"}, []string{"u"}, []string{"", "x"}, ""},
+		// Without a user password anyone can open it; only permissions apply
+		{"owner only", plain, "", &PDFProtection{OwnerPassword: "o"}, []string{"", "o"}, nil, ""},
+		{"reprotected", protected, "owner", &PDFProtection{UserPassword: "new"}, []string{"new"}, []string{"", "user", "owner"}, ""},
+		{"reprotected wrong password", protected, "wrong", &PDFProtection{UserPassword: "new"}, nil, nil, CodeInvalidPassword},
+		{"no protection", plain, "", nil, nil, nil, CodeInvalidOptions},
+		{"no passwords", plain, "", &PDFProtection{AllowPrint: true}, nil, nil, CodeInvalidOptions},
+	}
+	for _, tt := range tests {
+		output := filepath.Join(dir, "out.pdf")
+		options := []ConvertOption{WithOutputPath(output), WithInputPassword(tt.password)}
+		if tt.protection != nil {
+			options = append(options, WithPDFProtection(*tt.protection))
+		}
+		err := NewPDFEncrypter().Process([]string{tt.input}, options...)
+		if code := ErrorCode(err); err != nil && code != tt.code || err == nil && tt.code != "" {
+			t.Errorf("%s: error = %v with code %s, want %s", tt.name, err, code, tt.code)
+			continue
+		}
+		for _, password := range tt.opens {
+			if err := openWith(output, password); err != nil {
+				t.Errorf("%s: password %q does not open the output: %v", tt.name, password, err)
+			}
+		}
+		for _, password := range tt.refused {
+			if err := openWith(output, password); !errors.Is(err, pdfcpu.ErrWrongPassword) {
+				t.Errorf("%s: password %q: error = %v, want a wrong password", tt.name, password, err)
+			}
+		}
+	}
+}
+
+func TestPDFPermissions(t *testing.T) {
+	dir := t.TempDir()
+	plain := writeTestPDF(t, dir, "plain.pdf", 1)
+
+	groups := map[string]model.PermissionFlags{
+		"print":  model.PermissionPrintRev2 | model.PermissionPrintRev3,
+		"copy":   model.PermissionExtract | model.PermissionExtractRev3,
+		"modify": model.PermissionModify | model.PermissionModAnnFillForm | model.PermissionFillRev3 | model.PermissionAssembleRev3,
+	}
+	for _, list := range []string{"none", "print", "copy,modify", "all"} {
+		protection, err := ParsePDFPermissions(list)
+		if err != nil {
+			t.Fatal(err)
+		}
+		protection.OwnerPassword = "o"
+		output := filepath.Join(dir, "out.pdf")
+		if err := NewPDFEncrypter().Process([]string{plain}, WithOutputPath(output), WithPDFProtection(protection)); err != nil {
+			t.Fatalf("%s: %v", list, err)
+		}
+
+		p, err := api.GetPermissionsFile(output, pdfcpuConfig("o"))
+		if err != nil || p == nil {
+			t.Fatalf("%s: permissions = %v, %v", list, p, err)
+		}
+		got := model.PermissionFlags(uint16(*p))
+		for name, flags := range groups {
+			allowed := map[string]bool{"print": protection.AllowPrint, "copy": protection.AllowCopy, "modify": protection.AllowModify}[name]
+			if set := got&flags == flags; set != allowed {
+				t.Errorf("%s: %s allowed = %v, want %v", list, name, set, allowed)
+			}
+			if got&flags != 0 && got&flags != flags {
+				t.Errorf("%s: %s is partly allowed", list, name)
+			}
+		}
+	}
+}
+
+func TestPDFDecrypter(t *testing.T) {
+	dir := t.TempDir()
+	plain := writeTestPDF(t, dir, "plain.pdf", 1)
+	protected := writeProtectedPDF(t, dir, "protected.pdf", 1)
+
+	tests := []struct {
+		name, input, password string
+		code                  Code
+	}{
+		{"user password", protected, "user", ""},
+		{"owner password", protected, "owner", ""},
+		{"no password", protected, "", CodeInvalidPassword},
+		{"wrong password", protected, "wrong", CodeInvalidPassword},
+		{"not encrypted", plain, "user", CodeInvalidOptions},
+	}
+	for _, tt := range tests {
+		output := filepath.Join(dir, "out.pdf")
+		err := NewPDFDecrypter().Process([]string{tt.input}, WithOutputPath(output), WithInputPassword(tt.password))
+		if code := ErrorCode(err); err != nil && code != tt.code || err == nil && tt.code != "" {
+			t.Errorf("%s: error = %v with code %s, want %s", tt.name, err, code, tt.code)
+			continue
+		}
+		if err == nil {
+			if err := openWith(output, ""); err != nil {
+				t.Errorf("%s: output still needs a password: %v", tt.name, err)
+			}
+		}
+	}
+}
+
+func TestDecryptedCopy(t *testing.T) {
+	dir := t.TempDir()
+	plain := writeTestPDF(t, dir, "plain.pdf", 1)
+	protected := writeProtectedPDF(t, dir, "protected.pdf", 1)
+
+	// Input without encryption is used as is
+	file, remove, err := decryptedCopy(plain, "user")
+	if err != nil || file != plain {
+		t.Fatalf("plain input: decryptedCopy = %q, %v, want the input", file, err)
+	}
+	remove()
+	if _, err := os.Stat(plain); err != nil {
+		t.Errorf("plain input removed: %v", err)
+	}
+
+	file, remove, err = decryptedCopy(protected, "user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := openWith(file, ""); err != nil {
+		t.Errorf("copy still needs a password: %v", err)
+	}
+	remove()
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("copy not removed: %v", err)
+	}
+
+	if _, _, err := decryptedCopy(protected, "wrong"); ErrorCode(err) != CodeInvalidPassword {
+		t.Errorf("wrong password: error = %v, want code %s", err, CodeInvalidPassword)
+	}
+	// No temporary copies are left behind
+	if matches, _ := filepath.Glob(filepath.Join(dir, "decrypted-*")); len(matches) != 0 {
+		t.Errorf("temporary copies left: %v", matches)
+	}
+}
+
+func TestImageToPDFProtection(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	f.Close()
+
+	output := filepath.Join(dir, "out.pdf")
+	err = NewImageConverter().ConvertToPDF(input, WithOutputPath(output),
+		WithPDFMetadata(PDFMetadata{Title: "Secret"}),
+		WithPDFProtection(PDFProtection{UserPassword: "u"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := openWith(output, ""); !errors.Is(err, pdfcpu.ErrWrongPassword) {
+		t.Errorf("opened without password: %v", err)
+	}
+	// Encryption keeps the document information readable with the password
+	m, err := ReadPDFMetadata(output, "u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Title != "Secret" {
+		t.Errorf("title = %q, want Secret", m.Title)
+	}
+}
@@ -0,0 +1,427 @@
+package converter
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func init() {
+	// pdfcpu would otherwise create a config directory in the user's home
+	api.DisableConfigDir()
+}
+
+// PDFTool interface for tools that manipulate existing PDF files
+type PDFTool interface {
+	Process(inputFiles []string, options ...ConvertOption) error
+}
+
+// tracedPDFTool records a tool run as a transform stage, with the stages
+// of the tool nested under it
+type tracedPDFTool struct {
+	PDFTool
+	name string
+}
+
+func (t *tracedPDFTool) Process(inputFiles []string, options ...ConvertOption) error {
+	opts := DefaultOptions()
+	for _, opt := range options {
+		opt(&opts)
+	}
+	if err := checkContext(opts); err != nil {
+		return err
+	}
+	ctx, span := tracer.Start(opts.Context, "converter."+stageTransform,
+		trace.WithAttributes(attribute.String("operation", t.name), attribute.Int("files", len(inputFiles))))
+	err := t.PDFTool.Process(inputFiles, append(options, WithContext(ctx))...)
+	endStage(span, err)
+	return err
+}
+
+// PDFToolConverter handles base PDF tool functionality
+type PDFToolConverter struct {
+	BaseConverter
+}
+
+func NewPDFToolConverter() *PDFToolConverter {
+	return &PDFToolConverter{
+		BaseConverter: BaseConverter{Options: DefaultOptions()},
+	}
+}
+
+// Process implements basic PDF processing - this should be overridden by specific tools
+func (c *PDFToolConverter) Process(inputFiles []string, options ...ConvertOption) error {
+	return fmt.Errorf("base tool does not implement specific processing logic")
+}
+
+// apply applies options and returns the output file for the given suffix
+func (c *PDFToolConverter) apply(inputFiles []string, count int, suffix string, options []ConvertOption) (string, error) {
+	for _, opt := range options {
+		opt(&c.Options)
+	}
+
+	if len(inputFiles) < count {
+		return "", invalidOption("expected at least %d input files, got %d", count, len(inputFiles))
+	}
+	span := startStage(c.Options, stageDecode)
+	err := c.Options.Limits.checkPDFFiles(inputFiles, c.Options.InputPassword)
+	endStage(span, err)
+	if err != nil {
+		return "", err
+	}
+
+	outputFile := c.Options.OutputPath
+	if outputFile == "" {
+		outputFile = GetOutputFilename(inputFiles[0], suffix)
+	}
+	return outputFile, nil
+}
+
+// PDFMerger joins several PDFs in order
+type PDFMerger struct {
+	PDFToolConverter
+}
+
+func NewPDFMerger() *PDFMerger {
+	return &PDFMerger{PDFToolConverter: *NewPDFToolConverter()}
+}
+
+// Process merges all input files into a single PDF
+func (c *PDFMerger) Process(inputFiles []string, options ...ConvertOption) error {
+	outputFile, err := c.apply(inputFiles, 2, "-merged.pdf", options)
+	if err != nil {
+		return err
+	}
+
+	if err := api.MergeCreateFile(inputFiles, outputFile, false, pdfcpuConfig(c.Options.InputPassword)); err != nil {
+		return pdfProcessError("error merging pdfs", err)
+	}
+	return nil
+}
+
+// PDFSplitter splits a PDF into page ranges and writes them as a ZIP archive
+type PDFSplitter struct {
+	PDFToolConverter
+}
+
+func NewPDFSplitter() *PDFSplitter {
+	return &PDFSplitter{PDFToolConverter: *NewPDFToolConverter()}
+}
+
+// Process writes one PDF per comma separated range in PageRanges, or one
+// PDF per page when PageRanges is empty, and zips the results
+func (c *PDFSplitter) Process(inputFiles []string, options ...ConvertOption) error {
+	outputFile, err := c.apply(inputFiles, 1, "-split.zip", options)
+	if err != nil {
+		return err
+	}
+	inputFile, password := inputFiles[0], c.Options.InputPassword
+
+	pageCount, err := pdfPageCount(inputFile, password)
+	if err != nil {
+		return pdfReadError("error reading pdf", err)
+	}
+
+	var parts [][]int
+	if c.Options.PageRanges == "" {
+		for page := 1; page <= pageCount; page++ {
+			parts = append(parts, []int{page})
+		}
+	} else {
+		for _, spec := range strings.Split(c.Options.PageRanges, ",") {
+			pages, err := ParsePageRanges(spec, pageCount)
+			if err != nil {
+				return err
+			}
+			parts = append(parts, pages)
+		}
+	}
+
+	archive, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer archive.Close()
+
+	zw := zip.NewWriter(archive)
+	base := partBaseName(c.Options.PartName, inputFile)
+	seen := map[string]int{}
+	for _, pages := range parts {
+		// Repeated ranges, such as "1-3,1-3", are numbered to keep entry
+		// names unique
+		span := pageSpanName(pages)
+		if seen[span]++; seen[span] > 1 {
+			span += fmt.Sprintf("_%d", seen[span])
+		}
+		name := fmt.Sprintf("%s_%s.pdf", base, span)
+		entry, err := zw.Create(name)
+		if err != nil {
+			return fmt.Errorf("error creating archive entry: %w", err)
+		}
+		if err := collectPages(inputFile, password, entry, pages); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// PDFPageExtractor keeps the pages selected by PageRanges, in that order
+type PDFPageExtractor struct {
+	PDFToolConverter
+}
+
+func NewPDFPageExtractor() *PDFPageExtractor {
+	return &PDFPageExtractor{PDFToolConverter: *NewPDFToolConverter()}
+}
+
+// Process writes a PDF containing only the selected pages
+func (c *PDFPageExtractor) Process(inputFiles []string, options ...ConvertOption) error {
+	outputFile, err := c.apply(inputFiles, 1, "-extract.pdf", options)
+	if err != nil {
+		return err
+	}
+	if c.Options.PageRanges == "" {
+		return invalidOption("no pages selected")
+	}
+	return selectPages(inputFiles[0], c.Options.InputPassword, outputFile, c.Options.PageRanges)
+}
+
+// PDFPageReorderer writes the pages in the order given by PageRanges. Pages
+// that are not listed are appended in their original order.
+type PDFPageReorderer struct {
+	PDFToolConverter
+}
+
+func NewPDFPageReorderer() *PDFPageReorderer {
+	return &PDFPageReorderer{PDFToolConverter: *NewPDFToolConverter()}
+}
+
+// Process writes a PDF with the pages reordered
+func (c *PDFPageReorderer) Process(inputFiles []string, options ...ConvertOption) error {
+	outputFile, err := c.apply(inputFiles, 1, "-reordered.pdf", options)
+	if err != nil {
+		return err
+	}
+	if c.Options.PageRanges == "" {
+		return invalidOption("no page order given")
+	}
+
+	inputFile, password := inputFiles[0], c.Options.InputPassword
+	pageCount, err := pdfPageCount(inputFile, password)
+	if err != nil {
+		return pdfReadError("error reading pdf", err)
+	}
+	order, err := ParsePageRanges(c.Options.PageRanges, pageCount)
+	if err != nil {
+		return err
+	}
+
+	listed := make(map[int]bool, len(order))
+	for _, page := range order {
+		if listed[page] {
+			return invalidOption("page %d is listed more than once", page)
+		}
+		listed[page] = true
+	}
+	for page := 1; page <= pageCount; page++ {
+		if !listed[page] {
+			order = append(order, page)
+		}
+	}
+
+	return writePages(inputFile, password, outputFile, order)
+}
+
+// PDFRotator rotates pages by a multiple of 90 degrees
+type PDFRotator struct {
+	PDFToolConverter
+}
+
+func NewPDFRotator() *PDFRotator {
+	return &PDFRotator{PDFToolConverter: *NewPDFToolConverter()}
+}
+
+// Process rotates the pages in PageRanges, or all pages when it is empty,
+// clockwise by PageRotation degrees
+func (c *PDFRotator) Process(inputFiles []string, options ...ConvertOption) error {
+	outputFile, err := c.apply(inputFiles, 1, "-rotated.pdf", options)
+	if err != nil {
+		return err
+	}
+	rotation := c.Options.PageRotation
+	if rotation == 0 || rotation%90 != 0 {
+		return invalidOption("rotation must be a non-zero multiple of 90 degrees")
+	}
+
+	inputFile, password := inputFiles[0], c.Options.InputPassword
+	var selected []string
+	if c.Options.PageRanges != "" {
+		pageCount, err := pdfPageCount(inputFile, password)
+		if err != nil {
+			return pdfReadError("error reading pdf", err)
+		}
+		pages, err := ParsePageRanges(c.Options.PageRanges, pageCount)
+		if err != nil {
+			return err
+		}
+		selected = pageSelection(pages)
+	}
+
+	if err := api.RotateFile(inputFile, outputFile, rotation, selected, pdfcpuConfig(password)); err != nil {
+		return pdfProcessError("error rotating pages", err)
+	}
+	return nil
+}
+
+// ParsePageRanges expands a page selection like "1-3,7,10-" into page
+// numbers in the order given. An open range runs to the last page.
+func ParsePageRanges(spec string, pageCount int) ([]int, error) {
+	var pages []int
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		first, last := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			first, last = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		}
+
+		start, err := parsePageNumber(first, 1, pageCount)
+		if err != nil {
+			return nil, invalidOption("invalid page range %q: %w", part, err)
+		}
+		end, err := parsePageNumber(last, pageCount, pageCount)
+		if err != nil {
+			return nil, invalidOption("invalid page range %q: %w", part, err)
+		}
+		if start > end {
+			return nil, invalidOption("invalid page range %q: start is after end", part)
+		}
+
+		for page := start; page <= end; page++ {
+			pages = append(pages, page)
+		}
+	}
+
+	if len(pages) == 0 {
+		return nil, invalidOption("no pages selected")
+	}
+	return pages, nil
+}
+
+// parsePageNumber parses a page number, using fallback when value is empty
+func parsePageNumber(value string, fallback, pageCount int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	page, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalidOption("%q is not a page number", value)
+	}
+	if page < 1 || page > pageCount {
+		return 0, invalidOption("page %d is outside 1-%d", page, pageCount)
+	}
+	return page, nil
+}
+
+// selectPages writes the pages selected by spec from inputFile to outputFile
+func selectPages(inputFile, password, outputFile, spec string) error {
+	pageCount, err := pdfPageCount(inputFile, password)
+	if err != nil {
+		return pdfReadError("error reading pdf", err)
+	}
+	pages, err := ParsePageRanges(spec, pageCount)
+	if err != nil {
+		return err
+	}
+	return writePages(inputFile, password, outputFile, pages)
+}
+
+// writePages writes the given pages of inputFile, in order, to outputFile
+func writePages(inputFile, password, outputFile string, pages []int) error {
+	output, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer output.Close()
+
+	return collectPages(inputFile, password, output, pages)
+}
+
+// collectPages writes a PDF made of the given pages of inputFile to w
+func collectPages(inputFile, password string, w io.Writer, pages []int) error {
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return fmt.Errorf("error opening input file: %w", err)
+	}
+	defer input.Close()
+
+	if err := api.Collect(input, w, pageSelection(pages), pdfcpuConfig(password)); err != nil {
+		return pdfProcessError("error collecting pages", err)
+	}
+	return nil
+}
+
+// pdfPageCount returns the number of pages in a PDF file
+func pdfPageCount(inputFile, password string) (int, error) {
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return 0, err
+	}
+	defer input.Close()
+
+	return api.PageCount(input, pdfcpuConfig(password))
+}
+
+// pageSelection formats page numbers for pdfcpu
+func pageSelection(pages []int) []string {
+	selected := make([]string, len(pages))
+	for i, page := range pages {
+		selected[i] = strconv.Itoa(page)
+	}
+	return selected
+}
+
+// partBaseName returns the name split parts start with: name without its
+// extension, or the input file name when name is empty. Path separators
+// are replaced so every entry stays at the top of the archive.
+func partBaseName(name, inputFile string) string {
+	if name == "" {
+		name = filepath.Base(inputFile)
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		return "document"
+	}
+	return name
+}
+
+// pageSpanName names a split part after its first and last page
+func pageSpanName(pages []int) string {
+	if len(pages) == 1 {
+		return fmt.Sprintf("page%d", pages[0])
+	}
+	return fmt.Sprintf("pages%d-%d", pages[0], pages[len(pages)-1])
+}
+
+// pdfcpuConfig returns a pdfcpu configuration that skips strict validation,
+// since generated PDFs in the wild often have minor defects, and opens
+// protected input with password as either the user or the owner password
+func pdfcpuConfig(password string) *model.Configuration {
+	conf := model.NewDefaultConfiguration()
+	conf.ValidationMode = model.ValidationRelaxed
+	conf.UserPW, conf.OwnerPW = password, password
+	return conf
+}
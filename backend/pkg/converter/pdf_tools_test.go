@@ -0,0 +1,155 @@
+package converter
+
+import (
+	"archive/zip"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// writeTestPDF writes a PDF of pages blank A4 pages into dir
+func writeTestPDF(t *testing.T, dir, name string, pages int) string {
+	t.Helper()
+	pdf := fpdf.New("P", "mm", "A4", "")
+	for i := 0; i < pages; i++ {
+		pdf.AddPage()
+	}
+	file := filepath.Join(dir, name)
+	if err := pdf.OutputFileAndClose(file); err != nil {
+		t.Fatalf("writing test pdf: %v", err)
+	}
+	return file
+}
+
+// writeProtectedPDF writes a PDF of pages blank pages into dir, encrypted
+// with the user password "user" and the owner password "owner"
+func writeProtectedPDF(t *testing.T, dir, name string, pages int) string {
+	t.Helper()
+	plain := writeTestPDF(t, dir, "plain-"+name, pages)
+	file := filepath.Join(dir, name)
+	err := NewPDFEncrypter().Process([]string{plain}, WithOutputPath(file),
+		WithPDFProtection(PDFProtection{UserPassword: "user", OwnerPassword: "owner"}))
+	if err != nil {
+		t.Fatalf("writing protected test pdf: %v", err)
+	}
+	return file
+}
+
+func TestParsePageRanges(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []int
+	}{
+		{"1", []int{1}},
+		{"1-3", []int{1, 2, 3}},
+		{"1-3,7", []int{1, 2, 3, 7}},
+		{"3,1,2", []int{3, 1, 2}},
+		{"8-", []int{8, 9, 10}},
+		{"-2", []int{1, 2}},
+		{" 2 - 4 , ,5", []int{2, 3, 4, 5}},
+		{"2,2", []int{2, 2}},
+	}
+	for _, tt := range tests {
+		got, err := ParsePageRanges(tt.spec, 10)
+		if err != nil {
+			t.Errorf("ParsePageRanges(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePageRanges(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParsePageRangesInvalid(t *testing.T) {
+	for _, spec := range []string{"", ",", "0", "11", "3-1", "a", "1-b", "5-20"} {
+		_, err := ParsePageRanges(spec, 10)
+		if !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("ParsePageRanges(%q) = %v, want invalid options", spec, err)
+		}
+	}
+}
+
+func TestMergeAndExtract(t *testing.T) {
+	dir := t.TempDir()
+	a := writeTestPDF(t, dir, "a.pdf", 2)
+	b := writeTestPDF(t, dir, "b.pdf", 3)
+
+	if err := NewPDFMerger().Process([]string{a, b}); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	merged := filepath.Join(dir, "a-merged.pdf")
+	if count, err := pdfPageCount(merged, ""); err != nil || count != 5 {
+		t.Fatalf("merged pages = %d, %v, want 5", count, err)
+	}
+
+	extracted := filepath.Join(dir, "extracted.pdf")
+	err := NewPDFPageExtractor().Process([]string{merged}, WithPageRanges("2,4-"), WithOutputPath(extracted))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if count, err := pdfPageCount(extracted, ""); err != nil || count != 3 {
+		t.Errorf("extracted pages = %d, %v, want 3", count, err)
+	}
+
+	err = NewPDFPageExtractor().Process([]string{merged}, WithPageRanges("9"))
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("extracting a missing page: %v, want invalid options", err)
+	}
+}
+
+func TestPartBaseName(t *testing.T) {
+	tests := []struct{ name, inputFile, want string }{
+		{"Quarterly report.pdf", "/tmp/x/upload-1a2b.pdf", "Quarterly report"},
+		{"", "/tmp/x/upload-1a2b.pdf", "upload-1a2b"},
+		{"../../etc/passwd.pdf", "in.pdf", ".._.._etc_passwd"},
+		{`a\b.pdf`, "in.pdf", "a_b"},
+		{".pdf", "in.pdf", "document"},
+		{"..", "in.pdf", "document"},
+	}
+	for _, tt := range tests {
+		if got := partBaseName(tt.name, tt.inputFile); got != tt.want {
+			t.Errorf("partBaseName(%q, %q) = %q, want %q", tt.name, tt.inputFile, got, tt.want)
+		}
+	}
+}
+
+func TestSplitNamesParts(t *testing.T) {
+	dir := t.TempDir()
+	input := writeTestPDF(t, dir, "upload-1a2b.pdf", 4)
+	output := filepath.Join(dir, "split.zip")
+
+	tests := []struct {
+		ranges string
+		want   []string
+	}{
+		{"1-2,4", []string{"Quarterly report_pages1-2.pdf", "Quarterly report_page4.pdf"}},
+		{"1-3,1-3,2,1-3", []string{
+			"Quarterly report_pages1-3.pdf", "Quarterly report_pages1-3_2.pdf",
+			"Quarterly report_page2.pdf", "Quarterly report_pages1-3_3.pdf",
+		}},
+	}
+	for _, tt := range tests {
+		err := NewPDFSplitter().Process([]string{input},
+			WithPageRanges(tt.ranges), WithPartName("Quarterly report.pdf"), WithOutputPath(output))
+		if err != nil {
+			t.Fatalf("split %s: %v", tt.ranges, err)
+		}
+		archive, err := zip.OpenReader(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, entry := range archive.File {
+			names = append(names, entry.Name)
+		}
+		archive.Close()
+		if !reflect.DeepEqual(names, tt.want) {
+			t.Errorf("split %s entries = %q, want %q", tt.ranges, names, tt.want)
+		}
+	}
+}
@@ -0,0 +1,406 @@
+package converter
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// PDF/A conformance levels supported by the PDF converters
+const (
+	PDFA1B = "1b"
+	PDFA2B = "2b"
+)
+
+// Font family registered for PDF/A output. The standard PDF fonts are not
+// embedded, which PDF/A forbids.
+const pdfaFontFamily = "GoPDFA"
+
+// Producer recorded in PDF/A output, repeated in the XMP metadata
+const pdfaProducer = "Reformat (go-pdf/fpdf)"
+
+// Comment after the file header marking the file as binary, as PDF/A requires
+const binaryComment = "%\xe2\xe3\xcf\xd3\n"
+
+// ParsePDFALevel normalizes a PDF/A level such as "1b", "2B" or "pdfa-2b"
+func ParsePDFALevel(level string) (string, error) {
+	l := strings.ToLower(strings.TrimSpace(level))
+	l = strings.TrimPrefix(strings.TrimPrefix(l, "pdf/a-"), "pdfa-")
+	switch l {
+	case PDFA1B, PDFA2B:
+		return l, nil
+	default:
+		return "", invalidOption("unsupported pdf/a level: %s", level)
+	}
+}
+
+// pdfaPart returns the part number of a level, e.g. 2 for "2b"
+func pdfaPart(level string) int {
+	return int(level[0] - '0')
+}
+
+// preparePDFA rejects options PDF/A cannot represent and registers the
+// embedded font family used for text
+func preparePDFA(pdf *fpdf.Fpdf, opts ConvertOptions) error {
+	if _, err := ParsePDFALevel(opts.PDFA); err != nil {
+		return err
+	}
+	if opts.Protection != nil {
+		return invalidOption("pdf/a does not allow encryption")
+	}
+	if opts.Watermark != nil {
+		wm := *opts.Watermark
+		if err := wm.normalize(); err != nil {
+			return err
+		}
+		if wm.Opacity < 1 {
+			return invalidOption("pdf/a does not allow transparency: set the watermark opacity to 1")
+		}
+	}
+
+	for style, ttf := range map[string][]byte{
+		"":   goregular.TTF,
+		"B":  gobold.TTF,
+		"I":  goitalic.TTF,
+		"BI": gobolditalic.TTF,
+	} {
+		pdf.AddUTF8FontFromBytes(pdfaFontFamily, style, ttf)
+	}
+	return pdf.Error()
+}
+
+// documentFont returns the font family for text in PDF output
+func documentFont(opts ConvertOptions) string {
+	if opts.PDFA != "" {
+		return pdfaFontFamily
+	}
+	return opts.FontName
+}
+
+// pdfTranslator returns the function encoding text for the fonts of PDF
+// output: the embedded PDF/A fonts take UTF-8, the standard fonts cp1252
+func pdfTranslator(pdf *fpdf.Fpdf, opts ConvertOptions) func(string) string {
+	if opts.PDFA != "" {
+		return func(s string) string { return s }
+	}
+	return pdf.UnicodeTranslatorFromDescriptor("")
+}
+
+// pdfImageRegistrar returns the function adding images to PDF output,
+// registerOpaqueImage for PDF/A and registerPDFImage otherwise
+func pdfImageRegistrar(opts ConvertOptions) func(*fpdf.Fpdf, string, Limits) (string, image.Point, error) {
+	if opts.PDFA != "" {
+		return registerOpaqueImage
+	}
+	return registerPDFImage
+}
+
+// registerOpaqueImage adds an image file to pdf for PDF/A output and
+// returns its name and pixel size. Images with transparency or CMYK colors
+// are flattened onto white and re-encoded as RGB, matching the sRGB output
+// intent.
+func registerOpaqueImage(pdf *fpdf.Fpdf, inputFile string, limits Limits) (string, image.Point, error) {
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return "", image.Point{}, fmt.Errorf("failed to open image: %w", err)
+	}
+	cfg, format, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		return "", image.Point{}, corruptInput("failed to decode image", err)
+	}
+	if err := limits.checkPixels(cfg.Width, cfg.Height); err != nil {
+		return "", image.Point{}, err
+	}
+	size := image.Point{X: cfg.Width, Y: cfg.Height}
+
+	if format == "jpeg" && cfg.ColorModel != color.CMYKModel {
+		pdf.RegisterImageOptions(inputFile, fpdf.ImageOptions{ImageType: "jpeg"})
+		return inputFile, size, pdf.Error()
+	}
+
+	img, err := decodeImageFile(inputFile, limits)
+	if err != nil {
+		return "", image.Point{}, err
+	}
+	bounds := img.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, bounds.Min, draw.Over)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, flat); err != nil {
+		return "", image.Point{}, fmt.Errorf("failed to encode image: %w", err)
+	}
+	pdf.RegisterImageOptionsReader(inputFile, fpdf.ImageOptions{ImageType: "png"}, &buf)
+	return inputFile, size, pdf.Error()
+}
+
+// writePDFA writes pdf to outputFile as PDF/A and validates the result
+func writePDFA(pdf *fpdf.Fpdf, outputFile string, opts ConvertOptions) error {
+	level, err := ParsePDFALevel(opts.PDFA)
+	if err != nil {
+		return err
+	}
+
+	// The information dictionary and XMP metadata must carry equal dates,
+	// so both are fixed here instead of taken from the clock when writing
+	date := time.Now().UTC().Truncate(time.Second)
+	pdf.SetCreationDate(date)
+	pdf.SetModificationDate(date)
+	pdf.SetProducer(pdfaProducer, true)
+	if err := pdf.OutputFileAndClose(outputFile); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		return fmt.Errorf("error reading pdf: %w", err)
+	}
+	data, err = addPDFAParts(data, pdfaXMP(opts.Metadata, level, date))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputFile, data, 0644); err != nil {
+		return fmt.Errorf("error writing pdf: %w", err)
+	}
+
+	report, err := ValidatePDFA(outputFile, level)
+	if err != nil {
+		return err
+	}
+	if !report.Compliant {
+		return fmt.Errorf("output is not PDF/A-%s: %s", level, strings.Join(report.Violations, "; "))
+	}
+	return nil
+}
+
+// pdfaXMP builds the XMP metadata packet identifying the PDF/A level and
+// mirroring the document information dictionary written by fpdf
+func pdfaXMP(m PDFMetadata, level string, date time.Time) []byte {
+	if m.Creator == "" {
+		m.Creator = defaultPDFCreator
+	}
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	stamp := date.Format("2006-01-02T15:04:05")
+
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString("<rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdfaid=\"http://www.aiim.org/pdfa/ns/id/\">\n")
+	fmt.Fprintf(&b, "<pdfaid:part>%d</pdfaid:part>\n", pdfaPart(level))
+	b.WriteString("<pdfaid:conformance>B</pdfaid:conformance>\n")
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:dc=\"http://purl.org/dc/elements/1.1/\">\n")
+	b.WriteString("<dc:format>application/pdf</dc:format>\n")
+	if m.Title != "" {
+		fmt.Fprintf(&b, "<dc:title><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:title>\n", esc(m.Title))
+	}
+	if m.Author != "" {
+		fmt.Fprintf(&b, "<dc:creator><rdf:Seq><rdf:li>%s</rdf:li></rdf:Seq></dc:creator>\n", esc(m.Author))
+	}
+	if m.Subject != "" {
+		fmt.Fprintf(&b, "<dc:description><rdf:Alt><rdf:li xml:lang=\"x-default\">%s</rdf:li></rdf:Alt></dc:description>\n", esc(m.Subject))
+	}
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:pdf=\"http://ns.adobe.com/pdf/1.3/\">\n")
+	fmt.Fprintf(&b, "<pdf:Producer>%s</pdf:Producer>\n", esc(pdfaProducer))
+	if m.Keywords != "" {
+		fmt.Fprintf(&b, "<pdf:Keywords>%s</pdf:Keywords>\n", esc(m.Keywords))
+	}
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("<rdf:Description rdf:about=\"\" xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\">\n")
+	fmt.Fprintf(&b, "<xmp:CreatorTool>%s</xmp:CreatorTool>\n", esc(m.Creator))
+	fmt.Fprintf(&b, "<xmp:CreateDate>%s</xmp:CreateDate>\n", stamp)
+	fmt.Fprintf(&b, "<xmp:ModifyDate>%s</xmp:ModifyDate>\n", stamp)
+	fmt.Fprintf(&b, "<xmp:MetadataDate>%s</xmp:MetadataDate>\n", stamp)
+	b.WriteString("</rdf:Description>\n")
+
+	b.WriteString("</rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>")
+	return []byte(b.String())
+}
+
+var (
+	trailerSizePattern = regexp.MustCompile(`/Size (\d+)`)
+	trailerRootPattern = regexp.MustCompile(`/Root (\d+) 0 R`)
+	trailerInfoPattern = regexp.MustCompile(`/Info (\d+) 0 R`)
+)
+
+// addPDFAParts adds what fpdf cannot write itself: the binary header
+// comment, and an incremental update holding the XMP metadata, the sRGB
+// output intent, a catalog referencing both and the trailer file ID.
+// Everything else, including the information dictionary, is kept byte for
+// byte so it stays consistent with the XMP metadata.
+func addPDFAParts(data, xmp []byte) ([]byte, error) {
+	eol := bytes.IndexByte(data, '\n')
+	if !bytes.HasPrefix(data, []byte("%PDF-")) || eol < 0 {
+		return nil, fmt.Errorf("not a pdf file")
+	}
+	shift := len(binaryComment)
+
+	start := bytes.LastIndex(data, []byte("startxref"))
+	if start < 0 {
+		return nil, fmt.Errorf("pdf has no cross-reference table")
+	}
+	xrefOffset, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(
+		strings.TrimSpace(string(data[start+len("startxref"):])), "%%EOF")))
+	if err != nil || xrefOffset <= eol || xrefOffset >= start {
+		return nil, fmt.Errorf("pdf has an invalid cross-reference offset")
+	}
+
+	// fpdf writes a single subsection of fixed width entries
+	var first, count int
+	if _, err := fmt.Sscanf(string(data[xrefOffset:start]), "xref\n%d %d\n", &first, &count); err != nil {
+		return nil, fmt.Errorf("error reading cross-reference table: %w", err)
+	}
+	entriesStart := xrefOffset + bytes.IndexByte(data[xrefOffset+5:], '\n') + 6
+	trailerStart := entriesStart + 20*count
+	if first != 0 || trailerStart > start {
+		return nil, fmt.Errorf("error reading cross-reference table")
+	}
+	trailer := data[trailerStart:start]
+
+	size, err := trailerNumber(trailerSizePattern, trailer)
+	if err != nil {
+		return nil, err
+	}
+	root, err := trailerNumber(trailerRootPattern, trailer)
+	if err != nil {
+		return nil, err
+	}
+	info, err := trailerNumber(trailerInfoPattern, trailer)
+	if err != nil {
+		return nil, err
+	}
+	if root >= count {
+		return nil, fmt.Errorf("pdf catalog is missing from the cross-reference table")
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:eol+1])
+	out.WriteString(binaryComment)
+	out.Write(data[eol+1 : entriesStart])
+	for i := 0; i < count; i++ {
+		entry := data[entriesStart+20*i : entriesStart+20*(i+1)]
+		if entry[17] != 'n' {
+			out.Write(entry)
+			continue
+		}
+		offset, err := strconv.Atoi(string(entry[:10]))
+		if err != nil {
+			return nil, fmt.Errorf("error reading cross-reference table: %w", err)
+		}
+		fmt.Fprintf(&out, "%010d%s", offset+shift, entry[10:])
+	}
+	out.Write(trailer)
+	fmt.Fprintf(&out, "startxref\n%d\n%%%%EOF\n", xrefOffset+shift)
+
+	catalog, err := catalogEntries(data, entriesStart, root)
+	if err != nil {
+		return nil, err
+	}
+
+	// New objects are numbered after the existing ones
+	xmpRef, iccRef, intentRef := size, size+1, size+2
+	offsets := make(map[int]int)
+	writeObject := func(number int, body string) {
+		offsets[number] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", number, body)
+	}
+
+	icc := srgbICCProfile()
+	writeObject(xmpRef, fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n%s\nendstream", len(xmp), xmp))
+	writeObject(iccRef, fmt.Sprintf("<< /N 3 /Length %d >>\nstream\n%s\nendstream", len(icc), icc))
+	writeObject(intentRef, fmt.Sprintf("<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (%s) "+
+		"/Info (%s) /DestOutputProfile %d 0 R >>", srgbProfileName, srgbProfileName, iccRef))
+	writeObject(root, fmt.Sprintf("<<\n%s\n/Metadata %d 0 R\n/OutputIntents [%d 0 R]\n>>", catalog, xmpRef, intentRef))
+
+	id := md5.Sum(data)
+	update := out.Len()
+	fmt.Fprintf(&out, "xref\n%d 1\n%010d 00000 n \n%d 3\n", root, offsets[root], xmpRef)
+	for _, number := range []int{xmpRef, iccRef, intentRef} {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offsets[number])
+	}
+	fmt.Fprintf(&out, "trailer\n<<\n/Size %d\n/Root %d 0 R\n/Info %d 0 R\n/ID [<%x> <%x>]\n/Prev %d\n>>\n",
+		size+3, root, info, id, id, xrefOffset+shift)
+	fmt.Fprintf(&out, "startxref\n%d\n%%%%EOF\n", update)
+	return out.Bytes(), nil
+}
+
+// trailerNumber reads an object number or count from the trailer
+func trailerNumber(pattern *regexp.Regexp, trailer []byte) (int, error) {
+	match := pattern.FindSubmatch(trailer)
+	if match == nil {
+		return 0, fmt.Errorf("pdf trailer has no %s entry", strings.Fields(pattern.String())[0])
+	}
+	return strconv.Atoi(string(match[1]))
+}
+
+// catalogEntries returns the entries of the catalog object, without the
+// name dictionary. fpdf only uses it for JavaScript and embedded files,
+// neither of which PDF/A-1 allows.
+func catalogEntries(data []byte, entriesStart, root int) (string, error) {
+	offset, err := strconv.Atoi(string(data[entriesStart+20*root : entriesStart+20*root+10]))
+	if err != nil || offset >= len(data) {
+		return "", fmt.Errorf("pdf catalog has an invalid offset")
+	}
+	object := data[offset:]
+	end := bytes.Index(object, []byte("endobj"))
+	if end < 0 {
+		return "", fmt.Errorf("pdf catalog is not terminated")
+	}
+	object = object[:end]
+	open, close := bytes.Index(object, []byte("<<")), bytes.LastIndex(object, []byte(">>"))
+	if open < 0 || close <= open {
+		return "", fmt.Errorf("pdf catalog is not a dictionary")
+	}
+	entries := string(object[open+2 : close])
+
+	if i := strings.Index(entries, "/Names"); i >= 0 {
+		// Skip the nested dictionary, tracking << and >> pairs
+		j := strings.Index(entries[i:], "<<")
+		if j < 0 {
+			return "", fmt.Errorf("pdf catalog has an invalid name dictionary")
+		}
+		depth, k := 0, i+j
+		for ; k < len(entries)-1; k++ {
+			if entries[k:k+2] == "<<" {
+				depth++
+				k++
+			} else if entries[k:k+2] == ">>" {
+				depth--
+				k++
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		entries = entries[:i] + entries[k+1:]
+	}
+	return strings.TrimSpace(entries), nil
+}
@@ -0,0 +1,181 @@
+package converter
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-pdf/fpdf"
+)
+
+func TestParsePDFALevel(t *testing.T) {
+	for level, want := range map[string]string{
+		"1b": PDFA1B, "2B": PDFA2B, " pdfa-1b ": PDFA1B, "PDF/A-2b": PDFA2B,
+		"": "", "1a": "", "3b": "", "pdfa": "",
+	} {
+		got, err := ParsePDFALevel(level)
+		if want == "" {
+			if ErrorCode(err) != CodeInvalidOptions {
+				t.Errorf("ParsePDFALevel(%q) error = %v, want an invalid option", level, err)
+			}
+		} else if err != nil || got != want {
+			t.Errorf("ParsePDFALevel(%q) = %q, %v, want %q", level, got, err, want)
+		}
+	}
+}
+
+// writeTransparentPNG writes a half transparent image, which PDF/A output
+// has to flatten
+func writeTransparentPNG(t *testing.T, dir string) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 10))
+	for i := 0; i < 20*10; i++ {
+		img.Set(i%20, i/20, color.NRGBA{R: 200, A: uint8(i)})
+	}
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return input
+}
+
+func TestImageToPDFA(t *testing.T) {
+	dir := t.TempDir()
+	input := writeTransparentPNG(t, dir)
+	// Markup characters must be escaped in the XMP packet
+	metadata := PDFMetadata{Title: `Q3 <draft> & "notes"`, Author: "Zoë"}
+
+	for _, level := range []string{PDFA1B, PDFA2B} {
+		output := filepath.Join(dir, "out-"+level+".pdf")
+		err := NewImageConverter().ConvertToPDF(input, WithOutputPath(output),
+			WithPDFA(level), WithPDFMetadata(metadata))
+		if err != nil {
+			t.Fatalf("%s: %v", level, err)
+		}
+
+		report, err := ValidatePDFA(output, "")
+		if err != nil {
+			t.Fatalf("%s: %v", level, err)
+		}
+		if !report.Compliant || report.Level != level || report.Claimed != level {
+			t.Errorf("%s: report = %+v, want a compliant PDF/A-%s", level, report, level)
+		}
+		m, err := ReadPDFMetadata(output, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Title != metadata.Title || m.Author != metadata.Author || m.Producer != pdfaProducer {
+			t.Errorf("%s: metadata = %+v", level, m)
+		}
+	}
+}
+
+func TestPDFAOptions(t *testing.T) {
+	dir := t.TempDir()
+	input := writeTransparentPNG(t, dir)
+
+	tests := []struct {
+		name    string
+		options []ConvertOption
+	}{
+		{"unknown level", []ConvertOption{WithPDFA("3u")}},
+		{"encryption", []ConvertOption{WithPDFA(PDFA2B), WithPDFProtection(PDFProtection{UserPassword: "u"})}},
+		{"transparent watermark", []ConvertOption{WithPDFA(PDFA2B), WithWatermark(Watermark{Text: "X", Opacity: 0.5})}},
+	}
+	for _, tt := range tests {
+		options := append([]ConvertOption{WithOutputPath(filepath.Join(dir, "out.pdf"))}, tt.options...)
+		err := NewImageConverter().ConvertToPDF(input, options...)
+		if code := ErrorCode(err); code != CodeInvalidOptions {
+			t.Errorf("%s: error = %v with code %s, want %s", tt.name, err, code, CodeInvalidOptions)
+		}
+	}
+
+	// An opaque watermark is allowed
+	err := NewImageConverter().ConvertToPDF(input, WithOutputPath(filepath.Join(dir, "out.pdf")),
+		WithPDFA(PDFA1B), WithWatermark(Watermark{Text: "X", Opacity: 1}))
+	if err != nil {
+		t.Errorf("opaque watermark: %v", err)
+	}
+}
+
+func TestValidatePDFA(t *testing.T) {
+	dir := t.TempDir()
+
+	// A plain PDF with an unembedded font, transparency and JavaScript
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "", 12)
+	pdf.SetAlpha(0.5, "Normal")
+	pdf.Cell(40, 10, "hello")
+	pdf.SetJavascript("app.alert('hi');")
+	plain := filepath.Join(dir, "plain.pdf")
+	if err := pdf.OutputFileAndClose(plain); err != nil {
+		t.Fatal(err)
+	}
+
+	conforming := filepath.Join(dir, "pdfa.pdf")
+	err := NewImageConverter().ConvertToPDF(writeTransparentPNG(t, dir), WithOutputPath(conforming), WithPDFA(PDFA1B))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		input      string
+		level      string
+		want       PDFAReport // violations listed are required, others allowed
+		code       Code
+		exactlyAll bool
+	}{
+		{
+			"plain pdf", plain, "",
+			PDFAReport{Level: PDFA1B, Violations: []string{
+				"the catalog has no XMP metadata stream",
+				"the catalog has no output intent",
+				"font Helvetica is not embedded",
+				"a graphics state uses transparency",
+				"the document contains JavaScript",
+			}}, "", false,
+		},
+		{"conforming", conforming, "", PDFAReport{Level: PDFA1B, Claimed: PDFA1B, Compliant: true}, "", true},
+		{
+			"other part", conforming, "2b",
+			PDFAReport{Level: PDFA2B, Claimed: PDFA1B, Violations: []string{"the XMP metadata claims PDF/A-1b, not PDF/A-2b"}}, "", true,
+		},
+		{"bad level", conforming, "4x", PDFAReport{}, CodeInvalidOptions, false},
+		{"protected", writeProtectedPDF(t, dir, "protected.pdf", 1), "", PDFAReport{}, CodeInvalidPassword, false},
+	}
+	for _, tt := range tests {
+		report, err := ValidatePDFA(tt.input, tt.level)
+		if code := ErrorCode(err); err != nil && code != tt.code || err == nil && tt.code != "" {
+			t.Errorf("%s: error = %v with code %s, want %s", tt.name, err, code, tt.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if report.Level != tt.want.Level || report.Claimed != tt.want.Claimed || report.Compliant != tt.want.Compliant {
+			t.Errorf("%s: report = %+v, want %+v", tt.name, report, tt.want)
+		}
+		if tt.exactlyAll && !slices.Equal(report.Violations, tt.want.Violations) {
+			t.Errorf("%s: violations = %q, want %q", tt.name, report.Violations, tt.want.Violations)
+		}
+		for _, v := range tt.want.Violations {
+			if !slices.Contains(report.Violations, v) {
+				t.Errorf("%s: violations %q miss %q", tt.name, report.Violations, v)
+			}
+		}
+		if !slices.IsSorted(report.Violations) {
+			t.Errorf("%s: violations are not sorted", tt.name)
+		}
+	}
+}
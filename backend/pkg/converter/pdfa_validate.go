@@ -0,0 +1,438 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// PDFAReport lists the PDF/A requirements a file violates
+type PDFAReport struct {
+	Level      string   `json:"level"`   // level checked against
+	Claimed    string   `json:"claimed"` // level declared in the XMP metadata
+	Compliant  bool     `json:"compliant"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+// Actions PDF/A forbids, by part
+var (
+	pdfa1ForbiddenActions = []string{"Launch", "Sound", "Movie", "ResetForm", "ImportData", "JavaScript"}
+	pdfa2ForbiddenActions = append(pdfa1ForbiddenActions, "Hide", "SetOCGState", "Rendition", "Trans", "GoTo3DView")
+)
+
+var (
+	xmpPartPattern        = regexp.MustCompile(`pdfaid:part(?:>|=["'])\s*(\d)`)
+	xmpConformancePattern = regexp.MustCompile(`pdfaid:conformance(?:>|=["'])\s*([ABUabu])`)
+)
+
+// ValidatePDFA checks a PDF against the main PDF/A requirements for level,
+// or for the level its metadata claims when level is empty. It covers file
+// structure, metadata, output intents, font embedding, transparency,
+// encryption and forbidden actions; it is not a full conformance checker.
+func ValidatePDFA(inputFile, level string) (*PDFAReport, error) {
+	input, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("error opening input file: %w", err)
+	}
+	defer input.Close()
+
+	header := make([]byte, 32)
+	n, _ := io.ReadFull(input, header)
+	header = header[:n]
+	if _, err := input.Seek(0, io.SeekStart); err != nil {
+		return nil, pdfReadError("error reading pdf", err)
+	}
+
+	ctx, err := api.ReadContext(input, pdfcpuConfig(""))
+	if err != nil {
+		return nil, pdfReadError("error reading pdf", err)
+	}
+
+	v := &pdfaValidator{ctx: ctx}
+	catalog, err := ctx.Catalog()
+	if err != nil {
+		return nil, fmt.Errorf("error reading pdf catalog: %w", err)
+	}
+
+	xmp := v.metadata(catalog)
+	claimed := ""
+	if m := xmpPartPattern.FindSubmatch(xmp); m != nil {
+		claimed = string(m[1])
+		if c := xmpConformancePattern.FindSubmatch(xmp); c != nil {
+			claimed += strings.ToLower(string(c[1]))
+		}
+	}
+	if level == "" {
+		level = claimed
+	}
+	if level == "" {
+		// Without a claim, check against the strictest supported level
+		level = PDFA1B
+	}
+	if level, err = ParsePDFALevel(level); err != nil {
+		return nil, err
+	}
+	v.part = pdfaPart(level)
+
+	v.checkHeader(header)
+	if ctx.Encrypt != nil {
+		v.fail("the document is encrypted")
+	}
+	if len(ctx.ID) != 2 {
+		v.fail("the trailer has no file identifier")
+	}
+
+	switch {
+	case xmp == nil:
+		v.fail("the catalog has no XMP metadata stream")
+	case claimed == "":
+		v.fail("the XMP metadata has no PDF/A identification")
+	case claimed[0] != level[0]:
+		v.fail(fmt.Sprintf("the XMP metadata claims PDF/A-%s, not PDF/A-%s", claimed, level))
+	}
+
+	v.checkCatalog(catalog)
+	v.checkOutputIntents(catalog)
+	v.checkObjects()
+
+	sort.Strings(v.violations)
+	return &PDFAReport{
+		Level:      level,
+		Claimed:    claimed,
+		Compliant:  len(v.violations) == 0,
+		Violations: v.violations,
+	}, nil
+}
+
+// pdfaValidator collects violations while walking a PDF
+type pdfaValidator struct {
+	ctx        *model.Context
+	part       int
+	intentN    int // color components of the output intent profile
+	violations []string
+	seen       map[string]bool
+}
+
+// fail records a violation once
+func (v *pdfaValidator) fail(violation string) {
+	if v.seen == nil {
+		v.seen = make(map[string]bool)
+	}
+	if !v.seen[violation] {
+		v.seen[violation] = true
+		v.violations = append(v.violations, violation)
+	}
+}
+
+// checkHeader requires the binary comment on the line after the header
+func (v *pdfaValidator) checkHeader(header []byte) {
+	if !bytes.HasPrefix(header, []byte("%PDF-1.")) {
+		v.fail("the file header is not %PDF-1.n")
+		return
+	}
+	eol := bytes.IndexAny(header, "\r\n")
+	if eol < 0 {
+		v.fail("the file header is not followed by a binary comment")
+		return
+	}
+	rest := bytes.TrimLeft(header[eol:], "\r\n")
+	if len(rest) < 5 || rest[0] != '%' || rest[1] < 128 || rest[2] < 128 || rest[3] < 128 || rest[4] < 128 {
+		v.fail("the file header is not followed by a binary comment")
+	}
+}
+
+// metadata returns the decoded XMP metadata stream of the catalog
+func (v *pdfaValidator) metadata(catalog types.Dict) []byte {
+	obj, ok := catalog.Find("Metadata")
+	if !ok {
+		return nil
+	}
+	sd, _, err := v.ctx.DereferenceStreamDict(obj)
+	if err != nil || sd == nil {
+		return nil
+	}
+	if sd.Dict["Filter"] != nil {
+		v.fail("the XMP metadata stream is compressed")
+	}
+	if err := sd.Decode(); err != nil {
+		return nil
+	}
+	return sd.Content
+}
+
+// checkCatalog rejects document level features PDF/A forbids
+func (v *pdfaValidator) checkCatalog(catalog types.Dict) {
+	if obj, ok := catalog.Find("Names"); ok {
+		if names, err := v.ctx.DereferenceDict(obj); err == nil && names != nil {
+			if _, ok := names.Find("JavaScript"); ok {
+				v.fail("the document contains JavaScript")
+			}
+			if _, ok := names.Find("EmbeddedFiles"); ok && v.part == 1 {
+				v.fail("the document has embedded files")
+			}
+		}
+	}
+	if _, ok := catalog.Find("OCProperties"); ok && v.part == 1 {
+		v.fail("the document has optional content")
+	}
+}
+
+// checkOutputIntents requires a PDF/A output intent with an ICC profile
+func (v *pdfaValidator) checkOutputIntents(catalog types.Dict) {
+	obj, ok := catalog.Find("OutputIntents")
+	if !ok {
+		v.fail("the catalog has no output intent")
+		return
+	}
+	intents, err := v.ctx.DereferenceArray(obj)
+	if err != nil {
+		v.fail("the catalog has no output intent")
+		return
+	}
+
+	for _, o := range intents {
+		intent, err := v.ctx.DereferenceDict(o)
+		if err != nil || intent == nil {
+			continue
+		}
+		if s := intent.NameEntry("S"); s == nil || *s != "GTS_PDFA1" {
+			continue
+		}
+		profile, _, err := v.ctx.DereferenceStreamDict(intent["DestOutputProfile"])
+		if err != nil || profile == nil {
+			v.fail("the PDF/A output intent has no ICC profile")
+			return
+		}
+		if n := profile.IntEntry("N"); n != nil {
+			v.intentN = *n
+		}
+		return
+	}
+	v.fail("the catalog has no GTS_PDFA1 output intent")
+}
+
+// checkObjects inspects every object for fonts, images, graphics states,
+// actions, annotations and filters
+func (v *pdfaValidator) checkObjects() {
+	numbers := make([]int, 0, len(v.ctx.Table))
+	for number := range v.ctx.Table {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	for _, number := range numbers {
+		entry := v.ctx.Table[number]
+		if entry == nil || entry.Free || entry.Object == nil {
+			continue
+		}
+		var d types.Dict
+		switch obj := entry.Object.(type) {
+		case types.Dict:
+			d = obj
+		case types.StreamDict:
+			d = obj.Dict
+			v.checkFilters(d)
+		default:
+			continue
+		}
+
+		switch typeName(d.Type()) {
+		case "Font":
+			v.checkFont(d)
+		case "FontDescriptor":
+			v.checkFontDescriptor(d)
+		case "ExtGState":
+			v.checkGraphicsState(d)
+		case "Action":
+			v.checkAction(d)
+		case "Annot":
+			v.checkAnnotation(d)
+		}
+		if typeName(d.Subtype()) == "Image" {
+			v.checkImage(d)
+		}
+		if group, ok := d.Find("Group"); ok && v.part == 1 {
+			if g, err := v.ctx.DereferenceDict(group); err == nil && g != nil && typeName(g.NameEntry("S")) == "Transparency" {
+				v.fail("a page or form uses a transparency group")
+			}
+		}
+		if d.Type() == nil && isAction(typeName(d.NameEntry("S"))) {
+			// Actions often omit /Type
+			v.checkAction(d)
+		}
+		if _, ok := d.Find("AA"); ok {
+			v.fail("the document uses additional actions")
+		}
+	}
+}
+
+// checkFilters rejects LZW compression
+func (v *pdfaValidator) checkFilters(d types.Dict) {
+	obj, ok := d.Find("Filter")
+	if !ok {
+		return
+	}
+	var filters []string
+	switch f := obj.(type) {
+	case types.Name:
+		filters = append(filters, string(f))
+	case types.Array:
+		for _, o := range f {
+			if name, ok := o.(types.Name); ok {
+				filters = append(filters, string(name))
+			}
+		}
+	}
+	for _, f := range filters {
+		if f == "LZWDecode" {
+			v.fail("a stream uses LZW compression")
+		}
+	}
+}
+
+// checkFont flags simple fonts without a font descriptor, which means the
+// font is one of the standard fonts and is not embedded
+func (v *pdfaValidator) checkFont(d types.Dict) {
+	switch typeName(d.Subtype()) {
+	case "Type1", "TrueType", "MMType1":
+		if _, ok := d.Find("FontDescriptor"); !ok {
+			v.fail(fmt.Sprintf("font %s is not embedded", typeName(d.NameEntry("BaseFont"))))
+		}
+	}
+}
+
+// checkFontDescriptor requires an embedded font program
+func (v *pdfaValidator) checkFontDescriptor(d types.Dict) {
+	for _, key := range []string{"FontFile", "FontFile2", "FontFile3"} {
+		if _, ok := d.Find(key); ok {
+			return
+		}
+	}
+	v.fail(fmt.Sprintf("font %s is not embedded", typeName(d.NameEntry("FontName"))))
+}
+
+// checkGraphicsState rejects transfer functions and, for PDF/A-1,
+// transparency
+func (v *pdfaValidator) checkGraphicsState(d types.Dict) {
+	if _, ok := d.Find("TR"); ok {
+		v.fail("a graphics state uses a transfer function")
+	}
+	if v.part != 1 {
+		return
+	}
+	for _, key := range []string{"CA", "ca"} {
+		if alpha, ok := numberEntry(d, key); ok && alpha < 1 {
+			v.fail("a graphics state uses transparency")
+		}
+	}
+	if mask := d.NameEntry("SMask"); mask == nil {
+		if _, ok := d.Find("SMask"); ok {
+			v.fail("a graphics state uses a soft mask")
+		}
+	} else if *mask != "None" {
+		v.fail("a graphics state uses a soft mask")
+	}
+	if bm := d.NameEntry("BM"); bm != nil && *bm != "Normal" && *bm != "Compatible" {
+		v.fail("a graphics state uses a blend mode")
+	}
+}
+
+// checkImage rejects soft masks in PDF/A-1, interpolation, alternates and
+// device colors that don't match the output intent
+func (v *pdfaValidator) checkImage(d types.Dict) {
+	if _, ok := d.Find("SMask"); ok && v.part == 1 {
+		v.fail("an image has a soft mask (transparency)")
+	}
+	if interpolate := d.BooleanEntry("Interpolate"); interpolate != nil && *interpolate {
+		v.fail("an image requests interpolation")
+	}
+	if _, ok := d.Find("Alternates"); ok {
+		v.fail("an image has alternates")
+	}
+
+	switch typeName(d.NameEntry("ColorSpace")) {
+	case "DeviceRGB":
+		if v.intentN != 3 {
+			v.fail("an image uses DeviceRGB without an RGB output intent")
+		}
+	case "DeviceCMYK":
+		if v.intentN != 4 {
+			v.fail("an image uses DeviceCMYK without a CMYK output intent")
+		}
+	}
+}
+
+// checkAction rejects action types PDF/A forbids
+func (v *pdfaValidator) checkAction(d types.Dict) {
+	s := typeName(d.NameEntry("S"))
+	forbidden := pdfa1ForbiddenActions
+	if v.part != 1 {
+		forbidden = pdfa2ForbiddenActions
+	}
+	for _, action := range forbidden {
+		if s == action {
+			v.fail(fmt.Sprintf("the document uses a %s action", s))
+		}
+	}
+}
+
+// checkAnnotation requires annotations to be printable and visible
+func (v *pdfaValidator) checkAnnotation(d types.Dict) {
+	subtype := typeName(d.Subtype())
+	if subtype == "Popup" {
+		return
+	}
+	const (
+		invisible = 1 << 0
+		hidden    = 1 << 1
+		print     = 1 << 2
+		noView    = 1 << 5
+	)
+	flags := 0
+	if f := d.IntEntry("F"); f != nil {
+		flags = *f
+	}
+	if flags&print == 0 || flags&(invisible|hidden|noView) != 0 {
+		v.fail(fmt.Sprintf("a %s annotation is not set to print", subtype))
+	}
+	if a, err := v.ctx.DereferenceDict(d["A"]); err == nil && a != nil {
+		v.checkAction(a)
+	}
+}
+
+// isAction reports whether name is an action type PDF/A forbids
+func isAction(name string) bool {
+	for _, action := range pdfa2ForbiddenActions {
+		if name == action {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName dereferences an optional name
+func typeName(name *string) string {
+	if name == nil {
+		return ""
+	}
+	return *name
+}
+
+// numberEntry reads an integer or real entry
+func numberEntry(d types.Dict, key string) (float64, bool) {
+	switch n := d[key].(type) {
+	case types.Float:
+		return float64(n), true
+	case types.Integer:
+		return float64(n), true
+	}
+	return 0, false
+}
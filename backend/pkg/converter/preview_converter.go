@@ -0,0 +1,194 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// PreviewConverterInterface interface for generating thumbnails
+type PreviewConverterInterface interface {
+	GeneratePreview(inputFile string, options ...ConvertOption) error
+}
+
+// PreviewConverter renders a PNG thumbnail of any supported input
+type PreviewConverter struct {
+	BaseConverter
+}
+
+// NewPreviewConverter creates a new PreviewConverter
+func NewPreviewConverter() *PreviewConverter {
+	return &PreviewConverter{
+		BaseConverter: BaseConverter{Options: DefaultOptions()},
+	}
+}
+
+// GeneratePreview writes a PNG thumbnail of the first page of a PDF or DOCX,
+// or of an image, no larger than PreviewMaxDimension on either side
+func (c *PreviewConverter) GeneratePreview(inputFile string, options ...ConvertOption) error {
+	// Apply options
+	for _, opt := range options {
+		opt(&c.Options)
+	}
+
+	if c.Options.PreviewMaxDimension <= 0 {
+		return invalidOption("invalid preview size: %d", c.Options.PreviewMaxDimension)
+	}
+
+	outputFile := c.Options.OutputPath
+	if outputFile == "" {
+		outputFile = GetOutputFilename(inputFile, "-preview.png")
+	}
+
+	ext := strings.ToLower(filepath.Ext(inputFile))
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".tif", ".tiff":
+		return c.previewImage(inputFile, outputFile)
+	case ".svg":
+		return c.previewSVG(inputFile, outputFile)
+	case ".pdf":
+		return c.previewPDF(inputFile, outputFile)
+	case ".docx":
+		return c.previewDocx(inputFile, outputFile)
+	default:
+		return unsupportedFormat("file type", ext)
+	}
+}
+
+// previewImage scales an image down to fit the preview size
+func (c *PreviewConverter) previewImage(inputFile, outputFile string) error {
+	span := startStage(c.Options, stageDecode)
+	img, err := decodeImageFile(inputFile, c.Options.Limits)
+	endStage(span, err)
+	if err != nil {
+		return err
+	}
+
+	span = startStage(c.Options, stageTransform, attribute.String("operation", "resize"))
+	img = fitImage(img, c.Options.PreviewMaxDimension)
+	endStage(span, nil)
+
+	return c.writePNG(img, outputFile)
+}
+
+// previewSVG rasterizes an SVG with a transparent background, sized to fit
+// the preview
+func (c *PreviewConverter) previewSVG(inputFile, outputFile string) error {
+	opts := c.Options
+	opts.PreserveAlpha = true
+	opts.SVGWidth = c.Options.PreviewMaxDimension
+	opts.SVGHeight = c.Options.PreviewMaxDimension
+
+	img, err := rasterizeSVG(inputFile, opts)
+	if err != nil {
+		return err
+	}
+	return c.writePNG(img, outputFile)
+}
+
+// writePNG encodes a finished preview
+func (c *PreviewConverter) writePNG(img image.Image, outputFile string) error {
+	if err := checkContext(c.Options); err != nil {
+		return err
+	}
+	span := startStage(c.Options, stageEncode, attribute.String("format", "png"))
+	err := writePNG(img, outputFile)
+	endStage(span, err)
+	return err
+}
+
+// previewPDF rasterizes the first page of a PDF
+func (c *PreviewConverter) previewPDF(inputFile, outputFile string) error {
+	return renderPDFPage(inputFile, 1, outputFile, c.Options)
+}
+
+// previewDocx renders the document through the DOCX to PDF converter and
+// rasterizes the first page of the result
+func (c *PreviewConverter) previewDocx(inputFile, outputFile string) error {
+	pdfFile := GetOutputFilename(outputFile, ".pdf")
+	defer os.Remove(pdfFile)
+
+	err := NewDocxConverter().ConvertToPDF(inputFile, WithOutputPath(pdfFile), WithLimits(c.Options.Limits),
+		WithLogger(c.Options.Logger), WithContext(c.Options.Context))
+	if err != nil {
+		return err
+	}
+	return renderPDFPage(pdfFile, 1, outputFile, c.Options)
+}
+
+// renderPDFPage rasterizes a single PDF page to a PNG with pdftoppm, scaled
+// so its longest side is PreviewMaxDimension pixels. Protected input is
+// decrypted with InputPassword first.
+func renderPDFPage(inputFile string, page int, outputFile string, opts ConvertOptions) error {
+	if opts.InputPassword != "" {
+		decrypted, remove, err := decryptedCopy(inputFile, opts.InputPassword)
+		if err != nil {
+			return err
+		}
+		defer remove()
+		inputFile = decrypted
+	}
+
+	prefix := strings.TrimSuffix(outputFile, filepath.Ext(outputFile))
+	_, err := runCommand(opts, opts.Tools.Pdftoppm, "-png", "-singlefile",
+		"-f", strconv.Itoa(page), "-l", strconv.Itoa(page),
+		"-scale-to", strconv.Itoa(opts.PreviewMaxDimension),
+		inputFile, prefix)
+	if err != nil {
+		// pdftoppm fails the same way for every unreadable file; tell a
+		// missing password apart
+		if checkContext(opts) == nil {
+			if _, perr := pdfPageCount(inputFile, ""); errors.Is(perr, pdfcpu.ErrWrongPassword) {
+				return pdfReadError("error reading pdf", perr)
+			}
+		}
+		return err
+	}
+
+	// pdftoppm always appends .png to the prefix
+	if rendered := prefix + ".png"; rendered != outputFile {
+		return os.Rename(rendered, outputFile)
+	}
+	return nil
+}
+
+// fitImage scales img down so neither side exceeds maxDimension. Smaller
+// images are returned unchanged.
+func fitImage(img image.Image, maxDimension int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxDimension && height <= maxDimension {
+		return img
+	}
+
+	if width >= height {
+		height = max(1, height*maxDimension/width)
+		width = maxDimension
+	} else {
+		width = max(1, width*maxDimension/height)
+		height = maxDimension
+	}
+	return resizeImage(img, width, height)
+}
+
+// writePNG encodes img as a PNG file
+func writePNG(img image.Image, outputFile string) error {
+	output, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("error creating output file: %w", err)
+	}
+	defer output.Close()
+
+	if err := png.Encode(output, img); err != nil {
+		return fmt.Errorf("error encoding image to png: %w", err)
+	}
+	return nil
+}
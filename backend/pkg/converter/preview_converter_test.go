@@ -0,0 +1,139 @@
+package converter
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestPreviewProtectedPDF(t *testing.T) {
+	dir := t.TempDir()
+	input := writeProtectedPDF(t, dir, "in.pdf", 1)
+
+	for _, password := range []string{"", "wrong"} {
+		err := NewPreviewConverter().GeneratePreview(input,
+			WithOutputPath(filepath.Join(dir, "out.png")), WithInputPassword(password))
+		if code := ErrorCode(err); code != CodeInvalidPassword {
+			t.Errorf("password %q: error = %v with code %s, want %s", password, err, code, CodeInvalidPassword)
+		}
+	}
+
+	if _, err := exec.LookPath(DefaultToolPaths().Pdftoppm); err != nil {
+		t.Skip("pdftoppm is not installed")
+	}
+	for _, password := range []string{"user", "owner"} {
+		err := NewPreviewConverter().GeneratePreview(input,
+			WithOutputPath(filepath.Join(dir, "out.png")), WithInputPassword(password))
+		if err != nil {
+			t.Errorf("password %q: %v", password, err)
+		}
+	}
+}
+
+func TestGeneratePreview(t *testing.T) {
+	dir := t.TempDir()
+	writeImage := func(name string, w, h int) string {
+		path := filepath.Join(dir, name)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, w, h))); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	svg := filepath.Join(dir, "logo.svg")
+	if err := os.WriteFile(svg, []byte(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 20 10"><rect width="20" height="10"/></svg>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	text := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(text, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		input         string
+		size          int
+		width, height int
+		code          Code
+	}{
+		{"wide image", writeImage("wide.png", 400, 100), 64, 64, 16, ""},
+		{"tall image", writeImage("tall.png", 30, 300), 64, 6, 64, ""},
+		{"small image kept", writeImage("small.png", 20, 10), 64, 20, 10, ""},
+		{"thin image", writeImage("thin.png", 1000, 1), 64, 64, 1, ""},
+		{"svg", svg, 64, 64, 32, ""},
+		{"zero size", writeImage("zero.png", 20, 10), 0, 0, 0, CodeInvalidOptions},
+		{"negative size", writeImage("negative.png", 20, 10), -1, 0, 0, CodeInvalidOptions},
+		{"unsupported", text, 64, 0, 0, CodeUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		output := filepath.Join(dir, tt.name+".png")
+		err := NewPreviewConverter().GeneratePreview(tt.input, WithOutputPath(output), WithPreviewMaxDimension(tt.size))
+		if code := ErrorCode(err); err != nil && code != tt.code || err == nil && tt.code != "" {
+			t.Errorf("%s: error = %v with code %s, want %s", tt.name, err, code, tt.code)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		f, err := os.Open(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := png.DecodeConfig(f)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: output is not a png: %v", tt.name, err)
+		} else if config.Width != tt.width || config.Height != tt.height {
+			t.Errorf("%s: preview is %dx%d, want %dx%d", tt.name, config.Width, config.Height, tt.width, tt.height)
+		}
+	}
+}
+
+func TestGeneratePreviewDefaultOutput(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "photo.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	f.Close()
+
+	if err := NewPreviewConverter().GeneratePreview(input); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "photo-preview.png")); err != nil {
+		t.Errorf("preview not written next to the input: %v", err)
+	}
+}
+
+func TestPreviewPDF(t *testing.T) {
+	if _, err := exec.LookPath(DefaultToolPaths().Pdftoppm); err != nil {
+		t.Skip("pdftoppm is not installed")
+	}
+	dir := t.TempDir()
+	input := writeTestPDF(t, dir, "in.pdf", 3)
+	output := filepath.Join(dir, "out.png")
+	if err := NewPreviewConverter().GeneratePreview(input, WithOutputPath(output), WithPreviewMaxDimension(64)); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	config, err := png.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max(config.Width, config.Height) != 64 {
+		t.Errorf("preview is %dx%d, want a longest side of 64", config.Width, config.Height)
+	}
+}
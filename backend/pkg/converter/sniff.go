@@ -0,0 +1,136 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Formats reported by DetectFormat
+const (
+	FormatPDF  = "pdf"
+	FormatDOCX = "docx"
+	FormatPNG  = "png"
+	FormatJPEG = "jpeg"
+	FormatGIF  = "gif"
+	FormatBMP  = "bmp"
+	FormatWebP = "webp"
+	FormatTIFF = "tiff"
+	FormatSVG  = "svg"
+)
+
+// Canonical file extension of each detected format
+var formatExtensions = map[string]string{
+	FormatPDF:  ".pdf",
+	FormatDOCX: ".docx",
+	FormatPNG:  ".png",
+	FormatJPEG: ".jpg",
+	FormatGIF:  ".gif",
+	FormatBMP:  ".bmp",
+	FormatWebP: ".webp",
+	FormatTIFF: ".tiff",
+	FormatSVG:  ".svg",
+}
+
+// Number of leading bytes inspected; PDF allows junk before the header
+const sniffLength = 1024
+
+// Sizes of the BMP info headers in use, which follow the file header
+var bmpInfoHeaderSizes = map[uint32]bool{12: true, 40: true, 52: true, 56: true, 108: true, 124: true}
+
+// DetectFormat identifies a file by its content rather than its name. It
+// returns "" when the content matches no supported format.
+func DetectFormat(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w", err)
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("error reading file: %w", err)
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG, nil
+	case bytes.HasPrefix(head, []byte("\xff\xd8\xff")):
+		return FormatJPEG, nil
+	case bytes.HasPrefix(head, []byte("GIF87a")), bytes.HasPrefix(head, []byte("GIF89a")):
+		return FormatGIF, nil
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "WEBP":
+		return FormatWebP, nil
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return FormatTIFF, nil
+	case len(head) >= 18 && bytes.HasPrefix(head, []byte("BM")) &&
+		bmpInfoHeaderSizes[binary.LittleEndian.Uint32(head[14:18])]:
+		return FormatBMP, nil
+	case hasSVGContent(head):
+		return FormatSVG, nil
+	case hasPDFHeader(head):
+		return FormatPDF, nil
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		if isDocxArchive(f) {
+			return FormatDOCX, nil
+		}
+		return "", nil
+	}
+	return "", nil
+}
+
+// hasPDFHeader reports whether head holds a PDF header. Readers accept junk
+// before it, but not markup: "%PDF-" in the text of an XML file does not
+// make it a PDF.
+func hasPDFHeader(head []byte) bool {
+	i := bytes.Index(head, []byte("%PDF-"))
+	if i < 0 {
+		return false
+	}
+	junk := bytes.TrimSpace(bytes.TrimPrefix(head[:i], []byte("\xef\xbb\xbf")))
+	return !bytes.HasPrefix(junk, []byte("<"))
+}
+
+// isDocxArchive reports whether a ZIP archive holds a Word document body
+func isDocxArchive(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	archive, err := zip.NewReader(f, info.Size())
+	if err != nil {
+		return false
+	}
+	for _, entry := range archive.File {
+		if entry.Name == "word/document.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+// FormatExtension returns the canonical extension of a detected format,
+// e.g. ".jpg" for "jpeg"
+func FormatExtension(format string) string {
+	return formatExtensions[format]
+}
+
+// FormatForExtension returns the format a file extension claims, or ""
+// for extensions of unsupported formats
+func FormatForExtension(ext string) string {
+	switch strings.ToLower(strings.TrimPrefix(ext, ".")) {
+	case "jpg", "jpeg":
+		return FormatJPEG
+	case "tif", "tiff":
+		return FormatTIFF
+	case "pdf", "docx", "png", "gif", "bmp", "webp", "svg":
+		return strings.ToLower(strings.TrimPrefix(ext, "."))
+	}
+	return ""
+}
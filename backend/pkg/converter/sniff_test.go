@@ -0,0 +1,103 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestFile writes data to name in dir
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// zipBytes returns a ZIP archive holding empty entries of the given names
+func zipBytes(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		if _, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectFormat(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	var pngData, jpegData, gifData bytes.Buffer
+	png.Encode(&pngData, img)
+	jpeg.Encode(&jpegData, img, nil)
+	gif.Encode(&gifData, img, nil)
+
+	const svg = `<svg xmlns="http://www.w3.org/2000/svg" width="4" height="4"/>`
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"png", pngData.Bytes(), FormatPNG},
+		{"jpeg", jpegData.Bytes(), FormatJPEG},
+		{"gif", gifData.Bytes(), FormatGIF},
+		{"webp", []byte("RIFF\x10\x00\x00\x00WEBPVP8 "), FormatWebP},
+		{"tiff", []byte("II*\x00\x08\x00\x00\x00"), FormatTIFF},
+		{"bmp", append([]byte("BM"), make([]byte, 12)...), ""},
+		{"bmp header", append(append([]byte("BM"), make([]byte, 12)...), 40, 0, 0, 0), FormatBMP},
+		{"pdf", []byte("%PDF-1.7\n"), FormatPDF},
+		{"pdf after junk", []byte("\r\n\x00junk%PDF-1.4\n"), FormatPDF},
+		{"docx", zipBytes(t, "[Content_Types].xml", "word/document.xml"), FormatDOCX},
+		{"plain zip", zipBytes(t, "notes.txt"), ""},
+		{"svg", []byte(svg), FormatSVG},
+		{"svg with declaration", []byte("<?xml version=\"1.0\"?>\n" + svg), FormatSVG},
+		{"svg with bom", []byte("\xef\xbb\xbf<?xml version=\"1.0\"?>\n" + svg), FormatSVG},
+		{"svg with bom and blank line", []byte("\xef\xbb\xbf\n  " + svg), FormatSVG},
+		{"other xml", []byte(`<?xml version="1.0"?><html/>`), ""},
+		{"svg mentioning pdf", []byte("<?xml version=\"1.0\"?>\n<!-- traced from %PDF-1.4 -->\n" + svg), FormatSVG},
+		{"svg text mentioning pdf", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><text>%PDF-1.7</text></svg>`), FormatSVG},
+		{"xml mentioning pdf", []byte(`<?xml version="1.0"?><note>%PDF-1.7</note>`), ""},
+		{"text", []byte("hello"), ""},
+		{"empty", nil, ""},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		got, err := DetectFormat(writeTestFile(t, dir, "upload", tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: DetectFormat = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFormatForExtension(t *testing.T) {
+	tests := map[string]string{
+		".jpg": FormatJPEG, ".JPEG": FormatJPEG, ".tif": FormatTIFF, ".Pdf": FormatPDF,
+		".svg": FormatSVG, ".exe": "", "": "",
+	}
+	for ext, want := range tests {
+		if got := FormatForExtension(ext); got != want {
+			t.Errorf("FormatForExtension(%q) = %q, want %q", ext, got, want)
+		}
+	}
+	if got := FormatExtension(FormatJPEG); got != ".jpg" {
+		t.Errorf("FormatExtension(jpeg) = %q, want .jpg", got)
+	}
+}
@@ -0,0 +1,121 @@
+package converter
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// SVG user units are CSS pixels, defined as 1/96 inch
+const svgBaseDPI = 96.0
+
+// Largest side of a rasterized SVG in pixels
+const maxSVGDimension = 10000
+
+// isSVGFile reports whether the file is an SVG document, judged by its
+// extension or by an <svg> element near the start of the file
+func isSVGFile(path string) bool {
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		return true
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLength)
+	n, _ := f.Read(head)
+	return hasSVGContent(head[:n])
+}
+
+// hasSVGContent reports whether the start of a file is an XML document with
+// an <svg> element
+func hasSVGContent(head []byte) bool {
+	// A UTF-8 byte order mark may precede the XML declaration
+	head = bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+	return (bytes.HasPrefix(head, []byte("<?xml")) || bytes.HasPrefix(head, []byte("<svg"))) &&
+		bytes.Contains(head, []byte("<svg"))
+}
+
+// rasterizeSVG renders an SVG file. An explicit SVGWidth and/or SVGHeight
+// sets the output size, keeping the aspect ratio; otherwise the intrinsic
+// size is scaled from 96 DPI to SVGDPI.
+func rasterizeSVG(inputFile string, opts ConvertOptions) (_ image.Image, err error) {
+	span := startStage(opts, stageRender, attribute.String("format", "svg"))
+	defer func() { endStage(span, err) }()
+
+	f, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("error opening input file: %w", err)
+	}
+	defer f.Close()
+
+	icon, err := oksvg.ReadIconStream(f, oksvg.WarnErrorMode)
+	if err != nil {
+		return nil, corruptInput("error decoding svg", err)
+	}
+
+	width, height := svgOutputSize(icon.ViewBox.W, icon.ViewBox.H, opts)
+	if width <= 0 || height <= 0 {
+		return nil, invalidOption("svg has no size: set a viewBox or width and height")
+	}
+	if side := max(width, height); side > maxSVGDimension {
+		return nil, &LimitError{"svg output side in pixels", int64(side), maxSVGDimension}
+	}
+	if err := opts.Limits.checkPixels(width, height); err != nil {
+		return nil, err
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	if !opts.PreserveAlpha {
+		// Formats without alpha would otherwise show a black background
+		draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	}
+
+	icon.SetTarget(0, 0, float64(width), float64(height))
+	scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1.0)
+	return img, nil
+}
+
+// svgOutputSize resolves the pixel size of a rasterized SVG
+func svgOutputSize(viewWidth, viewHeight float64, opts ConvertOptions) (int, int) {
+	if viewWidth <= 0 || viewHeight <= 0 {
+		return opts.SVGWidth, opts.SVGHeight
+	}
+
+	aspect := viewHeight / viewWidth
+	switch {
+	case opts.SVGWidth > 0 && opts.SVGHeight > 0:
+		// Fit inside the requested box
+		width := float64(opts.SVGWidth)
+		height := width * aspect
+		if height > float64(opts.SVGHeight) {
+			height = float64(opts.SVGHeight)
+			width = height / aspect
+		}
+		return int(math.Round(width)), int(math.Round(height))
+	case opts.SVGWidth > 0:
+		return opts.SVGWidth, int(math.Round(float64(opts.SVGWidth) * aspect))
+	case opts.SVGHeight > 0:
+		return int(math.Round(float64(opts.SVGHeight) / aspect)), opts.SVGHeight
+	}
+
+	dpi := opts.SVGDPI
+	if dpi <= 0 {
+		dpi = svgBaseDPI
+	}
+	scale := dpi / svgBaseDPI
+	return int(math.Round(viewWidth * scale)), int(math.Round(viewHeight * scale))
+}
@@ -0,0 +1,18 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRasterizeSVGWithoutSize(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "in.svg")
+	if err := os.WriteFile(input, []byte(`<svg xmlns="http://www.w3.org/2000/svg"><rect width="10" height="10"/></svg>`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := rasterizeSVG(input, DefaultOptions())
+	if code := ErrorCode(err); code != CodeInvalidOptions {
+		t.Errorf("error = %v with code %s, want %s", err, code, CodeInvalidOptions)
+	}
+}
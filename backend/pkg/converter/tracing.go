@@ -0,0 +1,36 @@
+package converter
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Names of the spans recorded for each conversion stage
+const (
+	stageDecode     = "decode"     // reading and parsing the input
+	stageTransform  = "transform"  // resizing, watermarking and page operations
+	stageRender     = "render"     // laying out or rasterizing the output
+	stageEncode     = "encode"     // serializing and writing the output
+	stageSubprocess = "subprocess" // running an external tool
+)
+
+// tracer records conversion stages under the span in ConvertOptions.Context
+var tracer = otel.Tracer("github.com/KennyMwendwaX/reformat/pkg/converter")
+
+// startStage starts the span of a conversion stage. With no tracer
+// provider installed the span does nothing.
+func startStage(opts ConvertOptions, stage string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := tracer.Start(opts.Context, "converter."+stage, trace.WithAttributes(attrs...))
+	return span
+}
+
+// endStage ends a stage span, marking it failed when err is not nil
+func endStage(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,321 @@
+package converter
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
+)
+
+// Watermark describes a text or image stamp applied to converted output
+type Watermark struct {
+	Text     string
+	Image    string  // path to an image file, used instead of Text when set
+	Position string  // center, top-left, top-right, bottom-left or bottom-right
+	Rotation float64 // degrees, counter-clockwise
+	Opacity  float64 // 0-1
+	Scale    float64 // stamp width relative to the page or image width, 0-1
+	Tile     bool    // repeat the stamp across the whole page or image
+}
+
+// Defaults applied to unset watermark fields
+const (
+	defaultWatermarkOpacity = 0.3
+	defaultWatermarkScale   = 0.5
+	watermarkMargin         = 0.03 // fraction of the shorter side
+	watermarkGray           = 128
+	maxWatermarkTiles       = 1_000 // stamps drawn on one page or image when tiling
+)
+
+// normalize validates the watermark and fills in defaults
+func (wm *Watermark) normalize() error {
+	if wm.Text == "" && wm.Image == "" {
+		return invalidOption("watermark needs text or an image")
+	}
+	for _, v := range []float64{wm.Rotation, wm.Opacity, wm.Scale} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return invalidOption("watermark rotation, opacity and scale must be finite numbers")
+		}
+	}
+	if wm.Opacity == 0 {
+		wm.Opacity = defaultWatermarkOpacity
+	}
+	if wm.Opacity < 0 || wm.Opacity > 1 {
+		return invalidOption("watermark opacity must be between 0 and 1")
+	}
+	if wm.Scale == 0 {
+		wm.Scale = defaultWatermarkScale
+	}
+	if wm.Scale < 0 || wm.Scale > 1 {
+		return invalidOption("watermark scale must be between 0 and 1")
+	}
+
+	wm.Position = strings.ToLower(wm.Position)
+	switch wm.Position {
+	case "":
+		wm.Position = "center"
+	case "center", "top-left", "top-right", "bottom-left", "bottom-right":
+	default:
+		return invalidOption("invalid watermark position: %s", wm.Position)
+	}
+	return nil
+}
+
+// placements returns the centers of every stamp for an area of the given
+// size, where boxW and boxH are the stamp's rotated bounding box. Tiling
+// fails when the stamp is so small it would take more than
+// maxWatermarkTiles stamps to cover the area.
+func (wm *Watermark) placements(areaW, areaH, boxW, boxH float64) ([][2]float64, error) {
+	if wm.Tile {
+		gap := math.Max(boxW, boxH) * 0.25
+		// Written so a zero sized box, giving NaN or Inf, fails as well
+		tiles := math.Ceil(areaW/(boxW+gap)) * math.Ceil(areaH/(boxH+gap))
+		if !(tiles <= maxWatermarkTiles) {
+			return nil, invalidOption("watermark is too small to tile, it would take more than %d stamps", maxWatermarkTiles)
+		}
+
+		var centers [][2]float64
+		for y := boxH / 2; y-boxH/2 < areaH; y += boxH + gap {
+			for x := boxW / 2; x-boxW/2 < areaW; x += boxW + gap {
+				centers = append(centers, [2]float64{x, y})
+			}
+		}
+		return centers, nil
+	}
+
+	margin := math.Min(areaW, areaH) * watermarkMargin
+	x, y := areaW/2, areaH/2
+	if strings.HasSuffix(wm.Position, "left") {
+		x = margin + boxW/2
+	} else if strings.HasSuffix(wm.Position, "right") {
+		x = areaW - margin - boxW/2
+	}
+	if strings.HasPrefix(wm.Position, "top") {
+		y = margin + boxH/2
+	} else if strings.HasPrefix(wm.Position, "bottom") {
+		y = areaH - margin - boxH/2
+	}
+	return [][2]float64{{x, y}}, nil
+}
+
+// rotatedSize returns the bounding box of a w x h rectangle rotated by the
+// watermark angle
+func (wm *Watermark) rotatedSize(w, h float64) (float64, float64) {
+	rad := wm.Rotation * math.Pi / 180
+	cos, sin := math.Abs(math.Cos(rad)), math.Abs(math.Sin(rad))
+	return w*cos + h*sin, w*sin + h*cos
+}
+
+// applyImageWatermark returns a copy of img with the watermark drawn on top
+func applyImageWatermark(img image.Image, wm *Watermark, limits Limits) (image.Image, error) {
+	if err := wm.normalize(); err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	targetWidth := int(float64(bounds.Dx()) * wm.Scale)
+	if targetWidth < 1 {
+		targetWidth = 1
+	}
+
+	stamp, err := wm.renderStamp(targetWidth, limits)
+	if err != nil {
+		return nil, err
+	}
+	rw, rh := wm.rotatedSize(float64(stamp.Bounds().Dx()), float64(stamp.Bounds().Dy()))
+	if err := limits.checkPixels(int(math.Ceil(rw)), int(math.Ceil(rh))); err != nil {
+		return nil, err
+	}
+	stamp = rotateImage(stamp, wm.Rotation)
+	fadeImage(stamp, wm.Opacity)
+
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(out, out.Bounds(), img, bounds.Min, draw.Src)
+
+	size := stamp.Bounds().Size()
+	centers, err := wm.placements(float64(bounds.Dx()), float64(bounds.Dy()), float64(size.X), float64(size.Y))
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range centers {
+		at := image.Pt(int(c[0])-size.X/2, int(c[1])-size.Y/2)
+		draw.Draw(out, image.Rectangle{Min: at, Max: at.Add(size)}, stamp, image.Point{}, draw.Over)
+	}
+	return out, nil
+}
+
+// renderStamp draws the unrotated watermark at the given pixel width
+func (wm *Watermark) renderStamp(width int, limits Limits) (*image.RGBA, error) {
+	if wm.Image != "" {
+		logo, err := decodeImageFile(wm.Image, limits)
+		if err != nil {
+			return nil, fmt.Errorf("error loading watermark image: %w", err)
+		}
+		// A tall, narrow logo scaled to the target width can be far larger
+		// than the decoded file
+		b := logo.Bounds()
+		height := max(1, b.Dy()*width/b.Dx())
+		if err := limits.checkPixels(width, height); err != nil {
+			return nil, err
+		}
+		stamp := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(stamp, stamp.Bounds(), logo, b, draw.Src, nil)
+		return stamp, nil
+	}
+
+	ttf, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, fmt.Errorf("error loading watermark font: %w", err)
+	}
+
+	// Measure at a reference size, then scale the font to the target width
+	const refSize = 100.0
+	face, err := opentype.NewFace(ttf, &opentype.FaceOptions{Size: refSize, DPI: 72})
+	if err != nil {
+		return nil, fmt.Errorf("error loading watermark font: %w", err)
+	}
+	refWidth := font.MeasureString(face, wm.Text).Ceil()
+	face.Close()
+	if refWidth == 0 {
+		return nil, invalidOption("watermark text is empty")
+	}
+
+	face, err = opentype.NewFace(ttf, &opentype.FaceOptions{
+		Size: refSize * float64(width) / float64(refWidth),
+		DPI:  72,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading watermark font: %w", err)
+	}
+	defer face.Close()
+
+	metrics := face.Metrics()
+	textWidth, textHeight := max(1, font.MeasureString(face, wm.Text).Ceil()), max(1, metrics.Height.Ceil())
+	if err := limits.checkPixels(textWidth, textHeight); err != nil {
+		return nil, err
+	}
+	stamp := image.NewRGBA(image.Rect(0, 0, textWidth, textHeight))
+	drawer := &font.Drawer{
+		Dst:  stamp,
+		Src:  image.NewUniform(color.Gray{Y: watermarkGray}),
+		Face: face,
+		Dot:  fixed.Point26_6{Y: metrics.Ascent},
+	}
+	drawer.DrawString(wm.Text)
+	return stamp, nil
+}
+
+// rotateImage rotates src counter-clockwise by degrees onto a canvas that
+// fits the rotated bounding box
+func rotateImage(src *image.RGBA, degrees float64) *image.RGBA {
+	if math.Mod(degrees, 360) == 0 {
+		return src
+	}
+
+	rad := degrees * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	w, h := float64(src.Bounds().Dx()), float64(src.Bounds().Dy())
+	rw := math.Abs(w*cos) + math.Abs(h*sin)
+	rh := math.Abs(w*sin) + math.Abs(h*cos)
+
+	dst := image.NewRGBA(image.Rect(0, 0, int(math.Ceil(rw)), int(math.Ceil(rh))))
+	// Image y grows downwards, so a visual counter-clockwise turn uses -sin
+	cx, cy := w/2, h/2
+	dx, dy := rw/2, rh/2
+	m := f64.Aff3{
+		cos, sin, dx - (cos*cx + sin*cy),
+		-sin, cos, dy - (-sin*cx + cos*cy),
+	}
+	draw.BiLinear.Transform(dst, m, src, src.Bounds(), draw.Over, nil)
+	return dst
+}
+
+// fadeImage scales the alpha of every pixel by opacity
+func fadeImage(img *image.RGBA, opacity float64) {
+	for i := range img.Pix {
+		// Pix is premultiplied, so every channel scales with alpha
+		img.Pix[i] = uint8(float64(img.Pix[i]) * opacity)
+	}
+}
+
+// applyPDFWatermark stamps the watermark of opts on top of every page of
+// pdf. It must be called before the first page is added. PDF/A output gets
+// the image flattened, as PDF/A-1 forbids transparency.
+func applyPDFWatermark(pdf *fpdf.Fpdf, opts ConvertOptions) error {
+	wm := opts.Watermark
+	if err := wm.normalize(); err != nil {
+		return err
+	}
+
+	var imageName string
+	var imageSize image.Point
+	if wm.Image != "" {
+		var err error
+		imageName, imageSize, err = pdfImageRegistrar(opts)(pdf, wm.Image, opts.Limits)
+		if err != nil {
+			return fmt.Errorf("error loading watermark image: %w", err)
+		}
+	}
+	fontName := documentFont(opts)
+	translate := pdfTranslator(pdf, opts)
+
+	// The footer runs after the page content, so the stamp is drawn on top
+	pdf.SetFooterFunc(func() {
+		pageWidth, pageHeight := pdf.GetPageSize()
+		width := pageWidth * wm.Scale
+
+		var height, fontSize float64
+		if imageName != "" {
+			height = width * float64(imageSize.Y) / float64(imageSize.X)
+		} else {
+			// Size the font so the text spans the target width
+			pdf.SetFont(fontName, "B", 100)
+			textWidth := pdf.GetStringWidth(translate(wm.Text))
+			if textWidth <= 0 {
+				pdf.SetError(invalidOption("watermark text has no printable characters"))
+				return
+			}
+			fontSize = 100 * width / textWidth
+			pdf.SetFont(fontName, "B", fontSize)
+			_, height = pdf.GetFontSize()
+			pdf.SetTextColor(watermarkGray, watermarkGray, watermarkGray)
+		}
+
+		boxW, boxH := wm.rotatedSize(width, height)
+		centers, err := wm.placements(pageWidth, pageHeight, boxW, boxH)
+		if err != nil {
+			pdf.SetError(err)
+			return
+		}
+		// Any alpha setting adds a transparency group to the page, which
+		// PDF/A-1 forbids, so opaque stamps skip it
+		if wm.Opacity < 1 {
+			pdf.SetAlpha(wm.Opacity, "Normal")
+		}
+		for _, c := range centers {
+			pdf.TransformBegin()
+			pdf.TransformRotate(wm.Rotation, c[0], c[1])
+			if imageName != "" {
+				pdf.ImageOptions(imageName, c[0]-width/2, c[1]-height/2, width, height,
+					false, fpdf.ImageOptions{AllowNegativePosition: true}, 0, "")
+			} else {
+				// Text is positioned by its baseline, roughly a third below center
+				pdf.Text(c[0]-width/2, c[1]+height*0.35, translate(wm.Text))
+			}
+			pdf.TransformEnd()
+		}
+		if wm.Opacity < 1 {
+			pdf.SetAlpha(1, "Normal")
+		}
+	})
+	return pdf.Error()
+}
@@ -0,0 +1,113 @@
+package converter
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-pdf/fpdf"
+)
+
+func TestWatermarkNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		wm   Watermark
+		ok   bool
+	}{
+		{"defaults", Watermark{Text: "X"}, true},
+		{"no content", Watermark{}, false},
+		{"opacity above 1", Watermark{Text: "X", Opacity: 1.5}, false},
+		{"nan opacity", Watermark{Text: "X", Opacity: math.NaN()}, false},
+		{"nan scale", Watermark{Text: "X", Scale: math.NaN()}, false},
+		{"infinite rotation", Watermark{Text: "X", Rotation: math.Inf(1)}, false},
+		{"bad position", Watermark{Text: "X", Position: "middle"}, false},
+	}
+	for _, tt := range tests {
+		err := tt.wm.normalize()
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("%s: error = %v, want an invalid options error", tt.name, err)
+		}
+	}
+}
+
+func TestImageWatermarkRejectsTinyTiles(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in.png")
+	f, err := os.Create(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(f, image.NewRGBA(image.Rect(0, 0, 800, 600)))
+	f.Close()
+
+	for _, wm := range []Watermark{
+		{Text: "X", Scale: 1e-4, Tile: true},
+		{Text: "X", Rotation: math.Inf(1)},
+	} {
+		err := NewImageFormatConverter().Convert(input, "png",
+			WithOutputPath(filepath.Join(dir, "out.png")), WithWatermark(wm))
+		if !errors.Is(err, ErrInvalidOptions) {
+			t.Errorf("watermark %+v: error = %v, want an invalid options error", wm, err)
+		}
+	}
+
+	err = NewImageFormatConverter().Convert(input, "png",
+		WithOutputPath(filepath.Join(dir, "out.png")), WithWatermark(Watermark{Text: "X", Scale: 0.1, Tile: true}))
+	if err != nil {
+		t.Errorf("tiled watermark: %v", err)
+	}
+}
+
+func TestPDFWatermarkRejectsTinyTiles(t *testing.T) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	err := applyPDFWatermark(pdf, ConvertOptions{FontName: "Arial", Watermark: &Watermark{Text: "X", Scale: 1e-4, Tile: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pdf.AddPage()
+	pdf.Close()
+	if !errors.Is(pdf.Error(), ErrInvalidOptions) {
+		t.Errorf("error = %v, want an invalid options error", pdf.Error())
+	}
+}
+
+func TestImageWatermarkChecksStampPixels(t *testing.T) {
+	dir := t.TempDir()
+	writePNG := func(name string, w, h int) string {
+		path := filepath.Join(dir, name)
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		png.Encode(f, image.NewGray(image.Rect(0, 0, w, h)))
+		f.Close()
+		return path
+	}
+	input := writePNG("in.png", 400, 300)
+	// 2 x 20000 passes the limit, but scaled to 200 pixels wide it is
+	// 200 x 2000000, and turned by 45 degrees it needs a 14000 pixel square
+	logo := writePNG("logo.png", 2, 20_000)
+
+	tests := []struct {
+		name string
+		wm   Watermark
+	}{
+		{"scaled", Watermark{Image: logo, Scale: 0.5}},
+		{"rotated", Watermark{Image: logo, Scale: 0.005, Rotation: 45}},
+	}
+	for _, tt := range tests {
+		err := NewImageFormatConverter().Convert(input, "png", WithOutputPath(filepath.Join(dir, "out.png")),
+			WithWatermark(tt.wm), WithLimits(Limits{MaxPixels: 150_000}))
+		var limit *LimitError
+		if !errors.As(err, &limit) {
+			t.Errorf("%s: error = %v, want a limit error", tt.name, err)
+		}
+	}
+}